@@ -0,0 +1,89 @@
+// ConoHa DNS のA/AAAAレコードを現在のグローバルIPアドレスに更新するダイナミックDNSクライアント
+//
+// 認証情報は環境変数 CONOHA_IDENTITY_URL, CONOHA_USER_ID, CONOHA_PASSWORD, CONOHA_TENANT_ID で指定する
+//
+//	conoha-ddns -ipv4-url https://api.ipify.org -ipv6-url https://api6.ipify.org office.example.com
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/elfincafe/conoha"
+)
+
+func source(url, iface, command string) conoha.IpSource {
+	switch {
+	case url != "":
+		return &conoha.UrlIpSource{Url: url}
+	case iface != "":
+		return &conoha.InterfaceIpSource{Name: iface}
+	case command != "":
+		args := strings.Fields(command)
+		return &conoha.CommandIpSource{Name: args[0], Args: args[1:]}
+	}
+	return nil
+}
+
+func main() {
+	ipv4Url := flag.String("ipv4-url", "", "URL returning the public IPv4 address")
+	ipv4Iface := flag.String("ipv4-interface", "", "network interface holding the public IPv4 address")
+	ipv4Command := flag.String("ipv4-command", "", "command printing the public IPv4 address")
+	ipv6Url := flag.String("ipv6-url", "", "URL returning the public IPv6 address")
+	ipv6Iface := flag.String("ipv6-interface", "", "network interface holding the public IPv6 address")
+	ipv6Command := flag.String("ipv6-command", "", "command printing the public IPv6 address")
+	ttl := flag.Int("ttl", 0, "record TTL (0 uses the domain TTL)")
+	interval := flag.Duration("interval", 5*time.Minute, "polling interval")
+	once := flag.Bool("once", false, "update once and exit")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		log.Fatal("no record names")
+	}
+
+	identity := os.Getenv("CONOHA_IDENTITY_URL")
+	if identity == "" {
+		identity = "https://identity.c3j1.conoha.io/v3/auth/tokens"
+	}
+	api := conoha.NewV3()
+	login := func() error {
+		if time.Until(api.ExpiredAt) > 10*time.Minute {
+			return nil
+		}
+		_, err := api.PublishTokenById(identity, os.Getenv("CONOHA_USER_ID"), os.Getenv("CONOHA_PASSWORD"), os.Getenv("CONOHA_TENANT_ID"))
+		return err
+	}
+	if err := login(); err != nil {
+		log.Fatal(err)
+	}
+
+	ddns := conoha.NewDynamicDns(api, flag.Args()...)
+	ddns.Prepare = login
+	ddns.Ipv4 = source(*ipv4Url, *ipv4Iface, *ipv4Command)
+	ddns.Ipv6 = source(*ipv6Url, *ipv6Iface, *ipv6Command)
+	if ddns.Ipv4 == nil && ddns.Ipv6 == nil {
+		ddns.Ipv4 = &conoha.UrlIpSource{Url: "https://api.ipify.org"}
+	}
+	ddns.Ttl = *ttl
+	ddns.Interval = *interval
+	ddns.OnUpdate = func(u conoha.DynamicDnsUpdate) {
+		log.Printf("%s %s: %s -> %s", u.Name, u.Type, u.Old, u.New)
+	}
+	ddns.OnError = func(err error) {
+		log.Print(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *once {
+		if _, err := ddns.RunOnce(ctx); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	log.Print(ddns.Run(ctx))
+}
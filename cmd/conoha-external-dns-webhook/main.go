@@ -0,0 +1,93 @@
+// external-dns の webhook プロバイダとして ConoHa DNS を操作するサーバー
+//
+// 環境変数:
+//
+//	CONOHA_IDENTITY_URL  トークン発行URL(デフォルト https://identity.c3j1.conoha.io/v3/auth/tokens)
+//	CONOHA_USER_ID       APIユーザーID
+//	CONOHA_PASSWORD      APIユーザーのパスワード
+//	CONOHA_TENANT_ID     テナントID
+//	DOMAIN_FILTER        対象とするドメイン(カンマ区切り)
+//	EXCLUDE_DOMAINS      対象外とするドメイン(カンマ区切り)
+//	TXT_OWNER_ID         external-dns の --txt-owner-id (デフォルト default)
+//	TXT_PREFIX           external-dns の --txt-prefix
+//	TXT_SUFFIX           external-dns の --txt-suffix
+//	WEBHOOK_LISTEN       webhookの待受アドレス(デフォルト localhost:8888)
+//	HEALTH_LISTEN        ヘルスチェックの待受アドレス(デフォルト :8080)
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elfincafe/conoha"
+)
+
+func env(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func list(key string) []string {
+	v := []string{}
+	for _, s := range strings.Split(os.Getenv(key), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			v = append(v, s)
+		}
+	}
+	return v
+}
+
+func main() {
+	identity := env("CONOHA_IDENTITY_URL", "https://identity.c3j1.conoha.io/v3/auth/tokens")
+	userId := os.Getenv("CONOHA_USER_ID")
+	password := os.Getenv("CONOHA_PASSWORD")
+	tenantId := os.Getenv("CONOHA_TENANT_ID")
+	if userId == "" || password == "" || tenantId == "" {
+		log.Fatal("CONOHA_USER_ID, CONOHA_PASSWORD and CONOHA_TENANT_ID are required")
+	}
+
+	api := conoha.NewV3()
+	mu := sync.Mutex{}
+	// トークンの有効期限が近い場合は再発行する
+	refresh := func() error {
+		if time.Until(api.ExpiredAt) > 10*time.Minute {
+			return nil
+		}
+		_, err := api.PublishTokenById(identity, userId, password, tenantId)
+		return err
+	}
+	if err := refresh(); err != nil {
+		log.Fatal(err)
+	}
+
+	webhook := conoha.NewExternalDnsWebhook(api, list("DOMAIN_FILTER"), list("EXCLUDE_DOMAINS"))
+	webhook.OwnerId = env("TXT_OWNER_ID", "default")
+	webhook.TxtPrefix = os.Getenv("TXT_PREFIX")
+	webhook.TxtSuffix = os.Getenv("TXT_SUFFIX")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := refresh(); err != nil {
+			log.Print(err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		log.Printf("%s %s", r.Method, r.URL.Path)
+		webhook.ServeHTTP(w, r)
+	})
+
+	go func() {
+		health := http.NewServeMux()
+		health.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})
+		log.Fatal(http.ListenAndServe(env("HEALTH_LISTEN", ":8080"), health))
+	}()
+	log.Fatal(http.ListenAndServe(env("WEBHOOK_LISTEN", "localhost:8888"), handler))
+}
@@ -0,0 +1,120 @@
+package conoha
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type (
+	InterfaceAttachment struct {
+		PortId    string    `json:"port_id"`
+		NetId     string    `json:"net_id"`
+		MacAddr   string    `json:"mac_addr"`
+		PortState string    `json:"port_state"`
+		FixedIps  []FixedIp `json:"fixed_ips"`
+	}
+	// PortId か NetId のどちらかを指定する
+	AttachInterfaceRequest struct {
+		PortId   *uuid.UUID `json:"port_id,omitempty"`
+		NetId    *uuid.UUID `json:"net_id,omitempty"`
+		FixedIps []FixedIp  `json:"fixed_ips,omitempty"` // NetId を指定した場合のみ
+	}
+	GetServerInterfacesResponse struct {
+		InterfaceAttachments []InterfaceAttachment `json:"interfaceAttachments"`
+	}
+)
+
+// サーバーのインターフェース一覧取得
+func (api *V3) GetServerInterfaces(serverId uuid.UUID) (*GetServerInterfacesResponse, error) {
+	var v GetServerInterfacesResponse
+	err := api.request(api.Endpoints.Compute, "GET", fmt.Sprintf(`/v2.1/servers/%s/os-interface`, serverId), nil, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// インターフェース追加
+func (api *V3) AttachInterface(serverId uuid.UUID, req *AttachInterfaceRequest) (*InterfaceAttachment, error) {
+	body := map[string]any{"interfaceAttachment": req}
+	var v struct {
+		InterfaceAttachment InterfaceAttachment `json:"interfaceAttachment"`
+	}
+	err := api.request(api.Endpoints.Compute, "POST", fmt.Sprintf(`/v2.1/servers/%s/os-interface`, serverId), nil, body, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v.InterfaceAttachment, nil
+}
+
+// インターフェース削除
+func (api *V3) DetachInterface(serverId, portId uuid.UUID) error {
+	return api.request(api.Endpoints.Compute, "DELETE", fmt.Sprintf(`/v2.1/servers/%s/os-interface/%s`, serverId, portId), nil, nil, 202, nil)
+}
+
+// ポートにIPアドレスを追加する(subnetId が uuid.Nil の場合はポートのネットワークから選ばれる)
+func (api *V3) AddFixedIp(portId, subnetId uuid.UUID, addr string) (*Port, error) {
+	port, err := api.GetPort(portId)
+	if err != nil {
+		return nil, err
+	}
+	ip := FixedIp{IpAddress: addr}
+	if subnetId != uuid.Nil {
+		ip.SubnetId = subnetId.String()
+	}
+	ips := append(port.FixedIps, ip)
+	return api.UpdatePort(portId, &UpdatePortRequest{FixedIps: &ips})
+}
+
+// ポートからIPアドレスを削除する
+func (api *V3) RemoveFixedIp(portId uuid.UUID, addr string) (*Port, error) {
+	port, err := api.GetPort(portId)
+	if err != nil {
+		return nil, err
+	}
+	target, err := netip.ParseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips := []FixedIp{}
+	for _, ip := range port.FixedIps {
+		if a, err := netip.ParseAddr(ip.IpAddress); err == nil && a == target {
+			continue
+		}
+		ips = append(ips, ip)
+	}
+	if len(ips) == len(port.FixedIps) {
+		return nil, fmt.Errorf(`port %s does not have %s`, portId, addr)
+	}
+	return api.UpdatePort(portId, &UpdatePortRequest{FixedIps: &ips})
+}
+
+// サーバーのアドレスに addr が追加(present が false の場合は削除)されるまで待つ
+// インターフェースやIPアドレスの変更はサーバー情報に遅れて反映される
+func (api *V3) WaitServerAddress(ctx context.Context, serverId uuid.UUID, addr string, present bool, interval time.Duration) error {
+	target, err := netip.ParseAddr(addr)
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	for {
+		server, err := api.GetServer(serverId)
+		if err != nil {
+			return err
+		}
+		if server.Server.Addresses.Contains(target) == present {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf(`server %s: %s: %w`, serverId, addr, ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
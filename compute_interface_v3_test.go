@@ -0,0 +1,113 @@
+package conoha
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAttachInterface(t *testing.T) {
+	server, network := uuid.New(), uuid.New()
+	var mu sync.Mutex
+	attachments := []InterfaceAttachment{}
+	// 追加したインターフェースは2回目の確認からサーバー情報に反映される
+	calls := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/os-interface") && r.Method == http.MethodPost:
+			var body struct {
+				InterfaceAttachment AttachInterfaceRequest `json:"interfaceAttachment"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			a := InterfaceAttachment{PortId: uuid.NewString(), NetId: body.InterfaceAttachment.NetId.String(), PortState: "ACTIVE", FixedIps: body.InterfaceAttachment.FixedIps}
+			attachments = append(attachments, a)
+			json.NewEncoder(w).Encode(map[string]any{"interfaceAttachment": a})
+		case strings.HasSuffix(r.URL.Path, "/os-interface"):
+			json.NewEncoder(w).Encode(map[string]any{"interfaceAttachments": attachments})
+		case strings.Contains(r.URL.Path, "/os-interface/") && r.Method == http.MethodDelete:
+			attachments = attachments[:0]
+			w.WriteHeader(http.StatusAccepted)
+		case r.URL.Path == "/v2.1/servers/"+server.String():
+			calls++
+			addresses := map[string][]map[string]any{"ext-203-0-113-0-24": {{"version": 4, "addr": "203.0.113.5"}}}
+			if calls > 1 {
+				for _, a := range attachments {
+					for _, ip := range a.FixedIps {
+						addresses["local-"+a.NetId] = append(addresses["local-"+a.NetId], map[string]any{"version": 4, "addr": ip.IpAddress})
+					}
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]any{"server": map[string]any{"id": server.String(), "addresses": addresses}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+	api := NewV3()
+	api.Endpoints.Compute, _ = url.Parse(s.URL)
+
+	a, err := api.AttachInterface(server, &AttachInterfaceRequest{NetId: &network, FixedIps: []FixedIp{{IpAddress: "192.168.0.10"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.NetId != network.String() || len(a.FixedIps) != 1 {
+		t.Errorf("attachment: %+v", a)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := api.WaitServerAddress(ctx, server, "192.168.0.10", true, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("calls: %d", calls)
+	}
+	list, err := api.GetServerInterfaces(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.InterfaceAttachments) != 1 {
+		t.Errorf("attachments: %+v", list)
+	}
+	if err := api.DetachInterface(server, uuid.MustParse(a.PortId)); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.WaitServerAddress(ctx, server, "192.168.0.10", false, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFixedIp(t *testing.T) {
+	_, api := newNetworkTestServer(t)
+	port, err := api.CreatePort(&CreatePortRequest{NetworkId: uuid.New(), FixedIps: []FixedIp{{IpAddress: "192.168.0.10"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err = api.AddFixedIp(port.Id, uuid.Nil, "192.168.0.11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(port.FixedIps) != 2 || port.FixedIps[1].IpAddress != "192.168.0.11" || port.FixedIps[1].SubnetId != "" {
+		t.Errorf("fixed ips: %+v", port.FixedIps)
+	}
+	port, err = api.RemoveFixedIp(port.Id, "192.168.0.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(port.FixedIps) != 1 || port.FixedIps[0].IpAddress != "192.168.0.11" {
+		t.Errorf("fixed ips: %+v", port.FixedIps)
+	}
+	if _, err := api.RemoveFixedIp(port.Id, "192.168.0.10"); err == nil {
+		t.Error("removed an address that is not assigned")
+	}
+}
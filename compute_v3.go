@@ -3,6 +3,8 @@ package conoha
 import (
 	"encoding/json"
 	"fmt"
+	"net/netip"
+	"slices"
 	"strings"
 	"time"
 
@@ -11,6 +13,14 @@ import (
 )
 
 type (
+	ServerAddress struct {
+		Version         int        `json:"version"`
+		Addr            netip.Addr `json:"addr"`
+		OsExtIpsType    string     `json:"OS-EXT-IPS:type"`
+		OsExtIpsMacAddr string     `json:"OS-EXT-IPS-MAC:mac_addr"`
+	}
+	// ネットワーク名ごとのアドレス一覧
+	ServerAddresses    map[string][]ServerAddress
 	GetServersResponse struct {
 		Servers []struct {
 			Id    string `json:"id"`
@@ -44,16 +54,11 @@ type (
 					Href string `json:"href"`
 				} `json:"links"`
 			} `json:"flavor"`
-			Created   time.Time `json:"created"`
-			Updated   time.Time `json:"updated"`
-			Addresses map[string]struct {
-				Version         int    `json:"version"`
-				Addr            string `json:"addr"`
-				OsExtIpsType    string `json:"OS-EXT-IPS:type"`
-				OsExtIpsMacAddr string `json:"OS-EXT-IPS-MAC:mac_addr"`
-			} `json:"addresses"`
-			AccessIpv4 string `json:"accessIPv4"`
-			AccessIpv6 string `json:"accessIPv6"`
+			Created    time.Time       `json:"created"`
+			Updated    time.Time       `json:"updated"`
+			Addresses  ServerAddresses `json:"addresses"`
+			AccessIpv4 string          `json:"accessIPv4"`
+			AccessIpv6 string          `json:"accessIPv6"`
 			Links      []struct {
 				Rel  string `json:"rel"`
 				Href string `json:"href"`
@@ -90,6 +95,82 @@ type (
 	}
 )
 
+// アドレスを含むかどうか
+func (a ServerAddresses) Contains(addr netip.Addr) bool {
+	for _, list := range a {
+		for _, v := range list {
+			if v.Addr.Unmap() == addr.Unmap() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 全てのアドレス(ネットワーク名順)
+func (a ServerAddresses) All() []ServerAddress {
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	all := []ServerAddress{}
+	for _, name := range names {
+		all = append(all, a[name]...)
+	}
+	return all
+}
+
+// キャリアグレードNATの共有アドレス空間
+var sharedAddrSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// 公開アドレスかどうか
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddrSpace.Contains(addr)
+}
+
+func (a ServerAddresses) public(is4 bool) netip.Addr {
+	for _, v := range a.All() {
+		if v.Addr.Unmap().Is4() == is4 && isPublicAddr(v.Addr) {
+			return v.Addr.Unmap()
+		}
+	}
+	return netip.Addr{}
+}
+
+// 公開IPv4アドレス(ない場合は無効な netip.Addr)
+func (a ServerAddresses) PublicIPv4() netip.Addr {
+	return a.public(true)
+}
+
+// 公開IPv6アドレス(ない場合は無効な netip.Addr)
+func (a ServerAddresses) PublicIPv6() netip.Addr {
+	return a.public(false)
+}
+
+// プライベートアドレス一覧
+func (a ServerAddresses) PrivateAddresses() []netip.Addr {
+	addrs := []netip.Addr{}
+	for _, v := range a.All() {
+		if v.Addr.IsValid() && !isPublicAddr(v.Addr) {
+			addrs = append(addrs, v.Addr.Unmap())
+		}
+	}
+	return addrs
+}
+
+// MACアドレス一覧(重複なし)
+func (a ServerAddresses) MACs() []string {
+	macs := []string{}
+	for _, v := range a.All() {
+		if v.OsExtIpsMacAddr != "" && !slices.Contains(macs, v.OsExtIpsMacAddr) {
+			macs = append(macs, v.OsExtIpsMacAddr)
+		}
+	}
+	return macs
+}
+
 // ISOイメージ挿入
 func (api *V3) MountIsoImage(serverId, imageId uuid.UUID) (*MountIsoImageResponse, error) {
 	endpoint := api.Endpoints.Compute
@@ -289,9 +370,9 @@ func (api *V3) ForceShutdownServer(serverId uuid.UUID) error {
 
 // サーバー詳細取得
 func (api *V3) GetServer(id uuid.UUID) (*GetServerResponse, error) {
-	endpoint := api.Endpoints.Compute
+	endpoint := *api.Endpoints.Compute
 	endpoint.Path = fmt.Sprintf(`/v2.1/servers/%s`, id)
-	client := annette.New(endpoint)
+	client := annette.New(&endpoint)
 	client.Header.Set("Accept", "application/json")
 	client.Header.Set("X-Auth-Token", api.Token)
 	res, err := client.Get()
@@ -1 +1,68 @@
 package conoha
+
+import (
+	"encoding/json"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestServerAddresses(t *testing.T) {
+	data := `{"server": {"addresses": {
+		"ext-203-0-113-0-24": [
+			{"version": 6, "addr": "2001:db8::5", "OS-EXT-IPS:type": "fixed", "OS-EXT-IPS-MAC:mac_addr": "fa:16:3e:00:00:01"},
+			{"version": 4, "addr": "203.0.113.5", "OS-EXT-IPS:type": "fixed", "OS-EXT-IPS-MAC:mac_addr": "fa:16:3e:00:00:01"}
+		],
+		"local-network": [
+			{"version": 4, "addr": "192.168.0.10", "OS-EXT-IPS:type": "fixed", "OS-EXT-IPS-MAC:mac_addr": "fa:16:3e:00:00:02"},
+			{"version": 4, "addr": "192.168.0.11", "OS-EXT-IPS:type": "fixed", "OS-EXT-IPS-MAC:mac_addr": "fa:16:3e:00:00:02"}
+		]
+	}}}`
+	var v GetServerResponse
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		t.Fatal(err)
+	}
+	a := v.Server.Addresses
+	if len(a["local-network"]) != 2 {
+		t.Errorf("addresses: %+v", a)
+	}
+	if a.PublicIPv4() != netip.MustParseAddr("203.0.113.5") {
+		t.Errorf("public ipv4: %v", a.PublicIPv4())
+	}
+	if a.PublicIPv6() != netip.MustParseAddr("2001:db8::5") {
+		t.Errorf("public ipv6: %v", a.PublicIPv6())
+	}
+	private := []netip.Addr{netip.MustParseAddr("192.168.0.10"), netip.MustParseAddr("192.168.0.11")}
+	if !slices.Equal(a.PrivateAddresses(), private) {
+		t.Errorf("private: %v", a.PrivateAddresses())
+	}
+	if !slices.Equal(a.MACs(), []string{"fa:16:3e:00:00:01", "fa:16:3e:00:00:02"}) {
+		t.Errorf("macs: %v", a.MACs())
+	}
+	if !a.Contains(netip.MustParseAddr("192.168.0.11")) || a.Contains(netip.MustParseAddr("192.168.0.12")) {
+		t.Error("contains")
+	}
+	if (ServerAddresses{}).PublicIPv4().IsValid() {
+		t.Error("public ipv4 of empty addresses")
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	for s, want := range map[string]bool{
+		"203.0.113.5":       true,
+		"2001:db8::5":       true,
+		"192.168.0.10":      false,
+		"10.0.0.1":          false,
+		"100.64.0.1":        false,
+		"100.127.255.254":   false,
+		"100.128.0.1":       true,
+		"::ffff:100.64.0.1": false,
+		"fd00::1":           false,
+		"fe80::1":           false,
+		"127.0.0.1":         false,
+	} {
+		if isPublicAddr(netip.MustParseAddr(s)) != want {
+			t.Errorf("%s: want %v", s, want)
+		}
+	}
+}
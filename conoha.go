@@ -1,10 +1,17 @@
 package conoha
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/url"
+	"strings"
 	"time"
+
+	"github.com/elfincafe/annette"
 )
 
 const (
@@ -73,16 +80,18 @@ func toJst(t time.Time) time.Time {
 }
 
 func toError(body []byte) error {
-	var v any
+	var v map[string]any
 	err := json.Unmarshal(body, &v)
 	if err != nil {
-		return nil
+		return fmt.Errorf(`Code:%d, Message:%s`, 0, strings.TrimSpace(string(body)))
 	}
 	code := 0
 	message := ""
-	for k1, v1 := range v.(map[string]any) {
+	unknown := ""
+	for k1, v1 := range v {
 		if k1 == "code" {
-			switch v1.(string) {
+			s, _ := v1.(string)
+			switch s {
 			case "InvalidParameter":
 				code = ErrInvalidParameter
 			case "NotInParentDomain":
@@ -90,12 +99,109 @@ func toError(body []byte) error {
 			case "RecordSetDuplicate":
 				code = ErrRecordSetDuplicate
 			default:
-				fmt.Printf(`Unknown Code: %s\n`, v1.(string))
-				fmt.Println(string(body))
+				// 未知のコードはメッセージに含める
+				unknown = fmt.Sprint(v1)
+			}
+		} else if k1 == "message" || k1 == "faultstring" {
+			message, _ = v1.(string)
+		} else if k1 == "NeutronError" {
+			if e, ok := v1.(map[string]any); ok {
+				message, _ = e["message"].(string)
 			}
-		} else if k1 == "message" {
-			message = v1.(string)
 		}
 	}
+	if unknown != "" {
+		message = unknown + ": " + message
+	}
 	return fmt.Errorf(`Code:%d, Message:%s`, code, message)
 }
+
+// HTTPステータスを保持するエラー
+type statusError struct {
+	StatusCode int
+	err        error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+func toStatusError(status int, body []byte) error {
+	return &statusError{StatusCode: status, err: toError(body)}
+}
+
+// 再試行で回復する可能性のあるエラー(通信エラーと5xx)
+func isRetryable(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.StatusCode >= 500
+	}
+	var ne net.Error
+	return errors.As(err, &ne) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// JSON以外のContent-Typeで送信するリクエストボディ
+type contentTyper interface {
+	contentType() string
+}
+
+// JSONのリクエストを送信し、レスポンスが status の場合は v に格納する
+// path はエスケープ済みのパスを指定する
+func (api *V3) request(base *url.URL, method, path string, query url.Values, req any, status int, v any) error {
+	if base == nil {
+		return fmt.Errorf(`endpoint is not set`)
+	}
+	endpoint := *base
+	unescaped, err := url.PathUnescape(path)
+	if err != nil {
+		return err
+	}
+	endpoint.Path = unescaped
+	endpoint.RawPath = path
+	endpoint.RawQuery = query.Encode()
+	client := annette.New(&endpoint)
+	client.Header.Set("Accept", "application/json")
+	client.Header.Set("X-Auth-Token", api.Token)
+	var body io.Reader
+	if req != nil {
+		b, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+		contentType := "application/json"
+		if c, ok := req.(contentTyper); ok {
+			contentType = c.contentType()
+		}
+		client.Header.Set("Content-Type", contentType)
+	}
+	var res *annette.Response
+	switch method {
+	case "GET":
+		res, err = client.Get()
+	case "POST":
+		res, err = client.Post(body)
+	case "PUT":
+		res, err = client.Put(body)
+	case "PATCH":
+		res, err = client.Patch(body)
+	case "DELETE":
+		res, err = client.Delete()
+	default:
+		return fmt.Errorf(`unsupported method %s`, method)
+	}
+	if err != nil {
+		return err
+	}
+	if res.StatusCode() != status {
+		return toStatusError(res.StatusCode(), res.Binary())
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(res.Binary(), v)
+}
@@ -1 +1,166 @@
 package conoha
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// テスト用のOpenStack形式のAPIサーバー
+// /{version}/.../{collection}/{id} の形式のパスを汎用的に扱う
+type resourceTestServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	objects  map[string]map[string]map[string]any
+	bodies   []map[string]any
+	get      func(collection string, obj map[string]any)
+	fail     func(r *http.Request) any // nil以外を返した場合はそれを400で返す
+	created  string
+	notFound func(message string) any
+}
+
+func newResourceTestServer(t *testing.T) *resourceTestServer {
+	s := &resourceTestServer{
+		objects: map[string]map[string]map[string]any{},
+		created: "2024-01-02T03:04:05Z",
+		notFound: func(message string) any {
+			return map[string]any{"message": message}
+		},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *resourceTestServer) object(collection, id string) map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.objects[collection][id]
+}
+
+func (s *resourceTestServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	write := func(status int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+	if s.fail != nil {
+		if v := s.fail(r); v != nil {
+			write(http.StatusBadRequest, v)
+			return
+		}
+	}
+	collection, id := r.URL.Path, ""
+	if _, err := uuid.Parse(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]); err == nil {
+		collection, id = r.URL.Path[:strings.LastIndex(r.URL.Path, "/")], r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	}
+	plural := strings.ReplaceAll(collection[strings.LastIndex(collection, "/")+1:], "-", "_")
+	singular := strings.TrimSuffix(plural, "s")
+	if s.objects[collection] == nil {
+		s.objects[collection] = map[string]map[string]any{}
+	}
+	objects := s.objects[collection]
+	obj, ok := objects[id]
+	if id != "" && !ok {
+		write(404, s.notFound(singular+" "+id+" could not be found."))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if id == "" {
+			list := []map[string]any{}
+		next:
+			for _, o := range objects {
+				// クエリパラメータは項目の値との完全一致で絞り込む
+				for k := range r.URL.Query() {
+					if fmt.Sprint(o[k]) != r.URL.Query().Get(k) {
+						continue next
+					}
+				}
+				if s.get != nil {
+					s.get(collection, o)
+				}
+				list = append(list, o)
+			}
+			write(200, map[string]any{plural: list})
+			return
+		}
+		if s.get != nil {
+			s.get(collection, obj)
+		}
+		write(200, map[string]any{singular: obj})
+	case http.MethodPost, http.MethodPut:
+		var body map[string]map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		s.bodies = append(s.bodies, body[singular])
+		status := 200
+		if r.Method == http.MethodPost {
+			status = 201
+			id = uuid.NewString()
+			obj = map[string]any{
+				"id":                  id,
+				"admin_state_up":      true,
+				"provisioning_status": "ACTIVE",
+				"operating_status":    "ONLINE",
+				"created_at":          s.created,
+				"updated_at":          nil,
+			}
+			objects[id] = obj
+		}
+		for k, v := range body[singular] {
+			obj[k] = v
+		}
+		write(status, map[string]any{singular: obj})
+	case http.MethodDelete:
+		delete(objects, id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestToError(t *testing.T) {
+	for body, want := range map[string]string{
+		`{"code": "RecordSetDuplicate", "message": "duplicate"}`:         "Code:2110, Message:duplicate",
+		`{"code": "Conflict", "message": "in use"}`:                      "Code:0, Message:Conflict: in use",
+		`{"faultstring": "Load Balancer is immutable"}`:                  "Code:0, Message:Load Balancer is immutable",
+		`{"NeutronError": {"type": "NotFound", "message": "not found"}}`: "Code:0, Message:not found",
+		`<html>Service Unavailable</html>`:                               "Code:0, Message:<html>Service Unavailable</html>",
+	} {
+		if err := toError([]byte(body)); err.Error() != want {
+			t.Errorf("%s: %v", body, err)
+		}
+	}
+}
+
+func TestRequestStatusError(t *testing.T) {
+	s := newResourceTestServer(t)
+	api := NewV3()
+	api.Endpoints.Network, _ = url.Parse(s.URL)
+	s.fail = func(r *http.Request) any {
+		return map[string]any{"message": "failed"}
+	}
+	err := api.request(api.Endpoints.Network, "GET", "/v2.0/networks", nil, nil, 200, nil)
+	var se *statusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusBadRequest || err.Error() != "Code:0, Message:failed" || isRetryable(err) {
+		t.Errorf("error: %v", err)
+	}
+	// 5xxは再試行できる
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	api.Endpoints.Network, _ = url.Parse(srv.URL)
+	err = api.request(api.Endpoints.Network, "GET", "/v2.0/networks", nil, nil, 200, nil)
+	if !errors.As(err, &se) || se.StatusCode != http.StatusServiceUnavailable || !isRetryable(err) {
+		t.Errorf("error: %v", err)
+	}
+}
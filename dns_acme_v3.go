@@ -0,0 +1,111 @@
+package conoha
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type (
+	// ACME DNS-01チャレンジ用のプロバイダ
+	// lego の challenge.Provider / challenge.ProviderTimeout を満たす
+	AcmeDnsProvider struct {
+		Ttl                int
+		PropagationTimeout time.Duration
+		PollingInterval    time.Duration
+		api                *V3
+		mu                 sync.Mutex
+		records            map[string]*acmeRecord
+	}
+	// 同じ名前と値のレコードは重複して作成できないため、使用数を数えて共有する
+	acmeRecord struct {
+		domainId uuid.UUID
+		recordId uuid.UUID
+		refs     int
+	}
+)
+
+func NewAcmeDnsProvider(api *V3) *AcmeDnsProvider {
+	return &AcmeDnsProvider{
+		Ttl:                MinRecordTtl,
+		PropagationTimeout: 5 * time.Minute,
+		PollingInterval:    10 * time.Second,
+		api:                api,
+		records:            map[string]*acmeRecord{},
+	}
+}
+
+// チャレンジ用のレコード名と値
+func acmeChallenge(domain, keyAuth string) (string, string) {
+	domain = strings.TrimPrefix(fqdn(domain), "*.")
+	h := sha256.Sum256([]byte(keyAuth))
+	return "_acme-challenge." + domain, base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+func (p *AcmeDnsProvider) Present(domain, token, keyAuth string) error {
+	name, value := acmeChallenge(domain, keyAuth)
+	key := name + " " + value
+	// 作成中に同じチャレンジが来た場合に重複して作成しないようにロックしたまま作成する
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r, ok := p.records[key]; ok {
+		r.refs++
+		return nil
+	}
+	d, err := p.api.findDomain(name)
+	if err != nil {
+		return err
+	}
+	v, err := p.api.CreateRecordBySpec(d.Uuid, NewTXTRecord(name, value).WithTtl(p.Ttl))
+	if err != nil {
+		return err
+	}
+	p.records[key] = &acmeRecord{domainId: d.Uuid, recordId: v.Uuid, refs: 1}
+	return nil
+}
+
+func (p *AcmeDnsProvider) CleanUp(domain, token, keyAuth string) error {
+	name, value := acmeChallenge(domain, keyAuth)
+	key := name + " " + value
+	// 作成したレコードは最後のチャレンジが終わった時に削除する
+	p.mu.Lock()
+	r, ok := p.records[key]
+	if ok {
+		r.refs--
+		if r.refs > 0 {
+			p.mu.Unlock()
+			return nil
+		}
+		delete(p.records, key)
+	}
+	p.mu.Unlock()
+	if ok {
+		return p.api.DeleteRecord(r.domainId, r.recordId)
+	}
+	// 別のプロセスで作成されたレコードは名前と値で検索する
+	d, err := p.api.findDomain(name)
+	if err != nil {
+		return err
+	}
+	records, err := p.api.getAllRecords(d.Uuid)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if r.Type == "TXT" && strings.EqualFold(fqdn(r.Name), name) && normalizeData("TXT", r.Data) == value {
+			err = p.api.DeleteRecord(d.Uuid, r.Uuid)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *AcmeDnsProvider) Timeout() (time.Duration, time.Duration) {
+	return p.PropagationTimeout, p.PollingInterval
+}
@@ -0,0 +1,99 @@
+package conoha
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestAcmeChallenge(t *testing.T) {
+	name, value := acmeChallenge("*.www.example.org", "token.thumbprint")
+	if name != "_acme-challenge.www.example.org." {
+		t.Errorf("name: %s", name)
+	}
+	if value != "61rBZ_4knHblO0MNoxFsXZ_eTFUHum0B6IVRbhvUn5I" {
+		t.Errorf("value: %s", value)
+	}
+}
+
+func TestAcmeDnsProvider(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	s.addDomain("example.com")
+	s.addDomain("sub.example.com")
+	p := NewAcmeDnsProvider(api)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			domain := "sub.example.com"
+			if i%2 == 1 {
+				domain = "*.sub.example.com"
+			}
+			if err := p.Present(domain, "token", fmt.Sprintf("key%d", i)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	records := s.find("_acme-challenge.sub.example.com", "TXT")
+	if len(records) != 4 {
+		t.Fatalf("records: %v", records)
+	}
+	if records[0].Ttl != MinRecordTtl {
+		t.Errorf("Ttl: %d", records[0].Ttl)
+	}
+
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := p.CleanUp("sub.example.com", "token", fmt.Sprintf("key%d", i)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if records := s.find("_acme-challenge.sub.example.com", "TXT"); len(records) != 1 {
+		t.Fatalf("records: %v", records)
+	}
+
+	// 記録のないレコードは検索して削除する
+	if err := NewAcmeDnsProvider(api).CleanUp("sub.example.com", "token", "key3"); err != nil {
+		t.Fatal(err)
+	}
+	if records := s.find("_acme-challenge.sub.example.com", "TXT"); len(records) != 0 {
+		t.Fatalf("records: %v", records)
+	}
+}
+
+func TestAcmeDnsProviderSameChallenge(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	s.addDomain("example.com")
+	p := NewAcmeDnsProvider(api)
+
+	// 同じチャレンジを並行して作成してもレコードは1つで、最後のチャレンジが終わった時に削除する
+	wg := sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.Present("example.com", "token", "key"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if records := s.find("_acme-challenge.example.com", "TXT"); len(records) != 1 {
+		t.Fatalf("records: %v", records)
+	}
+	for i := 2; i >= 0; i-- {
+		if err := p.CleanUp("example.com", "token", "key"); err != nil {
+			t.Fatal(err)
+		}
+		if records := s.find("_acme-challenge.example.com", "TXT"); len(records) != min(i, 1) {
+			t.Fatalf("records: %v", records)
+		}
+	}
+}
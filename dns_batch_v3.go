@@ -0,0 +1,246 @@
+package conoha
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+const (
+	RecordCreate RecordChangeAction = "create"
+	RecordUpdate RecordChangeAction = "update"
+	RecordDelete RecordChangeAction = "delete"
+
+	RecordChangeApplied        RecordChangeStatus = "applied"
+	RecordChangeFailed         RecordChangeStatus = "failed"
+	RecordChangeSkipped        RecordChangeStatus = "skipped"
+	RecordChangeRolledBack     RecordChangeStatus = "rolled_back"
+	RecordChangeRollbackFailed RecordChangeStatus = "rollback_failed"
+)
+
+type (
+	RecordChangeAction string
+	RecordChangeStatus string
+	RecordChange       struct {
+		Action  RecordChangeAction
+		Current *Record     // 更新・削除するレコード(ロールバックに使用する変更前の状態)
+		Desired *RecordSpec // 作成・更新後のレコード
+	}
+	// ドメイン単位の一括変更
+	RecordChangeSet struct {
+		DomainId    uuid.UUID
+		Changes     []RecordChange
+		Concurrency int // 同時実行数(デフォルト4)
+	}
+	RecordChangeResult struct {
+		Change        RecordChange
+		Status        RecordChangeStatus
+		Record        *Record // 作成・更新後、またはロールバックで再作成したレコード
+		Error         error
+		RollbackError error
+	}
+	RecordChangeReport struct {
+		DomainId   uuid.UUID
+		Results    []RecordChangeResult
+		RolledBack bool
+	}
+)
+
+func NewRecordChangeSet(domainId uuid.UUID) *RecordChangeSet {
+	return &RecordChangeSet{DomainId: domainId, Changes: []RecordChange{}, Concurrency: 4}
+}
+
+func (cs *RecordChangeSet) Create(spec *RecordSpec) *RecordChangeSet {
+	cs.Changes = append(cs.Changes, RecordChange{Action: RecordCreate, Desired: spec})
+	return cs
+}
+
+func (cs *RecordChangeSet) Update(current Record, spec *RecordSpec) *RecordChangeSet {
+	cs.Changes = append(cs.Changes, RecordChange{Action: RecordUpdate, Current: &current, Desired: spec})
+	return cs
+}
+
+func (cs *RecordChangeSet) Delete(current Record) *RecordChangeSet {
+	cs.Changes = append(cs.Changes, RecordChange{Action: RecordDelete, Current: &current})
+	return cs
+}
+
+// 変更計画を一括変更に変換する
+func (p *ZonePlan) ChangeSet() *RecordChangeSet {
+	cs := NewRecordChangeSet(p.DomainId)
+	for _, u := range p.Updates {
+		cs.Update(u.Current, &u.Desired)
+	}
+	for _, s := range p.Creates {
+		cs.Create(&s)
+	}
+	for _, r := range p.Deletes {
+		cs.Delete(r)
+	}
+	return cs
+}
+
+func (cs *RecordChangeSet) Validate() error {
+	errs := []error{}
+	for k, c := range cs.Changes {
+		switch c.Action {
+		case RecordCreate, RecordUpdate, RecordDelete:
+		default:
+			errs = append(errs, fmt.Errorf(`change %d: unknown action "%s"`, k, c.Action))
+			continue
+		}
+		if c.Action != RecordCreate && c.Current == nil {
+			errs = append(errs, fmt.Errorf(`change %d: %s requires the current record`, k, c.Action))
+		}
+		if c.Action != RecordDelete {
+			if c.Desired == nil {
+				errs = append(errs, fmt.Errorf(`change %d: %s requires the desired record`, k, c.Action))
+			} else if err := c.Desired.Validate(); err != nil {
+				errs = append(errs, fmt.Errorf(`change %d: %w`, k, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (report *RecordChangeReport) String() string {
+	s := ""
+	for _, r := range report.Results {
+		name, typ := "", ""
+		if r.Change.Current != nil {
+			name, typ = r.Change.Current.Name, r.Change.Current.Type
+		} else if r.Change.Desired != nil {
+			name, typ = r.Change.Desired.Name, r.Change.Desired.Type
+		}
+		s += fmt.Sprintf("%-15s %-6s %s %s", r.Status, r.Change.Action, fqdn(name), typ)
+		if r.Error != nil {
+			s += fmt.Sprintf(" (%s)", r.Error)
+		}
+		if r.RollbackError != nil {
+			s += fmt.Sprintf(" (rollback: %s)", r.RollbackError)
+		}
+		s += "\n"
+	}
+	return s
+}
+
+// 1件の変更を適用する
+func (api *V3) applyRecordChange(domainId uuid.UUID, c *RecordChange) (*Record, error) {
+	switch c.Action {
+	case RecordCreate:
+		v, err := api.CreateRecordBySpec(domainId, c.Desired)
+		if err != nil {
+			return nil, err
+		}
+		return (*Record)(v), nil
+	case RecordUpdate:
+		v, err := api.UpdateRecordBySpec(domainId, c.Current.Uuid, c.Desired)
+		if err != nil {
+			return nil, err
+		}
+		return (*Record)(v), nil
+	default:
+		return nil, api.DeleteRecord(domainId, c.Current.Uuid)
+	}
+}
+
+// 適用済みの変更を元に戻す
+func (api *V3) revertRecordChange(domainId uuid.UUID, r *RecordChangeResult) error {
+	switch r.Change.Action {
+	case RecordCreate:
+		return api.DeleteRecord(domainId, r.Record.Uuid)
+	case RecordUpdate:
+		_, err := api.updateRecord(domainId, r.Change.Current.Uuid, r.Change.Current.request())
+		return err
+	default:
+		// 削除したレコードは新しいIDで再作成される
+		v, err := api.createRecord(domainId, r.Change.Current.request())
+		if err != nil {
+			return err
+		}
+		r.Record = (*Record)(v)
+		return nil
+	}
+}
+
+// 同時実行数を制限して fn を実行する
+func runLimited(n, concurrency int, fn func(k int)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for k := 0; k < n; k++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(k int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(k)
+		}(k)
+	}
+	wg.Wait()
+}
+
+// 一括変更を適用する
+// 失敗した場合は未実行の変更を中止し、適用済みの変更を変更前の状態に戻す
+func (api *V3) ApplyRecordChanges(cs *RecordChangeSet) (*RecordChangeReport, error) {
+	if err := cs.Validate(); err != nil {
+		return nil, err
+	}
+	report := &RecordChangeReport{DomainId: cs.DomainId, Results: make([]RecordChangeResult, len(cs.Changes))}
+	var failed atomic.Bool
+	runLimited(len(cs.Changes), cs.Concurrency, func(k int) {
+		r := &report.Results[k]
+		r.Change = cs.Changes[k]
+		if failed.Load() {
+			r.Status = RecordChangeSkipped
+			return
+		}
+		r.Record, r.Error = api.applyRecordChange(cs.DomainId, &r.Change)
+		if r.Error != nil {
+			r.Status = RecordChangeFailed
+			failed.Store(true)
+			return
+		}
+		r.Status = RecordChangeApplied
+	})
+	if !failed.Load() {
+		return report, nil
+	}
+
+	errs := []error{}
+	for _, r := range report.Results {
+		if r.Status == RecordChangeFailed {
+			errs = append(errs, r.Error)
+		}
+	}
+	applied := []int{}
+	for k, r := range report.Results {
+		if r.Status == RecordChangeApplied {
+			applied = append(applied, k)
+		}
+	}
+	report.RolledBack = true
+	runLimited(len(applied), cs.Concurrency, func(k int) {
+		r := &report.Results[applied[k]]
+		r.RollbackError = api.revertRecordChange(cs.DomainId, r)
+		if r.RollbackError != nil {
+			r.Status = RecordChangeRollbackFailed
+			return
+		}
+		r.Status = RecordChangeRolledBack
+	})
+	for _, r := range report.Results {
+		if r.Status == RecordChangeRollbackFailed {
+			report.RolledBack = false
+			errs = append(errs, fmt.Errorf(`rollback: %w`, r.RollbackError))
+		}
+	}
+	return report, errors.Join(errs...)
+}
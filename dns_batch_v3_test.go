@@ -0,0 +1,111 @@
+package conoha
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestApplyRecordChanges(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	d := s.addDomain("example.com")
+	cs := NewRecordChangeSet(d.Uuid)
+	for i := 0; i < 20; i++ {
+		cs.Create(NewARecord(fmt.Sprintf("host%d.example.com", i), "203.0.113.1"))
+	}
+	report, err := api.ApplyRecordChanges(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range report.Results {
+		if r.Status != RecordChangeApplied || r.Record == nil {
+			t.Errorf("result: %+v", r)
+		}
+	}
+	if report.RolledBack || s.count(http.MethodPost) != 20 {
+		t.Errorf("rolled back: %v, POST: %d", report.RolledBack, s.count(http.MethodPost))
+	}
+
+	cs = &RecordChangeSet{}
+	cs.Update(Record{}, nil)
+	if _, err := api.ApplyRecordChanges(cs); err == nil {
+		t.Error("invalid change set is applied")
+	}
+}
+
+func TestApplyRecordChangesRollback(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	d := s.addDomain("example.com")
+	www := s.addRecord(d, Record{Name: "www.example.com", Type: "A", Data: "203.0.113.5", Ttl: 300})
+	old := s.addRecord(d, Record{Name: "old.example.com", Type: "CNAME", Data: "www.example.com.", Ttl: 300})
+	host := s.addRecord(d, Record{Name: "api.example.com", Type: "A", Data: "203.0.113.7", Ttl: 300})
+	s.fail = func(r *http.Request) bool {
+		return r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, host.Uuid.String())
+	}
+
+	cs := NewRecordChangeSet(d.Uuid).
+		Create(NewTXTRecord("example.com", "v=spf1 -all")).
+		Update(*www, NewARecord("www.example.com", "203.0.113.8").WithTtl(300)).
+		Delete(*old).
+		Update(*host, NewARecord("api.example.com", "203.0.113.9")).
+		Create(NewARecord("new.example.com", "203.0.113.10"))
+	cs.Concurrency = 1
+	report, err := api.ApplyRecordChanges(cs)
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if !report.RolledBack {
+		t.Errorf("not rolled back:\n%s", report)
+	}
+	statuses := []RecordChangeStatus{}
+	for _, r := range report.Results {
+		statuses = append(statuses, r.Status)
+	}
+	want := []RecordChangeStatus{RecordChangeRolledBack, RecordChangeRolledBack, RecordChangeRolledBack, RecordChangeFailed, RecordChangeSkipped}
+	if fmt.Sprint(statuses) != fmt.Sprint(want) {
+		t.Errorf("statuses: %v", statuses)
+	}
+	if v := s.find("example.com", "TXT"); len(v) != 0 {
+		t.Errorf("TXT: %v", v)
+	}
+	if v := s.find("www.example.com", "A"); len(v) != 1 || v[0].Data != "203.0.113.5" {
+		t.Errorf("www: %v", v)
+	}
+	if v := s.find("old.example.com", "CNAME"); len(v) != 1 || v[0].Data != "www.example.com." || v[0].Ttl != 300 {
+		t.Errorf("old: %v", v)
+	}
+	if v := s.find("new.example.com", "A"); len(v) != 0 {
+		t.Errorf("new: %v", v)
+	}
+	if !strings.Contains(report.String(), "failed          update api.example.com. A") {
+		t.Errorf("report:\n%s", report)
+	}
+}
+
+func TestApplyRecordChangesRollbackInvalid(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	d := s.addDomain("example.com")
+	// 現在の検証では受け付けないレコードも元の内容に戻す
+	legacy := s.addRecord(d, Record{Name: "legacy.example.com", Type: "A", Data: "203.0.113.5", Ttl: 30})
+	s.fail = func(r *http.Request) bool {
+		return r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/records")
+	}
+	if err := legacy.spec().Validate(); err == nil {
+		t.Fatal("legacy record is valid")
+	}
+	cs := NewRecordChangeSet(d.Uuid).
+		Update(*legacy, NewARecord("legacy.example.com", "203.0.113.6").WithTtl(300)).
+		Create(NewARecord("new.example.com", "203.0.113.10"))
+	cs.Concurrency = 1
+	report, err := api.ApplyRecordChanges(cs)
+	if err == nil || !report.RolledBack {
+		t.Fatalf("report:\n%s", report)
+	}
+	if report.Results[0].Status != RecordChangeRolledBack || report.Results[0].RollbackError != nil {
+		t.Errorf("rollback: %v", report.Results[0].RollbackError)
+	}
+	if v := s.find("legacy.example.com", "A"); len(v) != 1 || v[0].Data != "203.0.113.5" || v[0].Ttl != 30 {
+		t.Errorf("legacy: %v", v)
+	}
+}
@@ -0,0 +1,309 @@
+package conoha
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// 公開IPアドレスの取得元
+	IpSource interface {
+		Lookup(ctx context.Context) ([]netip.Addr, error)
+	}
+	// レスポンスボディにIPアドレスを返すURL(https://api.ipify.org など)
+	UrlIpSource struct {
+		Url    string
+		Client *http.Client
+	}
+	// ネットワークインターフェースに割り当てられたIPアドレス
+	InterfaceIpSource struct {
+		Name string
+	}
+	// 標準出力にIPアドレスを出力するコマンド
+	CommandIpSource struct {
+		Name string
+		Args []string
+	}
+	DynamicDns struct {
+		Names      []string      // 更新するレコード名
+		Ipv4       IpSource      // nilの場合はAレコードを更新しない
+		Ipv6       IpSource      // nilの場合はAAAAレコードを更新しない
+		Ttl        int           // 0の場合はドメインのTTL
+		Interval   time.Duration // 確認間隔(デフォルト5分)
+		MaxBackoff time.Duration // エラー時の最大待ち時間(デフォルト1時間)
+		Recheck    time.Duration // 前回と同じアドレスでもレコードを確認する間隔(デフォルト1時間)
+		Prepare    func() error  // 確認の前に行う処理(トークンの再発行など)
+		OnUpdate   func(DynamicDnsUpdate)
+		OnError    func(error)
+		api        *V3
+		mu         sync.Mutex
+		applied    map[string]dynamicDnsApplied
+	}
+	dynamicDnsApplied struct {
+		addr    netip.Addr
+		checked time.Time
+	}
+	DynamicDnsUpdate struct {
+		Name    string
+		Type    string
+		Old     string
+		New     string
+		Changed bool
+	}
+)
+
+func NewDynamicDns(api *V3, names ...string) *DynamicDns {
+	return &DynamicDns{
+		Names:      names,
+		Interval:   5 * time.Minute,
+		MaxBackoff: time.Hour,
+		Recheck:    time.Hour,
+		api:        api,
+		applied:    map[string]dynamicDnsApplied{},
+	}
+}
+
+func (s *UrlIpSource) Lookup(ctx context.Context) ([]netip.Addr, error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1024))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(`%s: %s`, s.Url, res.Status)
+	}
+	return parseAddrs(string(body))
+}
+
+func (s *InterfaceIpSource) Lookup(ctx context.Context) ([]netip.Addr, error) {
+	iface, err := net.InterfaceByName(s.Name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	v := []netip.Addr{}
+	for _, a := range addrs {
+		prefix, err := netip.ParsePrefix(a.String())
+		if err != nil {
+			continue
+		}
+		if addr := prefix.Addr().Unmap(); isPublicAddr(addr) {
+			v = append(v, addr)
+		}
+	}
+	return v, nil
+}
+
+func (s *CommandIpSource) Lookup(ctx context.Context) ([]netip.Addr, error) {
+	out, err := exec.CommandContext(ctx, s.Name, s.Args...).Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseAddrs(string(out))
+}
+
+// 空白区切りのIPアドレスを解析する
+func parseAddrs(s string) ([]netip.Addr, error) {
+	v := []netip.Addr{}
+	for _, f := range strings.Fields(s) {
+		addr, err := netip.ParseAddr(f)
+		if err != nil {
+			return nil, fmt.Errorf(`invalid address "%s"`, f)
+		}
+		v = append(v, addr.Unmap())
+	}
+	if len(v) == 0 {
+		return nil, errors.New(`no address`)
+	}
+	return v, nil
+}
+
+func lookupAddr(ctx context.Context, source IpSource, v6 bool) (netip.Addr, error) {
+	addrs, err := source.Lookup(ctx)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	// プライベートアドレスやCGNATのアドレスは公開DNSに登録しない
+	for _, a := range addrs {
+		if a.Unmap().Is6() == v6 && isPublicAddr(a) {
+			return a.Unmap(), nil
+		}
+	}
+	if v6 {
+		return netip.Addr{}, errors.New(`no public IPv6 address`)
+	}
+	return netip.Addr{}, errors.New(`no public IPv4 address`)
+}
+
+// 1回だけ確認・更新する
+func (d *DynamicDns) RunOnce(ctx context.Context) ([]DynamicDnsUpdate, error) {
+	updates := []DynamicDnsUpdate{}
+	if d.Prepare != nil {
+		if err := d.Prepare(); err != nil {
+			return updates, err
+		}
+	}
+	errs := []error{}
+	for _, src := range []struct {
+		typ    string
+		source IpSource
+	}{{"A", d.Ipv4}, {"AAAA", d.Ipv6}} {
+		if src.source == nil {
+			continue
+		}
+		addr, err := lookupAddr(ctx, src.source, src.typ == "AAAA")
+		if err != nil {
+			errs = append(errs, fmt.Errorf(`%s: %w`, src.typ, err))
+			continue
+		}
+		for _, name := range d.Names {
+			if err := ctx.Err(); err != nil {
+				return updates, err
+			}
+			u, err := d.update(fqdn(name), src.typ, addr)
+			if err != nil {
+				errs = append(errs, fmt.Errorf(`%s %s: %w`, name, src.typ, err))
+				continue
+			}
+			updates = append(updates, *u)
+			if u.Changed && d.OnUpdate != nil {
+				d.OnUpdate(*u)
+			}
+		}
+	}
+	return updates, errors.Join(errs...)
+}
+
+// レコードの値が異なる場合のみ更新する
+// 同じ名前とタイプのレコードが複数ある場合は同じ値で登録できないため、1つだけ更新して残りは削除する
+func (d *DynamicDns) update(name, typ string, addr netip.Addr) (*DynamicDnsUpdate, error) {
+	key := recordKey(name, typ)
+	u := DynamicDnsUpdate{Name: name, Type: typ, New: addr.String()}
+	recheck := d.Recheck
+	if recheck <= 0 {
+		recheck = time.Hour
+	}
+	d.mu.Lock()
+	last, ok := d.applied[key]
+	d.mu.Unlock()
+	// 他から変更されている場合に備えて Recheck ごとに現在のレコードと比較する
+	if ok && last.addr == addr && time.Since(last.checked) < recheck {
+		u.Old = addr.String()
+		return &u, nil
+	}
+	domain, err := d.api.findDomain(name)
+	if err != nil {
+		return nil, err
+	}
+	records, err := d.api.getAllRecords(domain.Uuid)
+	if err != nil {
+		return nil, err
+	}
+	spec := &RecordSpec{Name: name, Type: typ, Data: addr.String(), Ttl: d.Ttl}
+	matches := []Record{}
+	olds := []string{}
+	for _, r := range records {
+		if recordKey(r.Name, r.Type) != key {
+			continue
+		}
+		matches = append(matches, r)
+		if !slices.Contains(olds, r.Data) {
+			olds = append(olds, r.Data)
+		}
+	}
+	if len(matches) == 0 {
+		_, err = d.api.CreateRecordBySpec(domain.Uuid, spec)
+		if err != nil {
+			return nil, err
+		}
+		u.Changed = true
+	} else {
+		// 既に同じ値のレコードがあればそれを残す
+		keep := slices.IndexFunc(matches, func(r Record) bool { return sameRecord(&r, spec) })
+		if keep < 0 {
+			keep = 0
+			_, err = d.api.UpdateRecordBySpec(domain.Uuid, matches[keep].Uuid, spec)
+			if err != nil {
+				return nil, err
+			}
+			u.Changed = true
+		}
+		for i, r := range matches {
+			if i == keep {
+				continue
+			}
+			err = d.api.DeleteRecord(domain.Uuid, r.Uuid)
+			if err != nil {
+				return nil, err
+			}
+			u.Changed = true
+		}
+	}
+	slices.Sort(olds)
+	u.Old = strings.Join(olds, ",")
+	d.mu.Lock()
+	d.applied[key] = dynamicDnsApplied{addr: addr, checked: time.Now()}
+	d.mu.Unlock()
+	return &u, nil
+}
+
+// ctx がキャンセルされるまで定期的に確認・更新する
+// エラーが続く場合は待ち時間を倍にする
+func (d *DynamicDns) Run(ctx context.Context) error {
+	interval := d.Interval
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	maxBackoff := d.MaxBackoff
+	if maxBackoff < interval {
+		maxBackoff = interval
+	}
+	wait := interval
+	for {
+		_, err := d.RunOnce(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			if d.OnError != nil {
+				d.OnError(err)
+			}
+			wait *= 2
+			if wait > maxBackoff {
+				wait = maxBackoff
+			}
+		} else {
+			wait = interval
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package conoha
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+type staticIpSource []netip.Addr
+
+func (s *staticIpSource) Lookup(ctx context.Context) ([]netip.Addr, error) {
+	return *s, nil
+}
+
+func TestParseAddrs(t *testing.T) {
+	addrs, err := parseAddrs("203.0.113.5\n2001:db8::5 ::ffff:198.51.100.1\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 3 || !addrs[2].Is4() {
+		t.Errorf("addrs: %v", addrs)
+	}
+	if _, err := parseAddrs("<html>"); err == nil {
+		t.Errorf("error expected")
+	}
+}
+
+func TestUrlIpSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "203.0.113.5")
+	}))
+	defer srv.Close()
+	addr, err := lookupAddr(context.Background(), &UrlIpSource{Url: srv.URL}, false)
+	if err != nil || addr.String() != "203.0.113.5" {
+		t.Errorf("addr: %s, err: %v", addr, err)
+	}
+	if _, err := lookupAddr(context.Background(), &UrlIpSource{Url: srv.URL}, true); err == nil {
+		t.Errorf("error expected")
+	}
+}
+
+func TestLookupPublicAddr(t *testing.T) {
+	// プライベートアドレスが先に返されても公開アドレスを使う
+	cmd := &CommandIpSource{Name: "echo", Args: []string{"192.168.0.10 100.64.0.1 fd00::1 203.0.113.5 2001:db8::5"}}
+	if addr, err := lookupAddr(context.Background(), cmd, false); err != nil || addr.String() != "203.0.113.5" {
+		t.Errorf("addr: %s, err: %v", addr, err)
+	}
+	if addr, err := lookupAddr(context.Background(), cmd, true); err != nil || addr.String() != "2001:db8::5" {
+		t.Errorf("addr: %s, err: %v", addr, err)
+	}
+	private := staticIpSource{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("100.127.0.1"), netip.MustParseAddr("fd12::1")}
+	if addr, err := lookupAddr(context.Background(), &private, false); err == nil {
+		t.Errorf("addr: %s", addr)
+	}
+	if addr, err := lookupAddr(context.Background(), &private, true); err == nil {
+		t.Errorf("addr: %s", addr)
+	}
+}
+
+func TestDynamicDnsRunOnce(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	d := s.addDomain("example.com")
+	s.addRecord(d, Record{Name: "office.example.com", Type: "A", Data: "203.0.113.5"})
+	v4 := staticIpSource{netip.MustParseAddr("203.0.113.5")}
+	v6 := staticIpSource{netip.MustParseAddr("fe80::1"), netip.MustParseAddr("2001:db8::5")}
+	ddns := NewDynamicDns(api, "office.example.com")
+	ddns.Ipv4 = &v4
+	ddns.Ipv6 = &v6
+	changed := 0
+	ddns.OnUpdate = func(u DynamicDnsUpdate) { changed++ }
+
+	// A は変更なし、AAAA は新規作成
+	updates, err := ddns.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 2 || updates[0].Changed || !updates[1].Changed || changed != 1 {
+		t.Errorf("updates: %v", updates)
+	}
+	if r := s.find("office.example.com", "AAAA"); len(r) != 1 || r[0].Data != "2001:db8::5" {
+		t.Errorf("AAAA: %v", r)
+	}
+
+	// 前回と同じアドレスの場合はAPIを呼び出さない
+	gets := s.count(http.MethodGet)
+	if _, err := ddns.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s.count(http.MethodGet) != gets {
+		t.Errorf("unexpected API calls")
+	}
+
+	v4[0] = netip.MustParseAddr("203.0.113.9")
+	updates, err = ddns.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updates[0].Changed || updates[0].Old != "203.0.113.5" || updates[0].New != "203.0.113.9" {
+		t.Errorf("updates: %v", updates)
+	}
+	if r := s.find("office.example.com", "A"); len(r) != 1 || r[0].Data != "203.0.113.9" {
+		t.Errorf("A: %v", r)
+	}
+}
+
+func TestDynamicDnsRecheck(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	d := s.addDomain("example.com")
+	s.addRecord(d, Record{Name: "office.example.com", Type: "A", Data: "203.0.113.5"})
+	s.addRecord(d, Record{Name: "office.example.com", Type: "A", Data: "203.0.113.6"})
+	v4 := staticIpSource{netip.MustParseAddr("203.0.113.9")}
+	ddns := NewDynamicDns(api, "office.example.com")
+	ddns.Ipv4 = &v4
+
+	// 同じ名前のレコードは1つだけ更新して残りは削除する
+	updates, err := ddns.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 1 || !updates[0].Changed || updates[0].Old != "203.0.113.5,203.0.113.6" {
+		t.Errorf("updates: %v", updates)
+	}
+	if r := s.find("office.example.com", "A"); len(r) != 1 || r[0].Data != "203.0.113.9" {
+		t.Errorf("A: %v", r)
+	}
+
+	// 他から変更された場合は Recheck の間隔が過ぎると元に戻す
+	for _, r := range s.find("office.example.com", "A") {
+		s.mu.Lock()
+		s.records[r.Uuid].Data = "198.51.100.1"
+		s.mu.Unlock()
+	}
+	if updates, _ := ddns.RunOnce(context.Background()); updates[0].Changed {
+		t.Errorf("updates: %v", updates)
+	}
+	ddns.Recheck = time.Nanosecond
+	updates, err = ddns.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updates[0].Changed || updates[0].Old != "198.51.100.1" {
+		t.Errorf("updates: %v", updates)
+	}
+	if r := s.find("office.example.com", "A"); len(r) != 1 || r[0].Data != "203.0.113.9" {
+		t.Errorf("A: %v", r)
+	}
+
+	// 既に新しい値のレコードがある場合はそれを残して他を削除する
+	s.addRecord(d, Record{Name: "office.example.com", Type: "A", Data: "198.51.100.2"})
+	updates, err = ddns.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updates[0].Changed || updates[0].Old != "198.51.100.2,203.0.113.9" {
+		t.Errorf("updates: %v", updates)
+	}
+	if r := s.find("office.example.com", "A"); len(r) != 1 || r[0].Data != "203.0.113.9" {
+		t.Errorf("A: %v", r)
+	}
+	if n := s.count(http.MethodPut); n != 2 {
+		t.Errorf("updates: %d", n)
+	}
+}
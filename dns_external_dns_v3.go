@@ -0,0 +1,442 @@
+package conoha
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const externalDnsMediaType = "application/external.dns.webhook+json;version=1"
+
+type (
+	// external-dns の webhook プロバイダ
+	// TXTレジストリ(所有者ID)のTXTレコードも通常のTXTレコードとして保存・返却する
+	ExternalDnsWebhook struct {
+		DomainFilter   []string // 対象とするドメイン(空の場合は全て)
+		ExcludeDomains []string // 対象外とするドメイン
+		OwnerId        string   // external-dns の --txt-owner-id (空の場合は所有者を確認しない)
+		TxtPrefix      string   // external-dns の --txt-prefix
+		TxtSuffix      string   // external-dns の --txt-suffix
+		api            *V3
+	}
+	ExternalDnsEndpoint struct {
+		DnsName          string                        `json:"dnsName"`
+		Targets          []string                      `json:"targets"`
+		RecordType       string                        `json:"recordType"`
+		SetIdentifier    string                        `json:"setIdentifier,omitempty"`
+		RecordTtl        int64                         `json:"recordTTL,omitempty"`
+		Labels           map[string]string             `json:"labels,omitempty"`
+		ProviderSpecific []ExternalDnsProviderSpecific `json:"providerSpecific,omitempty"`
+	}
+	ExternalDnsProviderSpecific struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	ExternalDnsChanges struct {
+		Create    []*ExternalDnsEndpoint `json:"Create,omitempty"`
+		UpdateOld []*ExternalDnsEndpoint `json:"UpdateOld,omitempty"`
+		UpdateNew []*ExternalDnsEndpoint `json:"UpdateNew,omitempty"`
+		Delete    []*ExternalDnsEndpoint `json:"Delete,omitempty"`
+	}
+	externalDnsDomainFilter struct {
+		Include []string `json:"include,omitempty"`
+		Exclude []string `json:"exclude,omitempty"`
+	}
+)
+
+func NewExternalDnsWebhook(api *V3, domainFilter, excludeDomains []string) *ExternalDnsWebhook {
+	return &ExternalDnsWebhook{
+		DomainFilter:   domainFilter,
+		ExcludeDomains: excludeDomains,
+		api:            api,
+	}
+}
+
+func (h *ExternalDnsWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/" && r.Method == http.MethodGet:
+		h.negotiate(w, r)
+	case r.URL.Path == "/records" && r.Method == http.MethodGet:
+		h.getRecords(w, r)
+	case r.URL.Path == "/records" && r.Method == http.MethodPost:
+		h.applyChanges(w, r)
+	case r.URL.Path == "/adjustendpoints" && r.Method == http.MethodPost:
+		h.adjustEndpoints(w, r)
+	case r.URL.Path == "/healthz":
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *ExternalDnsWebhook) write(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", externalDnsMediaType)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (h *ExternalDnsWebhook) error(w http.ResponseWriter, status int, err error) {
+	http.Error(w, err.Error(), status)
+}
+
+func (h *ExternalDnsWebhook) negotiate(w http.ResponseWriter, r *http.Request) {
+	h.write(w, externalDnsDomainFilter{Include: h.DomainFilter, Exclude: h.ExcludeDomains})
+}
+
+// ドメインフィルタに一致するか
+func (h *ExternalDnsWebhook) match(name string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	suffix := func(domain string) bool {
+		domain = strings.ToLower(strings.Trim(domain, "."))
+		return name == domain || strings.HasSuffix(name, "."+domain)
+	}
+	for _, d := range h.ExcludeDomains {
+		if suffix(d) {
+			return false
+		}
+	}
+	if len(h.DomainFilter) == 0 {
+		return true
+	}
+	for _, d := range h.DomainFilter {
+		if suffix(d) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *ExternalDnsWebhook) domains() ([]Domain, error) {
+	domains, err := h.api.getAllDomains()
+	if err != nil {
+		return nil, err
+	}
+	v := []Domain{}
+	for _, d := range domains {
+		if h.match(d.Name) {
+			v = append(v, d)
+		}
+	}
+	return v, nil
+}
+
+func (h *ExternalDnsWebhook) getRecords(w http.ResponseWriter, r *http.Request) {
+	domains, err := h.domains()
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err)
+		return
+	}
+	endpoints := []*ExternalDnsEndpoint{}
+	for _, d := range domains {
+		records, err := h.api.getAllRecords(d.Uuid)
+		if err != nil {
+			h.error(w, http.StatusInternalServerError, err)
+			return
+		}
+		endpoints = append(endpoints, toExternalDnsEndpoints(records, fqdn(d.Name))...)
+	}
+	h.write(w, endpoints)
+}
+
+// 名前とタイプが同じレコードを1つのエンドポイントにまとめる
+func toExternalDnsEndpoints(records []Record, origin string) []*ExternalDnsEndpoint {
+	endpoints := map[string]*ExternalDnsEndpoint{}
+	keys := []string{}
+	for _, r := range records {
+		if managedByConoha(r.Name, r.Type, origin) {
+			continue
+		}
+		k := recordKey(r.Name, r.Type)
+		e, ok := endpoints[k]
+		if !ok {
+			e = &ExternalDnsEndpoint{
+				DnsName:    strings.TrimSuffix(strings.ToLower(fqdn(r.Name)), "."),
+				RecordType: r.Type,
+				RecordTtl:  int64(r.Ttl),
+				Targets:    []string{},
+			}
+			endpoints[k] = e
+			keys = append(keys, k)
+		}
+		target := rdata(r.Type, r.Data, r.Priority, r.Weight, r.Port)
+		switch r.Type {
+		case "CNAME", "NS", "MX", "SRV", "PTR":
+			target = strings.TrimSuffix(target, ".")
+		}
+		e.Targets = append(e.Targets, target)
+	}
+	sort.Strings(keys)
+	v := []*ExternalDnsEndpoint{}
+	for _, k := range keys {
+		sort.Strings(endpoints[k].Targets)
+		v = append(v, endpoints[k])
+	}
+	return v
+}
+
+// エンドポイントをレコードに変換する
+func (e *ExternalDnsEndpoint) specs() ([]RecordSpec, error) {
+	name := fqdn(e.DnsName)
+	typ := strings.ToUpper(e.RecordType)
+	if !zoneSupportedTypes[typ] {
+		return nil, fmt.Errorf(`unsupported type %s`, e.RecordType)
+	}
+	specs := []RecordSpec{}
+	for _, t := range e.Targets {
+		fields := strings.Fields(t)
+		if typ == "TXT" {
+			if strings.HasPrefix(t, `"`) {
+				fields = []string{t}
+			} else {
+				fields = []string{quoteTxt(t)}
+			}
+		}
+		spec, err := zoneRecordSpec(name, typ, fields, "")
+		if err != nil {
+			return nil, err
+		}
+		spec.Ttl = int(e.RecordTtl)
+		if err := spec.Validate(); err != nil {
+			return nil, err
+		}
+		specs = append(specs, *spec)
+	}
+	return specs, nil
+}
+
+func (h *ExternalDnsWebhook) adjustEndpoints(w http.ResponseWriter, r *http.Request) {
+	var endpoints []*ExternalDnsEndpoint
+	err := json.NewDecoder(r.Body).Decode(&endpoints)
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	for _, e := range endpoints {
+		// ConoHa DNSの最小TTLに合わせる
+		if e.RecordTtl > 0 && e.RecordTtl < MinRecordTtl {
+			e.RecordTtl = MinRecordTtl
+		}
+		e.DnsName = strings.ToLower(strings.TrimSuffix(e.DnsName, "."))
+	}
+	h.write(w, endpoints)
+}
+
+func (h *ExternalDnsWebhook) applyChanges(w http.ResponseWriter, r *http.Request) {
+	var changes ExternalDnsChanges
+	err := json.NewDecoder(r.Body).Decode(&changes)
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	err = h.apply(&changes)
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ExternalDnsWebhook) apply(changes *ExternalDnsChanges) error {
+	domains, err := h.domains()
+	if err != nil {
+		return err
+	}
+	// ドメインごとに変更をまとめる
+	type zoneChanges struct {
+		domain  Domain
+		records []Record
+		creates []RecordSpec
+		olds    []RecordSpec
+		updates []RecordSpec
+		deletes []RecordSpec
+	}
+	zones := map[uuid.UUID]*zoneChanges{}
+	order := []*zoneChanges{}
+	add := func(endpoints []*ExternalDnsEndpoint, kind string) error {
+		for _, e := range endpoints {
+			if !h.match(e.DnsName) {
+				continue
+			}
+			d, err := matchDomain(domains, e.DnsName)
+			if err != nil {
+				return err
+			}
+			specs, err := e.specs()
+			if err != nil {
+				return err
+			}
+			z, ok := zones[d.Uuid]
+			if !ok {
+				z = &zoneChanges{domain: *d}
+				zones[d.Uuid] = z
+				order = append(order, z)
+			}
+			switch kind {
+			case "create":
+				z.creates = append(z.creates, specs...)
+			case "old":
+				z.olds = append(z.olds, specs...)
+			case "update":
+				z.updates = append(z.updates, specs...)
+			case "delete":
+				z.deletes = append(z.deletes, specs...)
+			}
+		}
+		return nil
+	}
+	if err := add(changes.Create, "create"); err != nil {
+		return err
+	}
+	if err := add(changes.UpdateOld, "old"); err != nil {
+		return err
+	}
+	if err := add(changes.UpdateNew, "update"); err != nil {
+		return err
+	}
+	if err := add(changes.Delete, "delete"); err != nil {
+		return err
+	}
+
+	// 変更する前に全てのドメインで所有者を確認する
+	errs := []error{}
+	for _, z := range order {
+		z.records, err = h.api.getAllRecords(z.domain.Uuid)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, specs := range [][]RecordSpec{z.creates, z.olds, z.updates, z.deletes} {
+			for _, s := range specs {
+				if err := h.checkOwner(z.records, &s); err != nil {
+					errs = append(errs, fmt.Errorf(`%s: %w`, z.domain.Name, err))
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	for _, z := range order {
+		// 更新は名前・タイプ単位でエンドポイントの内容に置き換える
+		plan, err := PlanZone(z.domain.Name, z.records, z.updates, &ZoneSyncOptions{IgnoreUnmanaged: true})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		plan.DomainId = z.domain.Uuid
+		plan.Creates = append(plan.Creates, z.creates...)
+		used := map[uuid.UUID]bool{}
+		for _, u := range plan.Updates {
+			used[u.Current.Uuid] = true
+		}
+		for _, r := range plan.Deletes {
+			used[r.Uuid] = true
+		}
+		// UpdateOld にあって UpdateNew にない値と、Delete の値を削除する
+		stale := []RecordSpec{}
+		for _, o := range z.olds {
+			if !containsSpec(z.updates, &o) {
+				stale = append(stale, o)
+			}
+		}
+		for _, s := range append(stale, z.deletes...) {
+			for _, r := range z.records {
+				if !used[r.Uuid] && recordKey(r.Name, r.Type) == recordKey(s.Name, s.Type) && sameData(&r, &s) {
+					plan.Deletes = append(plan.Deletes, r)
+					used[r.Uuid] = true
+				}
+			}
+		}
+		_, err = h.api.ApplyZonePlan(plan)
+		if err != nil {
+			errs = append(errs, fmt.Errorf(`%s: %w`, z.domain.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func containsSpec(specs []RecordSpec, s *RecordSpec) bool {
+	r := Record{Type: strings.ToUpper(s.Type), Data: s.Data, Priority: s.Priority, Weight: s.Weight, Port: s.Port}
+	for _, v := range specs {
+		if recordKey(v.Name, v.Type) == recordKey(s.Name, s.Type) && sameData(&r, &v) {
+			return true
+		}
+	}
+	return false
+}
+
+// 既存のレコードを変更する場合は OwnerId の所有者TXTレコードがあることを確認する
+func (h *ExternalDnsWebhook) checkOwner(records []Record, s *RecordSpec) error {
+	if h.OwnerId == "" {
+		return nil
+	}
+	k := recordKey(s.Name, s.Type)
+	exists := false
+	for _, r := range records {
+		if recordKey(r.Name, r.Type) == k {
+			exists = true
+			break
+		}
+	}
+	if !exists {
+		return nil
+	}
+	names := map[string]bool{}
+	if strings.EqualFold(s.Type, "TXT") {
+		// 所有者TXTレコード自体
+		names[strings.ToLower(fqdn(s.Name))] = true
+	}
+	for _, n := range h.registryNames(s.Name, s.Type) {
+		names[n] = true
+	}
+	for _, r := range records {
+		if r.Type == "TXT" && names[strings.ToLower(fqdn(r.Name))] && h.ownedBy(&r) {
+			return nil
+		}
+	}
+	return fmt.Errorf(`%s %s is not owned by %s`, strings.TrimSuffix(fqdn(s.Name), "."), strings.ToUpper(s.Type), h.OwnerId)
+}
+
+// external-dns のTXTレジストリのレコード名(新旧の形式)
+func (h *ExternalDnsWebhook) registryNames(name, typ string) []string {
+	typ = strings.ToLower(typ)
+	label, rest, _ := strings.Cut(strings.ToLower(strings.TrimSuffix(fqdn(name), ".")), ".")
+	prefix := strings.ReplaceAll(h.TxtPrefix, "%{record_type}", typ)
+	suffix := strings.ReplaceAll(h.TxtSuffix, "%{record_type}", typ)
+	join := func(label string) string {
+		if rest == "" {
+			return fqdn(prefix + label + suffix)
+		}
+		return fqdn(prefix + label + suffix + "." + rest)
+	}
+	names := []string{join(label)}
+	if !strings.Contains(h.TxtPrefix+h.TxtSuffix, "%{record_type}") {
+		names = append(names, join(typ+"-"+label))
+	}
+	return names
+}
+
+// 所有者TXTレコードの内容が OwnerId のものか
+func (h *ExternalDnsWebhook) ownedBy(r *Record) bool {
+	chunks, err := unquoteTxt(r.Data)
+	if err != nil {
+		return false
+	}
+	heritage, owner := false, false
+	for _, f := range strings.Split(strings.Join(chunks, ""), ",") {
+		switch strings.TrimSpace(f) {
+		case "heritage=external-dns":
+			heritage = true
+		case "external-dns/owner=" + h.OwnerId:
+			owner = true
+		}
+	}
+	return heritage && owner
+}
@@ -0,0 +1,142 @@
+package conoha
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExternalDnsWebhook(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	d := s.addDomain("example.com")
+	s.addDomain("internal.example.com")
+	s.addDomain("example.net")
+	s.addRecord(d, Record{Name: "www.example.com", Type: "A", Data: "203.0.113.5", Ttl: 300})
+	s.addRecord(d, Record{Name: "www.example.com", Type: "A", Data: "203.0.113.6", Ttl: 300})
+	s.addRecord(d, Record{Name: "a-www.example.com", Type: "TXT", Data: `"heritage=external-dns,external-dns/owner=default,external-dns/resource=ingress/default/www"`, Ttl: 300})
+	webhook := NewExternalDnsWebhook(api, []string{"example.com"}, []string{"internal.example.com"})
+	webhook.OwnerId = "default"
+	srv := httptest.NewServer(webhook)
+	defer srv.Close()
+
+	request := func(method, path string, body any, v any) int {
+		b, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewReader(b))
+		req.Header.Set("Accept", externalDnsMediaType)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if v != nil {
+			json.NewDecoder(res.Body).Decode(v)
+		}
+		return res.StatusCode
+	}
+
+	var filter externalDnsDomainFilter
+	if request(http.MethodGet, "/", nil, &filter) != 200 || len(filter.Include) != 1 || len(filter.Exclude) != 1 {
+		t.Errorf("negotiate: %v", filter)
+	}
+
+	var endpoints []ExternalDnsEndpoint
+	request(http.MethodGet, "/records", nil, &endpoints)
+	if len(endpoints) != 2 {
+		t.Fatalf("records: %v", endpoints)
+	}
+	if e := endpoints[1]; e.DnsName != "www.example.com" || e.RecordType != "A" || len(e.Targets) != 2 || e.RecordTtl != 300 {
+		t.Errorf("A: %+v", e)
+	}
+
+	var adjusted []ExternalDnsEndpoint
+	request(http.MethodPost, "/adjustendpoints", []ExternalDnsEndpoint{{DnsName: "API.example.com.", RecordType: "A", Targets: []string{"203.0.113.9"}, RecordTtl: 30}}, &adjusted)
+	if len(adjusted) != 1 || adjusted[0].DnsName != "api.example.com" || adjusted[0].RecordTtl != MinRecordTtl {
+		t.Errorf("adjustendpoints: %v", adjusted)
+	}
+
+	changes := ExternalDnsChanges{
+		Create: []*ExternalDnsEndpoint{
+			{DnsName: "api.example.com", RecordType: "A", Targets: []string{"203.0.113.9"}, RecordTtl: 300},
+			{DnsName: "a-api.example.com", RecordType: "TXT", Targets: []string{`"heritage=external-dns,external-dns/owner=default"`}},
+			{DnsName: "db.internal.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+		},
+		UpdateOld: []*ExternalDnsEndpoint{
+			{DnsName: "www.example.com", RecordType: "A", Targets: []string{"203.0.113.5", "203.0.113.6"}, RecordTtl: 300},
+		},
+		UpdateNew: []*ExternalDnsEndpoint{
+			{DnsName: "www.example.com", RecordType: "A", Targets: []string{"203.0.113.7"}, RecordTtl: 300},
+		},
+		Delete: []*ExternalDnsEndpoint{
+			{DnsName: "a-www.example.com", RecordType: "TXT", Targets: []string{`"heritage=external-dns,external-dns/owner=default,external-dns/resource=ingress/default/www"`}},
+		},
+	}
+	if status := request(http.MethodPost, "/records", changes, nil); status != http.StatusNoContent {
+		t.Fatalf("apply: %d", status)
+	}
+	if r := s.find("api.example.com", "A"); len(r) != 1 || r[0].Ttl != 300 {
+		t.Errorf("api: %v", r)
+	}
+	if r := s.find("a-api.example.com", "TXT"); len(r) != 1 || r[0].Data != `"heritage=external-dns,external-dns/owner=default"` {
+		t.Errorf("a-api: %v", r)
+	}
+	if r := s.find("db.internal.example.com", "A"); len(r) != 0 {
+		t.Errorf("excluded domain was changed: %v", r)
+	}
+	if r := s.find("www.example.com", "A"); len(r) != 1 || r[0].Data != "203.0.113.7" {
+		t.Errorf("www: %v", r)
+	}
+	if r := s.find("a-www.example.com", "TXT"); len(r) != 0 {
+		t.Errorf("a-www: %v", r)
+	}
+}
+
+func TestExternalDnsWebhookOwner(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	d := s.addDomain("example.com")
+	s.addRecord(d, Record{Name: "www.example.com", Type: "A", Data: "203.0.113.5", Ttl: 300})
+	s.addRecord(d, Record{Name: "www.example.com", Type: "A", Data: "203.0.113.6", Ttl: 300})
+	s.addRecord(d, Record{Name: "ext-a-www.example.com", Type: "TXT", Data: `"heritage=external-dns,external-dns/owner=cluster1"`})
+	s.addRecord(d, Record{Name: "mail.example.com", Type: "A", Data: "203.0.113.20"})
+	webhook := NewExternalDnsWebhook(api, nil, nil)
+	webhook.OwnerId = "cluster1"
+	webhook.TxtPrefix = "ext-"
+
+	// 所有者TXTレコードのない既存のレコードは変更しない
+	err := webhook.apply(&ExternalDnsChanges{
+		UpdateOld: []*ExternalDnsEndpoint{{DnsName: "www.example.com", RecordType: "A", Targets: []string{"203.0.113.5", "203.0.113.6"}}},
+		UpdateNew: []*ExternalDnsEndpoint{{DnsName: "www.example.com", RecordType: "A", Targets: []string{"203.0.113.7"}}},
+		Delete:    []*ExternalDnsEndpoint{{DnsName: "mail.example.com", RecordType: "A", Targets: []string{"203.0.113.20"}}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "mail.example.com A is not owned by cluster1") {
+		t.Errorf("error: %v", err)
+	}
+	if r := s.find("www.example.com", "A"); len(r) != 2 {
+		t.Errorf("www: %v", r)
+	}
+	if r := s.find("mail.example.com", "A"); len(r) != 1 {
+		t.Errorf("mail: %v", r)
+	}
+	webhook.OwnerId = "cluster2"
+	if err := webhook.apply(&ExternalDnsChanges{Create: []*ExternalDnsEndpoint{{DnsName: "www.example.com", RecordType: "A", Targets: []string{"203.0.113.8"}}}}); err == nil {
+		t.Error("record of other owner is changed")
+	}
+	webhook.OwnerId = "cluster1"
+
+	// UpdateOld にあって UpdateNew にない値は削除する
+	err = webhook.apply(&ExternalDnsChanges{
+		UpdateOld: []*ExternalDnsEndpoint{{DnsName: "www.example.com", RecordType: "A", Targets: []string{"203.0.113.5", "203.0.113.6"}}},
+		UpdateNew: []*ExternalDnsEndpoint{{DnsName: "www.example.com", RecordType: "CNAME", Targets: []string{"lb.example.net"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := s.find("www.example.com", "A"); len(r) != 0 {
+		t.Errorf("www A: %v", r)
+	}
+	if r := s.find("www.example.com", "CNAME"); len(r) != 1 || r[0].Data != "lb.example.net." {
+		t.Errorf("www CNAME: %v", r)
+	}
+}
@@ -0,0 +1,265 @@
+package conoha
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+type (
+	// libdns のインターフェースを実装したプロバイダ(Caddyなどで使用する)
+	LibdnsProvider struct {
+		api *V3
+	}
+)
+
+var (
+	_ libdns.RecordGetter   = (*LibdnsProvider)(nil)
+	_ libdns.RecordAppender = (*LibdnsProvider)(nil)
+	_ libdns.RecordSetter   = (*LibdnsProvider)(nil)
+	_ libdns.RecordDeleter  = (*LibdnsProvider)(nil)
+	_ libdns.ZoneLister     = (*LibdnsProvider)(nil)
+)
+
+func NewLibdnsProvider(api *V3) *LibdnsProvider {
+	return &LibdnsProvider{api: api}
+}
+
+// ゾーン名(末尾のドットの有無を問わない)に一致するドメインを取得する
+func (p *LibdnsProvider) domain(ctx context.Context, zone string) (*Domain, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	domains, err := p.api.getAllDomains()
+	if err != nil {
+		return nil, err
+	}
+	zone = strings.ToLower(fqdn(zone))
+	for _, d := range domains {
+		if strings.ToLower(fqdn(d.Name)) == zone {
+			return &d, nil
+		}
+	}
+	return nil, fmt.Errorf(`%w: %s`, ErrDomainNotFound, zone)
+}
+
+func (p *LibdnsProvider) records(ctx context.Context, zone string) (*Domain, []Record, error) {
+	d, err := p.domain(ctx, zone)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	records, err := p.api.getAllRecords(d.Uuid)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d, records, nil
+}
+
+func toLibdnsRecord(r *Record, zone string) libdns.Record {
+	data := rdata(r.Type, r.Data, r.Priority, r.Weight, r.Port)
+	if r.Type == "TXT" {
+		data = normalizeData("TXT", r.Data)
+	}
+	rr := libdns.RR{
+		Name: libdns.RelativeName(fqdn(r.Name), zone),
+		TTL:  time.Duration(r.Ttl) * time.Second,
+		Type: r.Type,
+		Data: data,
+	}
+	v, err := rr.Parse()
+	if err != nil {
+		return rr
+	}
+	return v
+}
+
+func toRecordSpec(rec libdns.Record, zone string) (*RecordSpec, error) {
+	rr := rec.RR()
+	name := libdns.AbsoluteName(rr.Name, zone)
+	v, err := rr.Parse()
+	if err != nil {
+		return nil, err
+	}
+	var spec *RecordSpec
+	switch r := v.(type) {
+	case libdns.Address:
+		if r.IP.Is4() {
+			spec = NewARecord(name, r.IP.String())
+		} else {
+			spec = NewAAAARecord(name, r.IP.String())
+		}
+	case libdns.CNAME:
+		spec = NewCNAMERecord(name, libdns.AbsoluteName(r.Target, zone))
+	case libdns.NS:
+		spec = NewNSRecord(name, libdns.AbsoluteName(r.Target, zone))
+	case libdns.MX:
+		spec = NewMXRecord(name, libdns.AbsoluteName(r.Target, zone), int(r.Preference))
+	case libdns.SRV:
+		spec = NewSRVRecord(libdns.AbsoluteName(r.RR().Name, zone), libdns.AbsoluteName(r.Target, zone), int(r.Priority), int(r.Weight), int(r.Port))
+	case libdns.TXT:
+		spec = NewTXTRecord(name, r.Text)
+	case libdns.CAA:
+		spec = NewCAARecord(name, int(r.Flags), r.Tag, r.Value)
+	default:
+		if rr.Type != "PTR" {
+			return nil, fmt.Errorf(`unsupported type %s`, rr.Type)
+		}
+		spec = NewPTRRecord(name, libdns.AbsoluteName(rr.Data, zone))
+	}
+	spec.Ttl = int(rr.TTL / time.Second)
+	return spec, nil
+}
+
+func (p *LibdnsProvider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	_, records, err := p.records(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	v := []libdns.Record{}
+	for _, r := range records {
+		v = append(v, toLibdnsRecord(&r, zone))
+	}
+	return v, nil
+}
+
+func (p *LibdnsProvider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	d, err := p.domain(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	specs := []*RecordSpec{}
+	for _, rec := range recs {
+		spec, err := toRecordSpec(rec, zone)
+		if err != nil {
+			return nil, err
+		}
+		if err := spec.Validate(); err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	v := []libdns.Record{}
+	for _, spec := range specs {
+		if err := ctx.Err(); err != nil {
+			return v, err
+		}
+		r, err := p.api.CreateRecordBySpec(d.Uuid, spec)
+		if err != nil {
+			return v, err
+		}
+		v = append(v, toLibdnsRecord((*Record)(r), zone))
+	}
+	return v, nil
+}
+
+// 入力に含まれる名前・タイプのレコードのみを入力と同じ状態にする
+func (p *LibdnsProvider) SetRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	d, records, err := p.records(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	desired := []RecordSpec{}
+	for _, rec := range recs {
+		spec, err := toRecordSpec(rec, zone)
+		if err != nil {
+			return nil, err
+		}
+		desired = append(desired, *spec)
+	}
+	plan, err := PlanZone(d.Name, records, desired, &ZoneSyncOptions{IgnoreUnmanaged: true})
+	if err != nil {
+		return nil, err
+	}
+	plan.DomainId = d.Uuid
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	_, err = p.api.ApplyZonePlan(plan)
+	if err != nil {
+		return nil, err
+	}
+	v := []libdns.Record{}
+	for _, rec := range recs {
+		if r, err := rec.RR().Parse(); err == nil {
+			rec = r
+		}
+		v = append(v, rec)
+	}
+	return v, nil
+}
+
+// 名前は必須、タイプ・TTL・値は空の場合は条件にしない
+func (p *LibdnsProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	d, records, err := p.records(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	deleted := map[string]bool{}
+	v := []libdns.Record{}
+	for _, rec := range recs {
+		rr := rec.RR()
+		name := strings.ToLower(libdns.AbsoluteName(rr.Name, zone))
+		for _, r := range records {
+			if deleted[r.Uuid.String()] || managedByConoha(r.Name, r.Type, fqdn(d.Name)) {
+				continue
+			}
+			if strings.ToLower(fqdn(r.Name)) != name {
+				continue
+			}
+			if rr.Type != "" && !strings.EqualFold(rr.Type, r.Type) {
+				continue
+			}
+			if rr.TTL != 0 && time.Duration(r.Ttl)*time.Second != rr.TTL {
+				continue
+			}
+			current := toLibdnsRecord(&r, zone)
+			if rr.Data != "" && !sameLibdnsData(current.RR(), rr, zone) {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return v, err
+			}
+			err = p.api.DeleteRecord(d.Uuid, r.Uuid)
+			if err != nil {
+				return v, err
+			}
+			deleted[r.Uuid.String()] = true
+			v = append(v, current)
+		}
+	}
+	return v, nil
+}
+
+func sameLibdnsData(current, rr libdns.RR, zone string) bool {
+	spec, err := toRecordSpec(rr, zone)
+	if err != nil {
+		return current.Data == rr.Data
+	}
+	target, err := toRecordSpec(current, zone)
+	if err != nil {
+		return current.Data == rr.Data
+	}
+	return normalizeData(spec.Type, spec.Data) == normalizeData(target.Type, target.Data) &&
+		spec.Priority == target.Priority && spec.Weight == target.Weight && spec.Port == target.Port
+}
+
+func (p *LibdnsProvider) ListZones(ctx context.Context) ([]libdns.Zone, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	domains, err := p.api.getAllDomains()
+	if err != nil {
+		return nil, err
+	}
+	v := []libdns.Zone{}
+	for _, d := range domains {
+		v = append(v, libdns.Zone{Name: fqdn(d.Name)})
+	}
+	return v, nil
+}
@@ -0,0 +1,74 @@
+package conoha
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestLibdnsProvider(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	d := s.addDomain("example.com")
+	s.addRecord(d, Record{Name: "www.example.com", Type: "A", Data: "203.0.113.5", Ttl: 300})
+	s.addRecord(d, Record{Name: "www.example.com", Type: "A", Data: "203.0.113.6", Ttl: 300})
+	s.addRecord(d, Record{Name: "example.com", Type: "MX", Data: "mail.example.com.", Priority: 10, Ttl: 300})
+	p := NewLibdnsProvider(api)
+	ctx := context.Background()
+
+	for _, zone := range []string{"example.com", "example.com."} {
+		records, err := p.GetRecords(ctx, zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 4 {
+			t.Fatalf("records: %v", records)
+		}
+	}
+	records, _ := p.GetRecords(ctx, "example.com.")
+	for _, r := range records {
+		if mx, ok := r.(libdns.MX); ok && (mx.Name != "@" || mx.Preference != 10 || mx.Target != "mail.example.com." || mx.TTL != 300*time.Second) {
+			t.Errorf("MX: %+v", mx)
+		}
+	}
+
+	_, err := p.AppendRecords(ctx, "example.com.", []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge", Text: "token", TTL: time.Minute},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records := s.find("_acme-challenge.example.com", "TXT"); len(records) != 1 || records[0].Data != `"token"` || records[0].Ttl != 60 {
+		t.Errorf("TXT: %v", records)
+	}
+
+	_, err = p.SetRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("203.0.113.7"), TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records := s.find("www.example.com", "A"); len(records) != 1 || records[0].Data != "203.0.113.7" {
+		t.Errorf("A: %v", records)
+	}
+	if records := s.find("example.com", "MX"); len(records) != 1 {
+		t.Errorf("MX: %v", records)
+	}
+
+	deleted, err := p.DeleteRecords(ctx, "example.com.", []libdns.Record{
+		libdns.RR{Name: "_acme-challenge", Type: "TXT", Data: "token"},
+		libdns.RR{Name: "nothing", Type: "A"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || len(s.find("_acme-challenge.example.com", "TXT")) != 0 {
+		t.Errorf("deleted: %v", deleted)
+	}
+
+	if _, err := p.GetRecords(ctx, "example.net."); err == nil {
+		t.Errorf("error expected for unknown zone")
+	}
+}
@@ -0,0 +1,342 @@
+package conoha
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type (
+	// 権威DNSサーバーへの反映を確認する
+	DnsPropagationChecker struct {
+		Resolver *net.Resolver // NSとそのアドレスの名前解決(nilの場合はnet.DefaultResolver)
+		// 権威サーバーへの接続(nilの場合はnet.Dialer)
+		Dial     func(ctx context.Context, network, address string) (net.Conn, error)
+		Timeout  time.Duration // 1回の問い合わせのタイムアウト(デフォルト5秒)
+		Interval time.Duration // 確認間隔(デフォルト5秒)
+		api      *V3
+	}
+	DnsNameserver struct {
+		Name    string // NSのホスト名
+		Address string // host:port
+	}
+	DnsServerStatus struct {
+		DnsNameserver
+		Records []Record
+		Serial  uint32
+		Served  bool
+		Error   error
+	}
+	DnsPropagationStatus struct {
+		Servers []DnsServerStatus
+		Done    bool
+	}
+)
+
+// dnsmessage に定義のないCAA(RFC 8659)
+const dnsTypeCAA = dnsmessage.Type(257)
+
+var dnsQueryTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"NS":    dnsmessage.TypeNS,
+	"TXT":   dnsmessage.TypeTXT,
+	"SRV":   dnsmessage.TypeSRV,
+	"PTR":   dnsmessage.TypePTR,
+	"CAA":   dnsTypeCAA,
+}
+
+func NewDnsPropagationChecker(api *V3) *DnsPropagationChecker {
+	return &DnsPropagationChecker{
+		Timeout:  5 * time.Second,
+		Interval: 5 * time.Second,
+		api:      api,
+	}
+}
+
+func (c *DnsPropagationChecker) resolver() *net.Resolver {
+	if c.Resolver == nil {
+		return net.DefaultResolver
+	}
+	return c.Resolver
+}
+
+func (c *DnsPropagationChecker) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if c.Dial != nil {
+		return c.Dial(ctx, network, address)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, network, address)
+}
+
+// ドメインの権威サーバー
+// 名前解決できない場合はAPIの頂点のNSレコードを使用する
+func (c *DnsPropagationChecker) Nameservers(ctx context.Context, domain *Domain) ([]DnsNameserver, error) {
+	hosts := []string{}
+	ns, err := c.resolver().LookupNS(ctx, fqdn(domain.Name))
+	if err == nil {
+		for _, n := range ns {
+			hosts = append(hosts, n.Host)
+		}
+	}
+	if len(hosts) == 0 {
+		records, err := c.api.getAllRecords(domain.Uuid)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			if r.Type == "NS" && strings.EqualFold(fqdn(r.Name), fqdn(domain.Name)) {
+				hosts = append(hosts, r.Data)
+			}
+		}
+	}
+	servers := []DnsNameserver{}
+	errs := []error{}
+	for _, host := range hosts {
+		addrs, err := c.resolver().LookupHost(ctx, fqdn(host))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, addr := range addrs {
+			servers = append(servers, DnsNameserver{Name: fqdn(host), Address: net.JoinHostPort(addr, "53")})
+		}
+	}
+	if len(servers) == 0 {
+		errs = append(errs, fmt.Errorf(`no nameserver for %s`, domain.Name))
+		return nil, errors.Join(errs...)
+	}
+	return servers, nil
+}
+
+// 1件の問い合わせ(UDPで切り詰められた場合はTCPで再送する)
+func (c *DnsPropagationChecker) exchange(ctx context.Context, server, name string, typ dnsmessage.Type) (*dnsmessage.Message, error) {
+	qname, err := dnsmessage.NewName(fqdn(name))
+	if err != nil {
+		return nil, err
+	}
+	id := uint16(rand.Uint32())
+	req := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id},
+		Questions: []dnsmessage.Question{{Name: qname, Type: typ, Class: dnsmessage.ClassINET}},
+	}
+	b, err := req.Pack()
+	if err != nil {
+		return nil, err
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for _, network := range []string{"udp", "tcp"} {
+		res, err := c.roundTrip(ctx, network, server, b)
+		if err != nil {
+			return nil, err
+		}
+		if res.ID != id {
+			return nil, fmt.Errorf(`%s: id mismatch`, server)
+		}
+		if res.Truncated && network == "udp" {
+			continue
+		}
+		if res.RCode != dnsmessage.RCodeSuccess && res.RCode != dnsmessage.RCodeNameError {
+			return nil, fmt.Errorf(`%s: %s`, server, res.RCode)
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf(`%s: truncated`, server)
+}
+
+func (c *DnsPropagationChecker) roundTrip(ctx context.Context, network, server string, req []byte) (*dnsmessage.Message, error) {
+	conn, err := c.dial(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	var b []byte
+	if network == "tcp" {
+		// TCPは先頭2バイトがメッセージ長
+		_, err = conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(req))))
+		if err == nil {
+			_, err = conn.Write(req)
+		}
+		if err != nil {
+			return nil, err
+		}
+		l := make([]byte, 2)
+		if _, err = io.ReadFull(conn, l); err != nil {
+			return nil, err
+		}
+		b = make([]byte, binary.BigEndian.Uint16(l))
+		if _, err = io.ReadFull(conn, b); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err = conn.Write(req); err != nil {
+			return nil, err
+		}
+		b = make([]byte, 65535)
+		n, err := conn.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		b = b[:n]
+	}
+	var res dnsmessage.Message
+	if err := res.Unpack(b); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// 権威サーバーにレコードを直接問い合わせる
+func (c *DnsPropagationChecker) Query(ctx context.Context, server, name, typ string) ([]Record, error) {
+	t, ok := dnsQueryTypes[strings.ToUpper(typ)]
+	if !ok {
+		return nil, fmt.Errorf(`unsupported type %s`, typ)
+	}
+	res, err := c.exchange(ctx, server, name, t)
+	if err != nil {
+		return nil, err
+	}
+	records := []Record{}
+	for _, a := range res.Answers {
+		if a.Header.Type != t {
+			continue
+		}
+		r := Record{Name: a.Header.Name.String(), Type: strings.ToUpper(typ), Ttl: int(a.Header.TTL)}
+		switch body := a.Body.(type) {
+		case *dnsmessage.AResource:
+			r.Data = netip.AddrFrom4(body.A).String()
+		case *dnsmessage.AAAAResource:
+			r.Data = netip.AddrFrom16(body.AAAA).String()
+		case *dnsmessage.CNAMEResource:
+			r.Data = body.CNAME.String()
+		case *dnsmessage.NSResource:
+			r.Data = body.NS.String()
+		case *dnsmessage.PTRResource:
+			r.Data = body.PTR.String()
+		case *dnsmessage.MXResource:
+			r.Data = body.MX.String()
+			r.Priority = int(body.Pref)
+		case *dnsmessage.SRVResource:
+			r.Data = body.Target.String()
+			r.Priority = int(body.Priority)
+			r.Weight = int(body.Weight)
+			r.Port = int(body.Port)
+		case *dnsmessage.TXTResource:
+			r.Data = quoteTxt(strings.Join(body.TXT, ""))
+		case *dnsmessage.UnknownResource:
+			if t != dnsTypeCAA {
+				continue
+			}
+			r.Data, err = parseCaa(body.Data)
+			if err != nil {
+				return nil, err
+			}
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// CAAのRDATA(フラグ, タグの長さ, タグ, 値)を NewCAARecord と同じ形式にする
+func parseCaa(b []byte) (string, error) {
+	if len(b) < 2 || len(b) < 2+int(b[1]) {
+		return "", errors.New(`invalid CAA record`)
+	}
+	tag := string(b[2 : 2+int(b[1])])
+	value := string(b[2+int(b[1]):])
+	return fmt.Sprintf(`%d %s "%s"`, b[0], tag, strings.ReplaceAll(value, `"`, `\"`)), nil
+}
+
+// 権威サーバーのSOAのシリアル
+func (c *DnsPropagationChecker) Serial(ctx context.Context, server, zone string) (uint32, error) {
+	res, err := c.exchange(ctx, server, zone, dnsmessage.TypeSOA)
+	if err != nil {
+		return 0, err
+	}
+	for _, a := range res.Answers {
+		if soa, ok := a.Body.(*dnsmessage.SOAResource); ok {
+			return soa.Serial, nil
+		}
+	}
+	return 0, fmt.Errorf(`%s: no SOA for %s`, server, zone)
+}
+
+// シリアル番号の比較(RFC 1982)
+func serialAfter(a, b uint32) bool {
+	return int32(a-b) > 0
+}
+
+// 全ての権威サーバーで spec の値が返るか、シリアルが domain.Serial より進んでいるか
+// domain は変更前に取得したもの、spec が nil の場合はシリアルのみ確認する
+func (c *DnsPropagationChecker) Check(ctx context.Context, servers []DnsNameserver, domain *Domain, spec *RecordSpec) *DnsPropagationStatus {
+	status := &DnsPropagationStatus{Servers: []DnsServerStatus{}, Done: len(servers) > 0}
+	for _, ns := range servers {
+		s := DnsServerStatus{DnsNameserver: ns}
+		serial, err := c.Serial(ctx, ns.Address, domain.Name)
+		if err != nil {
+			s.Error = err
+		} else {
+			s.Serial = serial
+			s.Served = serialAfter(serial, uint32(domain.Serial))
+		}
+		if !s.Served && spec != nil {
+			// 問い合わせできないタイプはエラーになり、シリアルでのみ確認する
+			s.Records, err = c.Query(ctx, ns.Address, spec.Name, spec.Type)
+			if err != nil {
+				s.Error = errors.Join(s.Error, err)
+			}
+			for _, r := range s.Records {
+				if sameData(&r, spec) {
+					s.Served = true
+					s.Error = nil
+					break
+				}
+			}
+		}
+		status.Done = status.Done && s.Served
+		status.Servers = append(status.Servers, s)
+	}
+	return status
+}
+
+// 全ての権威サーバーに反映されるまで待つ
+func (c *DnsPropagationChecker) Wait(ctx context.Context, domain *Domain, spec *RecordSpec) (*DnsPropagationStatus, error) {
+	servers, err := c.Nameservers(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	interval := c.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	for {
+		status := c.Check(ctx, servers, domain, spec)
+		if status.Done {
+			return status, nil
+		}
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package conoha
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// テスト用の権威DNSサーバー
+type dnsTestNameserver struct {
+	conn    net.PacketConn
+	mu      sync.Mutex
+	serial  uint32
+	answers map[string][]dnsmessage.Resource
+}
+
+func newDnsTestNameserver(t *testing.T) *dnsTestNameserver {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	s := &dnsTestNameserver{conn: conn, serial: 1, answers: map[string][]dnsmessage.Resource{}}
+	go s.serve()
+	return s
+}
+
+func (s *dnsTestNameserver) set(name string, typ dnsmessage.Type, bodies ...dnsmessage.ResourceBody) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := strings.ToLower(name) + " " + typ.String()
+	s.answers[key] = nil
+	for _, b := range bodies {
+		s.answers[key] = append(s.answers[key], dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: typ, Class: dnsmessage.ClassINET, TTL: 60},
+			Body:   b,
+		})
+	}
+}
+
+func (s *dnsTestNameserver) serve() {
+	b := make([]byte, 65535)
+	for {
+		n, addr, err := s.conn.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		var req dnsmessage.Message
+		if err := req.Unpack(b[:n]); err != nil || len(req.Questions) == 0 {
+			continue
+		}
+		q := req.Questions[0]
+		res := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: req.ID, Response: true, Authoritative: true, RecursionAvailable: true},
+			Questions: []dnsmessage.Question{q},
+		}
+		s.mu.Lock()
+		if q.Type == dnsmessage.TypeSOA {
+			res.Answers = append(res.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET, TTL: 60},
+				Body: &dnsmessage.SOAResource{
+					NS:     dnsmessage.MustNewName("ns1.example.net."),
+					MBox:   dnsmessage.MustNewName("hostmaster.example.com."),
+					Serial: s.serial,
+				},
+			})
+		} else {
+			res.Answers = s.answers[strings.ToLower(q.Name.String())+" "+q.Type.String()]
+		}
+		s.mu.Unlock()
+		p, err := res.Pack()
+		if err != nil {
+			continue
+		}
+		s.conn.WriteTo(p, addr)
+	}
+}
+
+// 全ての問い合わせをテスト用サーバーに向ける
+func (s *dnsTestNameserver) checker(api *V3) *DnsPropagationChecker {
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "udp", s.conn.LocalAddr().String())
+	}
+	c := NewDnsPropagationChecker(api)
+	c.Resolver = &net.Resolver{PreferGo: true, Dial: dial}
+	c.Dial = dial
+	c.Interval = 10 * time.Millisecond
+	c.Timeout = time.Second
+	return c
+}
+
+func TestDnsPropagationWait(t *testing.T) {
+	ns := newDnsTestNameserver(t)
+	ns.set("example.com.", dnsmessage.TypeNS, &dnsmessage.NSResource{NS: dnsmessage.MustNewName("ns1.example.net.")})
+	ns.set("ns1.example.net.", dnsmessage.TypeA, &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}})
+	domain := &Domain{Name: "example.com.", Serial: 1}
+	c := ns.checker(NewV3())
+
+	servers, err := c.Nameservers(context.Background(), domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 1 || servers[0].Name != "ns1.example.net." || servers[0].Address != "127.0.0.1:53" {
+		t.Fatalf("servers: %+v", servers)
+	}
+
+	spec := NewTXTRecord("_acme-challenge.example.com.", "value")
+	status := c.Check(context.Background(), servers, domain, spec)
+	if status.Done {
+		t.Fatal("done before the record is served")
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		ns.set("_acme-challenge.example.com.", dnsmessage.TypeTXT, &dnsmessage.TXTResource{TXT: []string{"value"}})
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	status, err = c.Wait(ctx, domain, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Done || len(status.Servers[0].Records) != 1 || status.Servers[0].Serial != 1 {
+		t.Errorf("status: %+v", status)
+	}
+}
+
+func TestDnsPropagationSerial(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	domain := s.addDomain("example.com")
+	ns := newDnsTestNameserver(t)
+	// NSの名前解決に失敗した場合はAPIの頂点のNSレコードを使用する
+	ns.set("ns-a1.conoha.io.", dnsmessage.TypeA, &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}})
+	c := ns.checker(api)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	status, err := c.Wait(ctx, domain, nil)
+	if err != context.DeadlineExceeded || status.Done {
+		t.Fatalf("err: %v, status: %+v", err, status)
+	}
+
+	ns.mu.Lock()
+	ns.serial = 2
+	ns.mu.Unlock()
+	status, err = c.Wait(context.Background(), domain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Done || status.Servers[0].Name != "ns-a1.conoha.io." || status.Servers[0].Serial != 2 {
+		t.Errorf("status: %+v", status)
+	}
+}
+
+func TestDnsPropagationCaa(t *testing.T) {
+	ns := newDnsTestNameserver(t)
+	servers := []DnsNameserver{{Name: "ns1.example.net.", Address: ns.conn.LocalAddr().String()}}
+	domain := &Domain{Name: "example.com.", Serial: 1}
+	c := ns.checker(NewV3())
+	caa := append([]byte{0, 5}, "issueletsencrypt.org"...)
+	ns.set("example.com.", dnsTypeCAA, &dnsmessage.UnknownResource{Type: dnsTypeCAA, Data: caa})
+
+	status := c.Check(context.Background(), servers, domain, NewCAARecord("example.com", 0, "issue", "letsencrypt.org"))
+	if !status.Done || len(status.Servers[0].Records) != 1 || status.Servers[0].Records[0].Data != `0 issue "letsencrypt.org"` {
+		t.Errorf("status: %+v", status)
+	}
+
+	// 問い合わせできないタイプはエラーとして返す
+	status = c.Check(context.Background(), servers, domain, &RecordSpec{Name: "example.com", Type: "HINFO", Data: "x"})
+	if status.Done || status.Servers[0].Error == nil || !strings.Contains(status.Servers[0].Error.Error(), "unsupported type HINFO") {
+		t.Errorf("status: %+v", status)
+	}
+	if _, err := c.Query(context.Background(), servers[0].Address, "example.com", "hinfo"); err == nil || err.Error() != "unsupported type hinfo" {
+		t.Errorf("error: %v", err)
+	}
+}
+
+func TestSerialAfter(t *testing.T) {
+	for _, c := range []struct {
+		a, b uint32
+		want bool
+	}{
+		{2, 1, true},
+		{1, 1, false},
+		{1, 2, false},
+		{0, 4294967295, true},
+	} {
+		if got := serialAfter(c.a, c.b); got != c.want {
+			t.Errorf("serialAfter(%d, %d): %v", c.a, c.b, got)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package conoha
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MinRecordTtl = 60
+	MaxRecordTtl = 2147483647
+)
+
+type (
+	// 型付きのDNSレコード
+	RecordSpec struct {
+		Name     string
+		Type     string
+		Data     string
+		Priority int
+		Weight   int
+		Port     int
+		Ttl      int // 0の場合はドメインのTTL
+	}
+	RecordError struct {
+		Type   string
+		Field  string
+		Value  string
+		Reason string
+	}
+)
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf(`Invalid %s record: %s "%s": %s`, e.Type, e.Field, e.Value, e.Reason)
+}
+
+func NewARecord(name, addr string) *RecordSpec {
+	return &RecordSpec{Name: name, Type: "A", Data: addr}
+}
+
+func NewAAAARecord(name, addr string) *RecordSpec {
+	return &RecordSpec{Name: name, Type: "AAAA", Data: addr}
+}
+
+func NewCNAMERecord(name, target string) *RecordSpec {
+	return &RecordSpec{Name: name, Type: "CNAME", Data: fqdn(target)}
+}
+
+func NewMXRecord(name, host string, priority int) *RecordSpec {
+	return &RecordSpec{Name: name, Type: "MX", Data: fqdn(host), Priority: priority}
+}
+
+func NewNSRecord(name, host string) *RecordSpec {
+	return &RecordSpec{Name: name, Type: "NS", Data: fqdn(host)}
+}
+
+// 255バイトを超えるテキストは複数の文字列に分割する
+func NewTXTRecord(name, text string) *RecordSpec {
+	return &RecordSpec{Name: name, Type: "TXT", Data: quoteTxt(text)}
+}
+
+func NewSRVRecord(name, target string, priority, weight, port int) *RecordSpec {
+	return &RecordSpec{Name: name, Type: "SRV", Data: fqdn(target), Priority: priority, Weight: weight, Port: port}
+}
+
+func NewCAARecord(name string, flags int, tag, value string) *RecordSpec {
+	return &RecordSpec{Name: name, Type: "CAA", Data: fmt.Sprintf(`%d %s "%s"`, flags, tag, strings.ReplaceAll(value, `"`, `\"`))}
+}
+
+func NewPTRRecord(name, host string) *RecordSpec {
+	return &RecordSpec{Name: name, Type: "PTR", Data: fqdn(host)}
+}
+
+func (r *RecordSpec) WithTtl(ttl int) *RecordSpec {
+	r.Ttl = ttl
+	return r
+}
+
+// 既存のレコードと同じ内容の RecordSpec
+func (r *Record) spec() *RecordSpec {
+	return &RecordSpec{Name: r.Name, Type: r.Type, Data: r.Data, Priority: r.Priority, Weight: r.Weight, Port: r.Port, Ttl: r.Ttl}
+}
+
+// 既存のレコードと同じ内容のリクエスト(元に戻す場合のため検証しない)
+func (r *Record) request() recordRequest {
+	req := recordRequest{Name: r.Name, Type: r.Type, Data: r.Data, Ttl: r.Ttl}
+	switch strings.ToUpper(r.Type) {
+	case "MX":
+		req.Priority = strconv.Itoa(r.Priority)
+	case "SRV":
+		req.Priority = strconv.Itoa(r.Priority)
+		req.Weight = strconv.Itoa(r.Weight)
+		req.Port = strconv.Itoa(r.Port)
+	}
+	return req
+}
+
+// 末尾にドットを付与する
+func fqdn(name string) string {
+	name = strings.Trim(name, "\r\n\t\v .")
+	if name == "" {
+		return ""
+	}
+	return name + "."
+}
+
+// 255バイトごとに分割する(マルチバイト文字の途中では分割しない)
+func quoteTxt(text string) string {
+	chunks := []string{}
+	b := []byte(text)
+	for len(b) > 255 {
+		n := 255
+		for n > 0 && !utf8.RuneStart(b[n]) {
+			n--
+		}
+		if n == 0 {
+			n = 255
+		}
+		chunks = append(chunks, escapeTxt(b[:n]))
+		b = b[n:]
+	}
+	chunks = append(chunks, escapeTxt(b))
+	return strings.Join(chunks, " ")
+}
+
+func escapeTxt(b []byte) string {
+	s := strings.ReplaceAll(string(b), `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// TXTレコードの文字列を分解する
+func unquoteTxt(data string) ([]string, error) {
+	chunks := []string{}
+	data = strings.TrimSpace(data)
+	if !strings.HasPrefix(data, `"`) {
+		return []string{data}, nil
+	}
+	for len(data) > 0 {
+		if data[0] != '"' {
+			return nil, fmt.Errorf(`unexpected character %q`, data[0])
+		}
+		b := []byte{}
+		i := 1
+		for ; i < len(data) && data[i] != '"'; i++ {
+			if data[i] == '\\' && i+1 < len(data) {
+				i++
+			}
+			b = append(b, data[i])
+		}
+		if i >= len(data) {
+			return nil, errors.New(`unterminated string`)
+		}
+		chunks = append(chunks, string(b))
+		data = strings.TrimSpace(data[i+1:])
+	}
+	return chunks, nil
+}
+
+func validHostname(name string, wildcard bool) string {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return "empty name"
+	}
+	if len(name) > 253 {
+		return "longer than 253 characters"
+	}
+	for k, label := range strings.Split(name, ".") {
+		if label == "*" && k == 0 && wildcard {
+			continue
+		}
+		if label == "" {
+			return "empty label"
+		}
+		if len(label) > 63 {
+			return fmt.Sprintf(`label "%s" longer than 63 characters`, label)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return fmt.Sprintf(`invalid character %q in label "%s"`, c, label)
+			}
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Sprintf(`label "%s" starts or ends with hyphen`, label)
+		}
+	}
+	return ""
+}
+
+func validUint16(v int) bool {
+	return v >= 0 && v <= 65535
+}
+
+// レコードの内容を検証する
+// 不正な項目が複数ある場合は全てのエラーをまとめて返す
+func (r *RecordSpec) Validate() error {
+	errs := []error{}
+	typ := strings.ToUpper(r.Type)
+	invalid := func(field, value, reason string) {
+		errs = append(errs, &RecordError{Type: typ, Field: field, Value: value, Reason: reason})
+	}
+	if reason := validHostname(r.Name, true); reason != "" {
+		invalid("name", r.Name, reason)
+	}
+	if r.Ttl != 0 && (r.Ttl < MinRecordTtl || r.Ttl > MaxRecordTtl) {
+		invalid("ttl", strconv.Itoa(r.Ttl), fmt.Sprintf(`out of range %d-%d`, MinRecordTtl, MaxRecordTtl))
+	}
+	switch typ {
+	case "A":
+		addr, err := netip.ParseAddr(r.Data)
+		if err != nil || !addr.Is4() {
+			invalid("data", r.Data, "not an IPv4 address")
+		}
+	case "AAAA":
+		addr, err := netip.ParseAddr(r.Data)
+		if err != nil || !addr.Is6() || addr.Is4In6() || addr.Zone() != "" {
+			invalid("data", r.Data, "not an IPv6 address")
+		}
+	case "CNAME", "NS", "PTR":
+		if reason := validHostname(r.Data, false); reason != "" {
+			invalid("data", r.Data, reason)
+		}
+	case "MX":
+		if reason := validHostname(r.Data, false); reason != "" {
+			invalid("data", r.Data, reason)
+		}
+		if !validUint16(r.Priority) {
+			invalid("priority", strconv.Itoa(r.Priority), "out of range 0-65535")
+		}
+	case "SRV":
+		labels := strings.Split(r.Name, ".")
+		if len(labels) < 3 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+			invalid("name", r.Name, "must be _service._proto.name")
+		}
+		if r.Data != "." {
+			if reason := validHostname(r.Data, false); reason != "" {
+				invalid("data", r.Data, reason)
+			}
+		}
+		if !validUint16(r.Priority) {
+			invalid("priority", strconv.Itoa(r.Priority), "out of range 0-65535")
+		}
+		if !validUint16(r.Weight) {
+			invalid("weight", strconv.Itoa(r.Weight), "out of range 0-65535")
+		}
+		if !validUint16(r.Port) || r.Port == 0 {
+			invalid("port", strconv.Itoa(r.Port), "out of range 1-65535")
+		}
+	case "TXT":
+		chunks, err := unquoteTxt(r.Data)
+		if err != nil {
+			invalid("data", r.Data, err.Error())
+		}
+		for _, c := range chunks {
+			if len(c) > 255 {
+				invalid("data", c, "string longer than 255 bytes")
+			}
+		}
+	case "CAA":
+		fields := strings.SplitN(r.Data, " ", 3)
+		if len(fields) != 3 {
+			invalid("data", r.Data, `must be <flags> <tag> "<value>"`)
+			break
+		}
+		flags, err := strconv.Atoi(fields[0])
+		if err != nil || flags < 0 || flags > 255 {
+			invalid("flags", fields[0], "out of range 0-255")
+		}
+		switch fields[1] {
+		case "issue", "issuewild", "iodef", "issuemail", "issuevmc":
+			// Do Nothing
+		default:
+			invalid("tag", fields[1], "unknown tag")
+		}
+		if !strings.HasPrefix(fields[2], `"`) || !strings.HasSuffix(fields[2], `"`) || len(fields[2]) < 2 {
+			invalid("value", fields[2], "must be quoted")
+		}
+	default:
+		invalid("type", r.Type, "unsupported type")
+	}
+	return errors.Join(errs...)
+}
+
+func (r *RecordSpec) request() (recordRequest, error) {
+	err := r.Validate()
+	if err != nil {
+		return recordRequest{}, err
+	}
+	req := recordRequest{
+		Name: fqdn(r.Name),
+		Type: strings.ToUpper(r.Type),
+		Data: r.Data,
+		Ttl:  r.Ttl,
+	}
+	switch req.Type {
+	case "MX":
+		req.Priority = strconv.Itoa(r.Priority)
+	case "SRV":
+		req.Priority = strconv.Itoa(r.Priority)
+		req.Weight = strconv.Itoa(r.Weight)
+		req.Port = strconv.Itoa(r.Port)
+	}
+	return req, nil
+}
+
+// レコード作成(型付き)
+func (api *V3) CreateRecordBySpec(domainId uuid.UUID, spec *RecordSpec) (*CreateRecordResponse, error) {
+	req, err := spec.request()
+	if err != nil {
+		return nil, err
+	}
+	return api.createRecord(domainId, req)
+}
+
+// レコード更新(型付き)
+func (api *V3) UpdateRecordBySpec(domainId, recordId uuid.UUID, spec *RecordSpec) (*UpdateRecordResponse, error) {
+	req, err := spec.request()
+	if err != nil {
+		return nil, err
+	}
+	return api.updateRecord(domainId, recordId, req)
+}
@@ -0,0 +1,102 @@
+package conoha
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRecordSpecValidate(t *testing.T) {
+	valid := []*RecordSpec{
+		NewARecord("www.example.com", "203.0.113.5"),
+		NewAAAARecord("www.example.com.", "2001:db8::1"),
+		NewCNAMERecord("*.example.com", "www.example.com"),
+		NewMXRecord("example.com", "mail.example.com", 10),
+		NewNSRecord("sub.example.com", "ns1.example.com"),
+		NewTXTRecord("example.com", "v=spf1 -all"),
+		NewSRVRecord("_sip._tcp.example.com", "sip.example.com", 10, 60, 5060),
+		NewCAARecord("example.com", 0, "issue", "letsencrypt.org"),
+		NewPTRRecord("5.113.0.203.in-addr.arpa", "www.example.com"),
+		NewARecord("ttl.example.com", "203.0.113.5").WithTtl(3600),
+	}
+	for _, r := range valid {
+		if err := r.Validate(); err != nil {
+			t.Errorf("%s %s: %s", r.Type, r.Name, err)
+		}
+	}
+	invalid := []*RecordSpec{
+		NewARecord("www.example.com", "2001:db8::1"),
+		NewAAAARecord("www.example.com", "203.0.113.5"),
+		NewCNAMERecord("www.example.com", "bad host.example.com"),
+		NewMXRecord("example.com", "mail.example.com", 70000),
+		NewSRVRecord("sip.example.com", "sip.example.com", 10, 60, 5060),
+		NewSRVRecord("_sip._tcp.example.com", "sip.example.com", 10, 60, 0),
+		NewCAARecord("example.com", 0, "issues", "letsencrypt.org"),
+		NewARecord("-www.example.com", "203.0.113.5"),
+		NewARecord("www.example.com", "203.0.113.5").WithTtl(10),
+		{Name: "example.com", Type: "SPF", Data: "v=spf1 -all"},
+	}
+	for _, r := range invalid {
+		err := r.Validate()
+		var e *RecordError
+		if !errors.As(err, &e) {
+			t.Errorf("%s %s %s: RecordError expected, actual %v", r.Type, r.Name, r.Data, err)
+		}
+	}
+}
+
+func TestRecordSpecMultipleErrors(t *testing.T) {
+	err := NewSRVRecord("sip.example.com", "sip.example.com", -1, 70000, 0).Validate()
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	for _, field := range []string{"name", "priority", "weight", "port"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("%s is not reported: %s", field, err)
+		}
+	}
+}
+
+func TestTxtChunking(t *testing.T) {
+	text := strings.Repeat("a", 300) + `"quoted"`
+	r := NewTXTRecord("example.com", text)
+	chunks, err := unquoteTxt(r.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 || len(chunks[0]) != 255 || strings.Join(chunks, "") != text {
+		t.Errorf("chunks: %v", chunks)
+	}
+	if err := r.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTxtChunkingMultibyte(t *testing.T) {
+	// 3バイトの文字は255バイト目で分割されない
+	text := "a" + strings.Repeat("あ", 100)
+	r := NewTXTRecord("example.com", text)
+	chunks, err := unquoteTxt(r.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 || len(chunks[0]) != 253 || strings.Join(chunks, "") != text {
+		t.Errorf("chunks: %q", chunks)
+	}
+	for _, c := range chunks {
+		if !utf8.ValidString(c) {
+			t.Errorf("invalid chunk: %q", c)
+		}
+	}
+}
+
+func TestRecordSpecRequest(t *testing.T) {
+	req, err := NewSRVRecord("_sip._tcp.example.com", "sip.example.com", 10, 60, 5060).WithTtl(300).request()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Name != "_sip._tcp.example.com." || req.Data != "sip.example.com." || req.Priority != "10" || req.Weight != "60" || req.Port != "5060" || req.Ttl != 300 {
+		t.Errorf("request: %+v", req)
+	}
+}
@@ -0,0 +1,173 @@
+package conoha
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type (
+	// 全ドメインを対象としたレコード検索の条件(空の項目は条件にしない)
+	RecordQuery struct {
+		Types       []string // レコードタイプ
+		Name        string   // レコード名のパターン(path.Match の形式、例: *.example.com)
+		Data        string   // 値(IPアドレスやホスト名は正規化して比較する)
+		Domains     []string // 対象ドメイン
+		Concurrency int      // 同時に検索するドメイン数(デフォルト4)
+	}
+	RecordSearchResult struct {
+		Domain Domain
+		Record Record
+	}
+)
+
+func (q *RecordQuery) matchDomain(d *Domain) bool {
+	if len(q.Domains) == 0 {
+		return true
+	}
+	for _, name := range q.Domains {
+		if strings.EqualFold(fqdn(name), fqdn(d.Name)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *RecordQuery) match(r *Record) bool {
+	if len(q.Types) > 0 {
+		ok := false
+		for _, typ := range q.Types {
+			ok = ok || strings.EqualFold(typ, r.Type)
+		}
+		if !ok {
+			return false
+		}
+	}
+	if q.Name != "" {
+		ok, err := path.Match(strings.ToLower(fqdn(q.Name)), strings.ToLower(fqdn(r.Name)))
+		if err != nil || !ok {
+			return false
+		}
+	}
+	if q.Data != "" && normalizeData(r.Type, r.Data) != normalizeData(r.Type, q.Data) {
+		return false
+	}
+	return true
+}
+
+// 全ドメインのレコードを検索する
+// 一部のドメインで取得に失敗した場合も、取得できた結果を返す
+func (api *V3) SearchRecords(q *RecordQuery) ([]RecordSearchResult, error) {
+	if q.Name != "" {
+		if _, err := path.Match(q.Name, ""); err != nil {
+			return nil, err
+		}
+	}
+	domains, err := api.getAllDomains()
+	if err != nil {
+		return nil, err
+	}
+	targets := []Domain{}
+	for _, d := range domains {
+		if q.matchDomain(&d) {
+			targets = append(targets, d)
+		}
+	}
+	concurrency := q.Concurrency
+	if concurrency < 1 {
+		concurrency = 4
+	}
+	found := make([][]RecordSearchResult, len(targets))
+	errs := make([]error, len(targets))
+	runLimited(len(targets), concurrency, func(k int) {
+		records, err := api.getAllRecords(targets[k].Uuid)
+		if err != nil {
+			errs[k] = fmt.Errorf(`%s: %w`, targets[k].Name, err)
+			return
+		}
+		for _, r := range records {
+			if q.match(&r) {
+				found[k] = append(found[k], RecordSearchResult{Domain: targets[k], Record: r})
+			}
+		}
+	})
+	results := []RecordSearchResult{}
+	for _, v := range found {
+		results = append(results, v...)
+	}
+	sort.SliceStable(results, func(a, b int) bool {
+		if results[a].Domain.Name != results[b].Domain.Name {
+			return results[a].Domain.Name < results[b].Domain.Name
+		}
+		if results[a].Record.Name != results[b].Record.Name {
+			return results[a].Record.Name < results[b].Record.Name
+		}
+		return results[a].Record.Type < results[b].Record.Type
+	})
+	return results, errors.Join(errs...)
+}
+
+// ゾーン内の名前を別のゾーンの名前に置き換える
+func rewriteName(name, from, to string) string {
+	name = fqdn(name)
+	if strings.EqualFold(name, from) {
+		return to
+	}
+	if strings.HasSuffix(strings.ToLower(name), "."+strings.ToLower(from)) {
+		return name[:len(name)-len(from)] + to
+	}
+	return name
+}
+
+// 複製先のレコード
+func cloneRecordSpec(r *Record, from, to string) *RecordSpec {
+	spec := r.spec()
+	spec.Name = rewriteName(r.Name, from, to)
+	switch r.Type {
+	case "CNAME", "NS", "MX", "SRV", "PTR":
+		spec.Data = rewriteName(r.Data, from, to)
+	}
+	return spec
+}
+
+// ドメインを複製する
+// 全てのレコード(SOAと頂点のNSを除く)をコピーし、ゾーン内の名前を新しいドメイン名に置き換える
+// レコードの作成に失敗した場合は作成したドメインを削除する
+func (api *V3) CloneDomain(sourceId uuid.UUID, name, email string) (*Domain, *RecordChangeReport, error) {
+	source, err := api.GetDomain(sourceId)
+	if err != nil {
+		return nil, nil, err
+	}
+	records, err := api.getAllRecords(sourceId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if email == "" {
+		email = source.Email
+	}
+	from, to := strings.ToLower(fqdn(source.Name)), strings.ToLower(fqdn(name))
+	v, err := api.CreateDomain(to, email, source.Ttl)
+	if err != nil {
+		return nil, nil, err
+	}
+	domain := Domain(*v)
+	cs := NewRecordChangeSet(domain.Uuid)
+	for _, r := range records {
+		if managedByConoha(r.Name, r.Type, fqdn(source.Name)) {
+			continue
+		}
+		cs.Create(cloneRecordSpec(&r, from, to))
+	}
+	report, err := api.ApplyRecordChanges(cs)
+	if err != nil {
+		if report != nil && !report.RolledBack {
+			return &domain, report, err
+		}
+		return nil, report, errors.Join(err, api.DeleteDomain(domain.Uuid))
+	}
+	return &domain, report, nil
+}
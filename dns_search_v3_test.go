@@ -0,0 +1,93 @@
+package conoha
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSearchRecords(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	a := s.addDomain("a.example")
+	b := s.addDomain("b.example")
+	s.addRecord(a, Record{Name: "www.a.example", Type: "A", Data: "203.0.113.5"})
+	s.addRecord(a, Record{Name: "api.a.example", Type: "A", Data: "203.0.113.6"})
+	s.addRecord(b, Record{Name: "b.example", Type: "A", Data: "203.0.113.5"})
+	s.addRecord(b, Record{Name: "www.b.example", Type: "CNAME", Data: "WWW.a.example."})
+
+	results, err := api.SearchRecords(&RecordQuery{Data: "203.0.113.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Record.Name != "www.a.example." || results[1].Domain.Name != "b.example." {
+		t.Errorf("results: %+v", results)
+	}
+
+	results, err = api.SearchRecords(&RecordQuery{Types: []string{"cname"}, Data: "www.a.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Record.Name != "www.b.example." {
+		t.Errorf("results: %+v", results)
+	}
+
+	results, err = api.SearchRecords(&RecordQuery{Name: "*.A.example", Domains: []string{"a.example."}, Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Record.Name != "api.a.example." {
+		t.Errorf("results: %+v", results)
+	}
+
+	if _, err := api.SearchRecords(&RecordQuery{Name: "[a-"}); err == nil {
+		t.Error("invalid pattern")
+	}
+}
+
+func TestCloneDomain(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	src := s.addDomain("example.com")
+	s.addRecord(src, Record{Name: "example.com", Type: "A", Data: "203.0.113.5", Ttl: 300})
+	s.addRecord(src, Record{Name: "www.example.com", Type: "CNAME", Data: "example.com."})
+	s.addRecord(src, Record{Name: "example.com", Type: "MX", Data: "mail.example.com.", Priority: 10})
+	s.addRecord(src, Record{Name: "cdn.example.com", Type: "CNAME", Data: "cdn.example.net."})
+	s.addRecord(src, Record{Name: "sub.example.com", Type: "NS", Data: "ns1.sub.example.com."})
+
+	d, report, err := api.CloneDomain(src.Uuid, "example.org", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "example.org." || d.Email != src.Email || len(report.Results) != 5 {
+		t.Fatalf("domain: %+v, results: %d", d, len(report.Results))
+	}
+	for name, want := range map[string]string{
+		"example.org A":         "203.0.113.5",
+		"www.example.org CNAME": "example.org.",
+		"example.org MX":        "mail.example.org.",
+		"cdn.example.org CNAME": "cdn.example.net.",
+		"sub.example.org NS":    "ns1.sub.example.org.",
+	} {
+		f := strings.Fields(name)
+		if v := s.find(f[0], f[1]); len(v) != 1 || v[0].Data != want || v[0].DomainUuid != d.Uuid {
+			t.Errorf("%s: %v", name, v)
+		}
+	}
+	if v := s.find("example.org", "A"); v[0].Ttl != 300 {
+		t.Errorf("ttl: %d", v[0].Ttl)
+	}
+
+	// レコードの作成に失敗した場合は作成したドメインを削除する
+	s.fail = func(r *http.Request) bool {
+		return r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/records")
+	}
+	if _, _, err := api.CloneDomain(src.Uuid, "example.net", ""); err == nil {
+		t.Fatal("no error")
+	}
+	domains, err := api.getAllDomains()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(domains) != 2 {
+		t.Errorf("domains: %v", domains)
+	}
+}
@@ -0,0 +1,287 @@
+package conoha
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type (
+	ZoneSyncOptions struct {
+		IgnoreUnmanaged bool // 望ましい状態に含まれない名前・タイプのレコードを削除しない
+		MaxDeletes      int  // 削除件数の上限(0の場合は無制限)
+	}
+	ZonePlan struct {
+		DomainId uuid.UUID
+		Origin   string
+		Creates  []RecordSpec
+		Updates  []ZoneUpdate
+		Deletes  []Record
+	}
+	ZoneUpdate struct {
+		Current Record
+		Desired RecordSpec
+	}
+	ZoneApplyResult struct {
+		Created []Record
+		Updated []Record
+		Deleted []Record
+	}
+)
+
+var ErrTooManyDeletes = errors.New(`too many deletions`)
+
+// 比較用のキー
+func recordKey(name, typ string) string {
+	return strings.ToLower(fqdn(name)) + " " + strings.ToUpper(typ)
+}
+
+// 比較用にデータを正規化する
+func normalizeData(typ, data string) string {
+	switch strings.ToUpper(typ) {
+	case "A", "AAAA":
+		if addr, err := netip.ParseAddr(data); err == nil {
+			return addr.String()
+		}
+	case "CNAME", "NS", "PTR", "MX", "SRV":
+		return strings.ToLower(fqdn(data))
+	case "TXT":
+		if chunks, err := unquoteTxt(data); err == nil {
+			return strings.Join(chunks, "")
+		}
+	}
+	return data
+}
+
+// SOAと頂点のNSはConoHaが管理するため同期の対象外とする
+func managedByConoha(name, typ, origin string) bool {
+	typ = strings.ToUpper(typ)
+	return typ == "SOA" || typ == "NS" && strings.EqualFold(fqdn(name), origin)
+}
+
+func sameData(r *Record, s *RecordSpec) bool {
+	if normalizeData(r.Type, r.Data) != normalizeData(s.Type, s.Data) {
+		return false
+	}
+	switch r.Type {
+	case "MX":
+		return r.Priority == s.Priority
+	case "SRV":
+		return r.Priority == s.Priority && r.Weight == s.Weight && r.Port == s.Port
+	}
+	return true
+}
+
+// TTLが0の場合はドメインのTTLに従うため比較しない
+func sameRecord(r *Record, s *RecordSpec) bool {
+	return sameData(r, s) && (s.Ttl == 0 || r.Ttl == s.Ttl)
+}
+
+// 現在のレコードと望ましいレコードから変更計画を作成する
+func PlanZone(origin string, current []Record, desired []RecordSpec, opts *ZoneSyncOptions) (*ZonePlan, error) {
+	if opts == nil {
+		opts = &ZoneSyncOptions{}
+	}
+	origin = fqdn(origin)
+	errs := []error{}
+	specs := []RecordSpec{}
+	for _, s := range desired {
+		if managedByConoha(s.Name, s.Type, origin) {
+			continue
+		}
+		specs = append(specs, s)
+	}
+	desired = specs
+	for _, s := range desired {
+		if err := s.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	currents := map[string][]Record{}
+	desireds := map[string][]RecordSpec{}
+	keys := []string{}
+	for _, r := range current {
+		if managedByConoha(r.Name, r.Type, origin) {
+			continue
+		}
+		k := recordKey(r.Name, r.Type)
+		if _, ok := currents[k]; !ok {
+			if _, ok := desireds[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		currents[k] = append(currents[k], r)
+	}
+	for _, s := range desired {
+		s.Type = strings.ToUpper(s.Type)
+		s.Name = strings.ToLower(fqdn(s.Name))
+		k := recordKey(s.Name, s.Type)
+		if _, ok := desireds[k]; !ok {
+			if _, ok := currents[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		desireds[k] = append(desireds[k], s)
+	}
+	sort.Strings(keys)
+
+	plan := ZonePlan{Origin: origin}
+	for _, k := range keys {
+		cs := currents[k]
+		ds, managed := desireds[k]
+		if !managed {
+			if !opts.IgnoreUnmanaged {
+				plan.Deletes = append(plan.Deletes, cs...)
+			}
+			continue
+		}
+		// 一致するレコードは変更しない
+		used := make([]bool, len(cs))
+		rest := []RecordSpec{}
+		for _, d := range ds {
+			found := false
+			for i := range cs {
+				if !used[i] && sameRecord(&cs[i], &d) {
+					used[i] = true
+					found = true
+					break
+				}
+			}
+			if !found {
+				rest = append(rest, d)
+			}
+		}
+		// データが同じでTTLなどが異なるレコードを優先して更新する
+		pending := []RecordSpec{}
+		for _, d := range rest {
+			found := false
+			for i := range cs {
+				if !used[i] && sameData(&cs[i], &d) {
+					used[i] = true
+					found = true
+					plan.Updates = append(plan.Updates, ZoneUpdate{Current: cs[i], Desired: d})
+					break
+				}
+			}
+			if !found {
+				pending = append(pending, d)
+			}
+		}
+		for _, d := range pending {
+			found := false
+			for i := range cs {
+				if !used[i] {
+					used[i] = true
+					found = true
+					plan.Updates = append(plan.Updates, ZoneUpdate{Current: cs[i], Desired: d})
+					break
+				}
+			}
+			if !found {
+				plan.Creates = append(plan.Creates, d)
+			}
+		}
+		for i := range cs {
+			if !used[i] {
+				plan.Deletes = append(plan.Deletes, cs[i])
+			}
+		}
+	}
+	if opts.MaxDeletes > 0 && len(plan.Deletes) > opts.MaxDeletes {
+		return &plan, fmt.Errorf(`%w: %d deletions planned, limit is %d`, ErrTooManyDeletes, len(plan.Deletes), opts.MaxDeletes)
+	}
+	return &plan, nil
+}
+
+func (p *ZonePlan) Empty() bool {
+	return len(p.Creates) == 0 && len(p.Updates) == 0 && len(p.Deletes) == 0
+}
+
+// 変更内容を差分形式で出力する
+func (p *ZonePlan) Diff() string {
+	b := strings.Builder{}
+	line := func(mark, name string, ttl int, typ, data string) {
+		t := ""
+		if ttl > 0 {
+			t = fmt.Sprintf(" %d", ttl)
+		}
+		fmt.Fprintf(&b, "%s %s%s %s %s\n", mark, relativeName(name, p.Origin), t, typ, data)
+	}
+	for _, r := range p.Deletes {
+		line("-", r.Name, r.Ttl, r.Type, rdata(r.Type, r.Data, r.Priority, r.Weight, r.Port))
+	}
+	for _, u := range p.Updates {
+		r, s := u.Current, u.Desired
+		line("-", r.Name, r.Ttl, r.Type, rdata(r.Type, r.Data, r.Priority, r.Weight, r.Port))
+		line("+", s.Name, s.Ttl, s.Type, rdata(s.Type, s.Data, s.Priority, s.Weight, s.Port))
+	}
+	for _, s := range p.Creates {
+		line("+", s.Name, s.Ttl, s.Type, rdata(s.Type, s.Data, s.Priority, s.Weight, s.Port))
+	}
+	fmt.Fprintf(&b, "%d to create, %d to update, %d to delete\n", len(p.Creates), len(p.Updates), len(p.Deletes))
+	return b.String()
+}
+
+// ゾーン同期の計画作成
+func (api *V3) PlanZoneSync(domainId uuid.UUID, desired []RecordSpec, opts *ZoneSyncOptions) (*ZonePlan, error) {
+	domain, err := api.GetDomain(domainId)
+	if err != nil {
+		return nil, err
+	}
+	current, err := api.getAllRecords(domainId)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := PlanZone(domain.Name, current, desired, opts)
+	if plan != nil {
+		plan.DomainId = domainId
+	}
+	return plan, err
+}
+
+// 計画に従ってレコードを変更する
+// AをCNAMEに置き換える場合など、同じ名前の他のタイプと共存できないため削除を先に行う
+// エラーが発生した時点で中断し、それまでの結果を返す
+func (api *V3) ApplyZonePlan(plan *ZonePlan) (*ZoneApplyResult, error) {
+	result := ZoneApplyResult{}
+	for _, r := range plan.Deletes {
+		err := api.DeleteRecord(plan.DomainId, r.Uuid)
+		if err != nil {
+			return &result, err
+		}
+		result.Deleted = append(result.Deleted, r)
+	}
+	for _, u := range plan.Updates {
+		v, err := api.UpdateRecordBySpec(plan.DomainId, u.Current.Uuid, &u.Desired)
+		if err != nil {
+			return &result, err
+		}
+		result.Updated = append(result.Updated, Record(*v))
+	}
+	for _, s := range plan.Creates {
+		v, err := api.CreateRecordBySpec(plan.DomainId, &s)
+		if err != nil {
+			return &result, err
+		}
+		result.Created = append(result.Created, Record(*v))
+	}
+	return &result, nil
+}
+
+// ゾーン同期
+func (api *V3) SyncZone(domainId uuid.UUID, desired []RecordSpec, opts *ZoneSyncOptions) (*ZonePlan, *ZoneApplyResult, error) {
+	plan, err := api.PlanZoneSync(domainId, desired, opts)
+	if err != nil {
+		return plan, nil, err
+	}
+	result, err := api.ApplyZonePlan(plan)
+	return plan, result, err
+}
@@ -0,0 +1,117 @@
+package conoha
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPlanZone(t *testing.T) {
+	current := []Record{
+		{Uuid: uuid.New(), Name: "example.com.", Type: "SOA", Data: "ns1.conoha.io. hostmaster.example.com. 1 3600 900 1209600 300"},
+		{Uuid: uuid.New(), Name: "example.com.", Type: "NS", Data: "ns1.conoha.io."},
+		{Uuid: uuid.New(), Name: "www.example.com.", Type: "A", Data: "203.0.113.5", Ttl: 300},
+		{Uuid: uuid.New(), Name: "www.example.com.", Type: "A", Data: "203.0.113.6", Ttl: 300},
+		{Uuid: uuid.New(), Name: "api.example.com.", Type: "A", Data: "203.0.113.7", Ttl: 300},
+		{Uuid: uuid.New(), Name: "example.com.", Type: "MX", Data: "mail.example.com.", Priority: 10},
+		{Uuid: uuid.New(), Name: "legacy.example.com.", Type: "CNAME", Data: "www.example.com."},
+	}
+	desired := []RecordSpec{
+		*NewARecord("www.example.com", "203.0.113.5").WithTtl(300),
+		*NewARecord("WWW.example.com", "203.0.113.8").WithTtl(300),
+		*NewARecord("api.example.com", "203.0.113.7").WithTtl(60),
+		*NewMXRecord("example.com", "MAIL.example.com", 10),
+		*NewTXTRecord("example.com", "v=spf1 -all"),
+		// SOAと頂点のNSは無視する
+		{Name: "example.com", Type: "soa", Data: "ns1.example.net. hostmaster.example.com. 1 3600 900 1209600 300"},
+		*NewNSRecord("example.com", "ns1.example.net"),
+	}
+	plan, err := PlanZone("example.com", current, desired, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Creates) != 1 || plan.Creates[0].Type != "TXT" {
+		t.Errorf("Creates: %v", plan.Creates)
+	}
+	if len(plan.Updates) != 2 {
+		t.Fatalf("Updates: %v", plan.Updates)
+	}
+	if u := plan.Updates[0]; u.Current.Data != "203.0.113.7" || u.Desired.Ttl != 60 {
+		t.Errorf("Updates[0]: %v", u)
+	}
+	if u := plan.Updates[1]; u.Current.Data != "203.0.113.6" || u.Desired.Data != "203.0.113.8" {
+		t.Errorf("Updates[1]: %v", u)
+	}
+	if len(plan.Deletes) != 1 || plan.Deletes[0].Name != "legacy.example.com." {
+		t.Errorf("Deletes: %v", plan.Deletes)
+	}
+	diff := plan.Diff()
+	for _, line := range []string{"- legacy CNAME www.example.com.", "+ www 300 A 203.0.113.8", "1 to create, 2 to update, 1 to delete"} {
+		if !strings.Contains(diff, line) {
+			t.Errorf("%s is not in diff:\n%s", line, diff)
+		}
+	}
+
+	plan, err = PlanZone("example.com", current, desired, &ZoneSyncOptions{IgnoreUnmanaged: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Deletes) != 0 {
+		t.Errorf("Deletes: %v", plan.Deletes)
+	}
+
+	_, err = PlanZone("example.com", current, desired[:1], &ZoneSyncOptions{MaxDeletes: 2})
+	if !errors.Is(err, ErrTooManyDeletes) {
+		t.Errorf("ErrTooManyDeletes expected: %v", err)
+	}
+}
+
+func TestPlanZoneNoChanges(t *testing.T) {
+	current := []Record{
+		{Uuid: uuid.New(), Name: "www.example.com.", Type: "AAAA", Data: "2001:0db8::0001"},
+		{Uuid: uuid.New(), Name: "example.com.", Type: "TXT", Data: `"v=spf1 -all"`},
+	}
+	desired := []RecordSpec{
+		*NewAAAARecord("www.example.com", "2001:db8::1"),
+		*NewTXTRecord("example.com", "v=spf1 -all"),
+	}
+	plan, err := PlanZone("example.com.", current, desired, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Empty() {
+		t.Errorf("plan should be empty:\n%s", plan.Diff())
+	}
+}
+
+func TestSyncZoneReplaceType(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	d := s.addDomain("example.com")
+	s.addRecord(d, Record{Name: "www.example.com.", Type: "A", Data: "203.0.113.5"})
+	s.addRecord(d, Record{Name: "www.example.com.", Type: "A", Data: "203.0.113.6"})
+	s.addRecord(d, Record{Name: "api.example.com.", Type: "A", Data: "203.0.113.7"})
+
+	// AをCNAMEに置き換える場合は先にAを削除する
+	desired := []RecordSpec{
+		*NewCNAMERecord("www.example.com", "lb.example.net"),
+		*NewARecord("api.example.com", "203.0.113.7"),
+	}
+	plan, result, err := api.SyncZone(d.Uuid, desired, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Creates) != 1 || len(plan.Deletes) != 2 || len(result.Created) != 1 || len(result.Deleted) != 2 {
+		t.Errorf("plan: %+v, result: %+v", plan, result)
+	}
+	if r := s.find("www.example.com", "A"); len(r) != 0 {
+		t.Errorf("A: %v", r)
+	}
+	if r := s.find("www.example.com", "CNAME"); len(r) != 1 || r[0].Data != "lb.example.net." {
+		t.Errorf("CNAME: %v", r)
+	}
+	if r := s.find("api.example.com", "A"); len(r) != 1 {
+		t.Errorf("api: %v", r)
+	}
+}
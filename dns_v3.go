@@ -1,9 +1,11 @@
 package conoha
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,6 +13,8 @@ import (
 	"github.com/google/uuid"
 )
 
+var ErrDomainNotFound = errors.New(`domain not found`)
+
 type (
 	Domain struct {
 		Uuid      uuid.UUID `json:"uuid"`
@@ -42,6 +46,7 @@ type (
 		Priority string `json:"priority,omitempty"`
 		Weight   string `json:"weight,omitempty"`
 		Port     string `json:"port,omitempty"`
+		Ttl      int    `json:"ttl,omitempty"`
 	}
 	GetDomainsResponse struct {
 		Domains    []Domain `json:"domains"`
@@ -60,7 +65,7 @@ type (
 )
 
 func (api *V3) GetDomains(limit, offset int, sort, key string) (*GetDomainsResponse, error) {
-	endpoint := api.Endpoints.Dns
+	endpoint := *api.Endpoints.Dns
 	endpoint.Path = "/v1/domains"
 	if limit < 1 {
 		limit = 10
@@ -79,7 +84,13 @@ func (api *V3) GetDomains(limit, offset int, sort, key string) (*GetDomainsRespo
 	default:
 		key = "created_at"
 	}
-	client := annette.New(endpoint)
+	endpoint.RawQuery = url.Values{
+		"limit":     {strconv.Itoa(limit)},
+		"offset":    {strconv.Itoa(offset)},
+		"sort_type": {sort},
+		"sort_key":  {key},
+	}.Encode()
+	client := annette.New(&endpoint)
 	client.Header.Set("Accept", "application/json")
 	client.Header.Set("X-Auth-Token", api.Token)
 	res, err := client.Get()
@@ -102,9 +113,9 @@ func (api *V3) GetDomains(limit, offset int, sort, key string) (*GetDomainsRespo
 }
 
 func (api *V3) DeleteDomain(domainId uuid.UUID) error {
-	endpoint := api.Endpoints.Dns
+	endpoint := *api.Endpoints.Dns
 	endpoint.Path = fmt.Sprintf("/v1/domains/%s", domainId)
-	client := annette.New(endpoint)
+	client := annette.New(&endpoint)
 	client.Header.Set("Accept", "application/json")
 	client.Header.Set("X-Auth-Token", api.Token)
 	res, err := client.Delete()
@@ -118,13 +129,13 @@ func (api *V3) DeleteDomain(domainId uuid.UUID) error {
 }
 
 func (api *V3) UpdateDomain(domainId uuid.UUID, email string, ttl int) (*UpdateDomainResponse, error) {
-	endpoint := api.Endpoints.Dns
+	endpoint := *api.Endpoints.Dns
 	endpoint.Path = fmt.Sprintf("/v1/domains/%s", domainId)
 	body := fmt.Sprintf(`{
 		"ttl": %d,
 		"email": "%s"
 	}`, ttl, email)
-	client := annette.New(endpoint)
+	client := annette.New(&endpoint)
 	client.Header.Set("Accept", "application/json")
 	client.Header.Set("Content-Type", "application/json")
 	client.Header.Set("X-Auth-Token", api.Token)
@@ -146,7 +157,7 @@ func (api *V3) UpdateDomain(domainId uuid.UUID, email string, ttl int) (*UpdateD
 }
 
 func (api *V3) CreateDomain(domain, email string, ttl int) (*CreateDomainResponse, error) {
-	endpoint := api.Endpoints.Dns
+	endpoint := *api.Endpoints.Dns
 	endpoint.Path = "/v1/domains"
 	domain = strings.Trim(domain, "\r\n\t\v .") + "."
 	body := fmt.Sprintf(`{
@@ -154,7 +165,7 @@ func (api *V3) CreateDomain(domain, email string, ttl int) (*CreateDomainRespons
 		"ttl": %d,
 		"email": "%s"
 	}`, domain, ttl, email)
-	client := annette.New(endpoint)
+	client := annette.New(&endpoint)
 	client.Header.Set("Accept", "application/json")
 	client.Header.Set("Content-Type", "application/json")
 	client.Header.Set("X-Auth-Token", api.Token)
@@ -176,9 +187,9 @@ func (api *V3) CreateDomain(domain, email string, ttl int) (*CreateDomainRespons
 }
 
 func (api *V3) GetDomain(domainId uuid.UUID) (*GetDomainResponse, error) {
-	endpoint := api.Endpoints.Dns
+	endpoint := *api.Endpoints.Dns
 	endpoint.Path = fmt.Sprintf(`/v1/domains/%s`, domainId)
-	client := annette.New(endpoint)
+	client := annette.New(&endpoint)
 	client.Header.Set("Accept", "application/json")
 	client.Header.Set("X-Auth-Token", api.Token)
 	res, err := client.Get()
@@ -199,7 +210,7 @@ func (api *V3) GetDomain(domainId uuid.UUID) (*GetDomainResponse, error) {
 }
 
 func (api *V3) GetRecords(domainId uuid.UUID, limit, offset int, sort, key string) (*GetRecordsResponse, error) {
-	endpoint := api.Endpoints.Dns
+	endpoint := *api.Endpoints.Dns
 	endpoint.Path = fmt.Sprintf(`/v1/domains/%s/records`, domainId)
 	if limit < 1 {
 		limit = 10
@@ -213,12 +224,18 @@ func (api *V3) GetRecords(domainId uuid.UUID, limit, offset int, sort, key strin
 	}
 	key = strings.ToLower(key)
 	switch key {
-	case "uuid", "name", "project_id", "serial", "email", "created_at", "updated_at":
+	case "uuid", "name", "type", "data", "ttl", "project_id", "serial", "email", "created_at", "updated_at":
 		// Do Nothing
 	default:
 		key = "created_at"
 	}
-	client := annette.New(endpoint)
+	endpoint.RawQuery = url.Values{
+		"limit":     {strconv.Itoa(limit)},
+		"offset":    {strconv.Itoa(offset)},
+		"sort_type": {sort},
+		"sort_key":  {key},
+	}.Encode()
+	client := annette.New(&endpoint)
 	client.Header.Set("Accept", "application/json")
 	client.Header.Set("X-Auth-Token", api.Token)
 	res, err := client.Get()
@@ -259,25 +276,12 @@ func (api *V3) CreateRecord(domainId uuid.UUID, name, recType, data, priority, w
 	default:
 		req.Type = recType
 	}
-	endpoint := api.Endpoints.Dns
-	endpoint.Path = fmt.Sprintf(`/v1/domains/%s/records`, domainId)
-	body, err := json.Marshal(req)
-	if err != nil {
-		return nil, err
-	}
-	client := annette.New(endpoint)
-	client.Header.Set("Accept", "application/json")
-	client.Header.Set("Content-Type", "application/json")
-	client.Header.Set("X-Auth-Token", api.Token)
-	res, err := client.Post(bytes.NewReader(body))
-	if err != nil {
-		return nil, err
-	}
-	if !res.IsStatus200() {
-		return nil, toError(res.Binary())
-	}
+	return api.createRecord(domainId, req)
+}
+
+func (api *V3) createRecord(domainId uuid.UUID, req recordRequest) (*CreateRecordResponse, error) {
 	var v CreateRecordResponse
-	err = json.Unmarshal(res.Binary(), &v)
+	err := api.request(api.Endpoints.Dns, "POST", fmt.Sprintf(`/v1/domains/%s/records`, domainId), nil, req, 200, &v)
 	if err != nil {
 		return nil, err
 	}
@@ -287,9 +291,9 @@ func (api *V3) CreateRecord(domainId uuid.UUID, name, recType, data, priority, w
 }
 
 func (api *V3) DeleteRecord(domainId, recordId uuid.UUID) error {
-	endpoint := api.Endpoints.Dns
+	endpoint := *api.Endpoints.Dns
 	endpoint.Path = fmt.Sprintf("/v1/domains/%s/records/%s", domainId, recordId)
-	client := annette.New(endpoint)
+	client := annette.New(&endpoint)
 	client.Header.Set("Accept", "application/json")
 	client.Header.Set("X-Auth-Token", api.Token)
 	res, err := client.Delete()
@@ -303,13 +307,6 @@ func (api *V3) DeleteRecord(domainId, recordId uuid.UUID) error {
 }
 
 func (api *V3) UpdateRecord(domainId, recordId uuid.UUID, name, recType, data, priority, weight, port string) (*UpdateRecordResponse, error) {
-	endpoint := api.Endpoints.Dns
-	endpoint.Path = fmt.Sprintf("/v1/domains/%s/records/%s", domainId, recordId)
-	client := annette.New(endpoint)
-	client.Header.Set("Accept", "application/json")
-	client.Header.Set("Content-Type", "application/json")
-	client.Header.Set("X-Auth-Token", api.Token)
-
 	// request data
 	req := recordRequest{}
 	name = strings.Trim(name, "\r\n\t\v .")
@@ -333,19 +330,12 @@ func (api *V3) UpdateRecord(domainId, recordId uuid.UUID, name, recType, data, p
 	default:
 		req.Type = recType
 	}
-	body, err := json.Marshal(req)
-	if err != nil {
-		return nil, err
-	}
-	res, err := client.Put(bytes.NewReader(body))
-	if err != nil {
-		return nil, err
-	}
-	if !res.IsStatus200() {
-		return nil, toError(res.Binary())
-	}
+	return api.updateRecord(domainId, recordId, req)
+}
+
+func (api *V3) updateRecord(domainId, recordId uuid.UUID, req recordRequest) (*UpdateRecordResponse, error) {
 	var v UpdateRecordResponse
-	err = json.Unmarshal(res.Binary(), &v)
+	err := api.request(api.Endpoints.Dns, "PUT", fmt.Sprintf("/v1/domains/%s/records/%s", domainId, recordId), nil, req, 200, &v)
 	if err != nil {
 		return nil, err
 	}
@@ -355,9 +345,9 @@ func (api *V3) UpdateRecord(domainId, recordId uuid.UUID, name, recType, data, p
 }
 
 func (api *V3) GetRecord(domainId, recordId uuid.UUID) (*GetRecordResponse, error) {
-	endpoint := api.Endpoints.Dns
+	endpoint := *api.Endpoints.Dns
 	endpoint.Path = fmt.Sprintf(`/v1/domains/%s/records/%s`, domainId, recordId)
-	client := annette.New(endpoint)
+	client := annette.New(&endpoint)
 	client.Header.Set("Accept", "application/json")
 	client.Header.Set("X-Auth-Token", api.Token)
 	res, err := client.Get()
@@ -376,3 +366,62 @@ func (api *V3) GetRecord(domainId, recordId uuid.UUID) (*GetRecordResponse, erro
 	v.UpdatedAt = toJst(v.UpdatedAt)
 	return &v, nil
 }
+
+// ドメイン一覧を全件取得する
+func (api *V3) getAllDomains() ([]Domain, error) {
+	domains := []Domain{}
+	for {
+		v, err := api.GetDomains(100, len(domains), "asc", "name")
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, v.Domains...)
+		if len(v.Domains) == 0 || len(domains) >= v.TotalCount {
+			break
+		}
+	}
+	return domains, nil
+}
+
+// レコード一覧を全件取得する
+func (api *V3) getAllRecords(domainId uuid.UUID) ([]Record, error) {
+	records := []Record{}
+	for {
+		v, err := api.GetRecords(domainId, 100, len(records), "asc", "name")
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, v.Records...)
+		if len(v.Records) == 0 || len(records) >= v.TotalCount {
+			break
+		}
+	}
+	return records, nil
+}
+
+// 指定した名前を含むドメインを取得する(最も長く一致するドメイン)
+func (api *V3) findDomain(name string) (*Domain, error) {
+	domains, err := api.getAllDomains()
+	if err != nil {
+		return nil, err
+	}
+	return matchDomain(domains, name)
+}
+
+func matchDomain(domains []Domain, name string) (*Domain, error) {
+	name = strings.ToLower(fqdn(name))
+	var found *Domain
+	for k, d := range domains {
+		zone := strings.ToLower(fqdn(d.Name))
+		if name != zone && !strings.HasSuffix(name, "."+zone) {
+			continue
+		}
+		if found == nil || len(zone) > len(fqdn(found.Name)) {
+			found = &domains[k]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf(`%w: %s`, ErrDomainNotFound, name)
+	}
+	return found, nil
+}
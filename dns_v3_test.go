@@ -1 +1,260 @@
 package conoha
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// テスト用のDNS APIサーバー
+type dnsTestServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	domains map[uuid.UUID]*Domain
+	records map[uuid.UUID]*Record
+	calls   map[string]int
+	fail    func(r *http.Request) bool
+	query   url.Values // 最後のリクエストのクエリ
+}
+
+func newDnsTestServer(t *testing.T) (*dnsTestServer, *V3) {
+	s := &dnsTestServer{
+		domains: map[uuid.UUID]*Domain{},
+		records: map[uuid.UUID]*Record{},
+		calls:   map[string]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	api := NewV3()
+	api.Endpoints.Dns, _ = url.Parse(s.URL)
+	return s, api
+}
+
+func (s *dnsTestServer) addDomain(name string) *Domain {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := &Domain{Uuid: uuid.New(), Name: fqdn(name), Ttl: 3600, Serial: 1, Email: "hostmaster@" + name, CreatedAt: time.Now()}
+	s.domains[d.Uuid] = d
+	s.records[uuid.New()] = &Record{DomainUuid: d.Uuid, Name: d.Name, Type: "NS", Data: "ns-a1.conoha.io."}
+	for id, r := range s.records {
+		r.Uuid = id
+	}
+	return d
+}
+
+func (s *dnsTestServer) addRecord(domain *Domain, r Record) *Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.Uuid = uuid.New()
+	r.DomainUuid = domain.Uuid
+	r.Name = fqdn(r.Name)
+	s.records[r.Uuid] = &r
+	return &r
+}
+
+// 名前とタイプが一致するレコード
+func (s *dnsTestServer) find(name, typ string) []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := []Record{}
+	for _, r := range s.records {
+		if strings.EqualFold(r.Name, fqdn(name)) && r.Type == typ {
+			records = append(records, *r)
+		}
+	}
+	sort.Slice(records, func(a, b int) bool { return records[a].Data < records[b].Data })
+	return records
+}
+
+func (s *dnsTestServer) count(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+func (s *dnsTestServer) handle(w http.ResponseWriter, r *http.Request) {
+	if s.fail != nil && s.fail(r) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"code": "InvalidParameter", "message": "failed"}`)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[r.Method]++
+	s.query = r.URL.Query()
+	paths := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	write := func(status int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+	page := func(n int) (int, int) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if limit < 1 {
+			limit = n
+		}
+		if offset > n {
+			offset = n
+		}
+		if offset+limit > n {
+			limit = n - offset
+		}
+		return offset, offset + limit
+	}
+	decode := func() Record {
+		var req recordRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		v := Record{Name: req.Name, Type: req.Type, Data: req.Data, Ttl: req.Ttl}
+		v.Priority, _ = strconv.Atoi(req.Priority)
+		v.Weight, _ = strconv.Atoi(req.Weight)
+		v.Port, _ = strconv.Atoi(req.Port)
+		return v
+	}
+	// 同じ名前・タイプ・値のレコードや、CNAMEと他のタイプのレコードが共存する変更は拒否する
+	conflict := func(n *Record) bool {
+		for _, v := range s.records {
+			if v.DomainUuid != n.DomainUuid || v.Uuid == n.Uuid || !strings.EqualFold(v.Name, n.Name) {
+				continue
+			}
+			if v.Type == n.Type && normalizeData(v.Type, v.Data) == normalizeData(n.Type, n.Data) {
+				write(400, map[string]string{"code": "RecordSetDuplicate", "message": "record is duplicated"})
+				return true
+			}
+			if (v.Type == "CNAME") != (n.Type == "CNAME") {
+				write(400, map[string]string{"code": "InvalidParameter", "message": "CNAME cannot coexist with other records"})
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case len(paths) == 2 && r.Method == http.MethodGet:
+		domains := []Domain{}
+		for _, d := range s.domains {
+			domains = append(domains, *d)
+		}
+		sort.Slice(domains, func(a, b int) bool { return domains[a].Name < domains[b].Name })
+		from, to := page(len(domains))
+		write(200, GetDomainsResponse{Domains: domains[from:to], TotalCount: len(domains)})
+	case len(paths) == 2 && r.Method == http.MethodPost:
+		var req Domain
+		json.NewDecoder(r.Body).Decode(&req)
+		d := &Domain{Uuid: uuid.New(), Name: req.Name, Ttl: req.Ttl, Email: req.Email, Serial: 1}
+		s.domains[d.Uuid] = d
+		write(200, d)
+	case len(paths) >= 3:
+		d, ok := s.domains[uuid.MustParse(paths[2])]
+		if !ok {
+			write(404, map[string]string{"code": "NotFound", "message": "domain not found"})
+			return
+		}
+		switch {
+		case len(paths) == 3 && r.Method == http.MethodGet:
+			write(200, d)
+		case len(paths) == 3 && r.Method == http.MethodDelete:
+			delete(s.domains, d.Uuid)
+			for id, v := range s.records {
+				if v.DomainUuid == d.Uuid {
+					delete(s.records, id)
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case len(paths) == 4 && r.Method == http.MethodGet:
+			records := []Record{}
+			for _, v := range s.records {
+				if v.DomainUuid == d.Uuid {
+					records = append(records, *v)
+				}
+			}
+			sort.Slice(records, func(a, b int) bool { return records[a].Uuid.String() < records[b].Uuid.String() })
+			from, to := page(len(records))
+			write(200, GetRecordsResponse{Records: records[from:to], TotalCount: len(records)})
+		case len(paths) == 4 && r.Method == http.MethodPost:
+			v := decode()
+			v.Uuid = uuid.New()
+			v.DomainUuid = d.Uuid
+			if conflict(&v) {
+				return
+			}
+			s.records[v.Uuid] = &v
+			d.Serial++
+			write(200, v)
+		case len(paths) == 5:
+			v, ok := s.records[uuid.MustParse(paths[4])]
+			if !ok {
+				write(404, map[string]string{"code": "NotFound", "message": "record not found"})
+				return
+			}
+			switch r.Method {
+			case http.MethodGet:
+				write(200, v)
+			case http.MethodPut:
+				n := decode()
+				n.Uuid = v.Uuid
+				n.DomainUuid = v.DomainUuid
+				if conflict(&n) {
+					return
+				}
+				s.records[v.Uuid] = &n
+				d.Serial++
+				write(200, n)
+			case http.MethodDelete:
+				delete(s.records, v.Uuid)
+				d.Serial++
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestGetAllRecords(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	d := s.addDomain("example.com")
+	for i := 0; i < 250; i++ {
+		s.addRecord(d, Record{Name: fmt.Sprintf("host%d.example.com", i), Type: "A", Data: "203.0.113.1"})
+	}
+	records, err := api.getAllRecords(d.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 251 {
+		t.Errorf("records: %d", len(records))
+	}
+}
+
+func TestGetRecordsQuery(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	d := s.addDomain("example.com")
+	for _, key := range []string{"type", "serial", "unknown"} {
+		if _, err := api.GetRecords(d.Uuid, 10, 0, "DESC", key); err != nil {
+			t.Fatal(err)
+		}
+		expected := key
+		if key == "unknown" {
+			expected = "created_at"
+		}
+		if s.query.Get("sort_key") != expected || s.query.Get("sort_type") != "desc" || s.query.Get("limit") != "10" {
+			t.Errorf("%s: %v", key, s.query)
+		}
+	}
+	if _, err := api.GetDomains(5, 0, "asc", "name"); err != nil {
+		t.Fatal(err)
+	}
+	// 共有しているエンドポイントのクエリは変更しない
+	if api.Endpoints.Dns.RawQuery != "" {
+		t.Errorf("RawQuery: %s", api.Endpoints.Dns.RawQuery)
+	}
+}
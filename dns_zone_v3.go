@@ -0,0 +1,446 @@
+package conoha
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type (
+	Zone struct {
+		Origin      string
+		Ttl         int
+		Records     []RecordSpec
+		Skipped     []ZoneEntry // ConoHaが管理するため取り込まないレコード(SOA, 頂点のNS)
+		Unsupported []ZoneEntry // 未対応のレコードタイプ
+	}
+	ZoneEntry struct {
+		Line int
+		Name string
+		Type string
+		Text string
+	}
+	ImportZoneResult struct {
+		Domain      *CreateDomainResponse
+		Created     []Record
+		Failed      []ImportZoneError
+		Skipped     []ZoneEntry
+		Unsupported []ZoneEntry
+	}
+	ImportZoneError struct {
+		Record RecordSpec
+		Error  error
+	}
+)
+
+var zoneSupportedTypes = map[string]bool{
+	"A": true, "AAAA": true, "CNAME": true, "MX": true, "NS": true,
+	"TXT": true, "SRV": true, "CAA": true, "PTR": true,
+}
+
+// ゾーンファイル形式で出力する
+func WriteZone(w io.Writer, domain *Domain, records []Record) error {
+	origin := fqdn(domain.Name)
+	sorted := make([]Record, len(records))
+	copy(sorted, records)
+	order := map[string]int{"SOA": 0, "NS": 1}
+	sort.SliceStable(sorted, func(a, b int) bool {
+		oa, ok := order[sorted[a].Type]
+		if !ok {
+			oa = 2
+		}
+		ob, ok := order[sorted[b].Type]
+		if !ok {
+			ob = 2
+		}
+		if oa != ob {
+			return oa < ob
+		}
+		if sorted[a].Name != sorted[b].Name {
+			return sorted[a].Name < sorted[b].Name
+		}
+		return sorted[a].Type < sorted[b].Type
+	})
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "$ORIGIN %s\n", origin)
+	if domain.Ttl > 0 {
+		fmt.Fprintf(b, "$TTL %d\n", domain.Ttl)
+	}
+	for _, r := range sorted {
+		name := relativeName(r.Name, origin)
+		ttl := ""
+		if r.Ttl > 0 && r.Ttl != domain.Ttl {
+			ttl = strconv.Itoa(r.Ttl)
+		}
+		data := rdata(r.Type, r.Data, r.Priority, r.Weight, r.Port)
+		fmt.Fprintf(b, "%-24s %-6s IN %-6s %s\n", name, ttl, r.Type, data)
+	}
+	return b.Flush()
+}
+
+// ゾーンファイル形式のRDATA
+func rdata(typ, data string, priority, weight, port int) string {
+	switch typ {
+	case "MX":
+		return fmt.Sprintf("%d %s", priority, data)
+	case "SRV":
+		return fmt.Sprintf("%d %d %d %s", priority, weight, port, data)
+	case "TXT":
+		if !strings.HasPrefix(data, `"`) {
+			return quoteTxt(data)
+		}
+	}
+	return data
+}
+
+func relativeName(name, origin string) string {
+	name = fqdn(name)
+	if strings.EqualFold(name, origin) {
+		return "@"
+	}
+	if strings.HasSuffix(strings.ToLower(name), "."+strings.ToLower(origin)) {
+		return name[:len(name)-len(origin)-1]
+	}
+	return name
+}
+
+func absoluteName(name, origin string) string {
+	if name == "@" {
+		return origin
+	}
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	if origin == "" {
+		return name + "."
+	}
+	return name + "." + origin
+}
+
+// ゾーンエクスポート
+func (api *V3) ExportZone(domainId uuid.UUID, w io.Writer) error {
+	domain, err := api.GetDomain(domainId)
+	if err != nil {
+		return err
+	}
+	records, err := api.getAllRecords(domainId)
+	if err != nil {
+		return err
+	}
+	return WriteZone(w, (*Domain)(domain), records)
+}
+
+// ゾーンファイルを行単位のトークンに分解する
+// 括弧で複数行に渡るエントリは1つにまとめる
+func tokenizeZone(r io.Reader) ([][]string, []int, error) {
+	entries := [][]string{}
+	lines := []int{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	current := []string{}
+	start := 0
+	depth := 0
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if depth == 0 {
+			current = []string{}
+			start = lineNo
+			if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+				// 所有者名の省略
+				current = append(current, "")
+			}
+		}
+		i := 0
+		for i < len(line) {
+			c := line[i]
+			switch {
+			case c == ';':
+				i = len(line)
+			case c == ' ' || c == '\t' || c == '\r':
+				i++
+			case c == '(':
+				depth++
+				i++
+			case c == ')':
+				depth--
+				if depth < 0 {
+					return nil, nil, fmt.Errorf(`line %d: unbalanced parenthesis`, lineNo)
+				}
+				i++
+			case c == '"':
+				j := i + 1
+				for j < len(line) && line[j] != '"' {
+					if line[j] == '\\' {
+						j++
+					}
+					j++
+				}
+				if j >= len(line) {
+					return nil, nil, fmt.Errorf(`line %d: unterminated string`, lineNo)
+				}
+				current = append(current, line[i:j+1])
+				i = j + 1
+			default:
+				j := i
+				for j < len(line) && !strings.ContainsRune(" \t\r;()\"", rune(line[j])) {
+					j++
+				}
+				current = append(current, line[i:j])
+				i = j
+			}
+		}
+		if depth == 0 && (len(current) > 1 || len(current) == 1 && current[0] != "") {
+			entries = append(entries, current)
+			lines = append(lines, start)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if depth != 0 {
+		return nil, nil, fmt.Errorf(`line %d: unbalanced parenthesis`, start)
+	}
+	return entries, lines, nil
+}
+
+// TTLを秒に変換する(1h30m のような単位付きの表記に対応)
+func parseZoneTtl(s string) (int, bool) {
+	if s == "" {
+		return 0, false
+	}
+	total := 0
+	n := 0
+	digits := false
+	for _, c := range strings.ToLower(s) {
+		if c >= '0' && c <= '9' {
+			n = n*10 + int(c-'0')
+			digits = true
+			continue
+		}
+		if !digits {
+			return 0, false
+		}
+		switch c {
+		case 's':
+		case 'm':
+			n *= 60
+		case 'h':
+			n *= 3600
+		case 'd':
+			n *= 86400
+		case 'w':
+			n *= 604800
+		default:
+			return 0, false
+		}
+		total += n
+		n = 0
+		digits = false
+	}
+	return total + n, true
+}
+
+// ゾーンファイルの読み込み
+// origin が空の場合はゾーンファイルの $ORIGIN を使用する
+func ParseZone(r io.Reader, origin string) (*Zone, error) {
+	entries, lines, err := tokenizeZone(r)
+	if err != nil {
+		return nil, err
+	}
+	zone := Zone{Origin: fqdn(origin)}
+	current := zone.Origin
+	owner := ""
+	for k, tokens := range entries {
+		line := lines[k]
+		switch strings.ToUpper(tokens[0]) {
+		case "$ORIGIN":
+			if len(tokens) < 2 {
+				return nil, fmt.Errorf(`line %d: $ORIGIN without name`, line)
+			}
+			current = absoluteName(tokens[1], current)
+			if zone.Origin == "" {
+				zone.Origin = current
+			}
+			continue
+		case "$TTL":
+			ttl, ok := 0, false
+			if len(tokens) >= 2 {
+				ttl, ok = parseZoneTtl(tokens[1])
+			}
+			if !ok {
+				return nil, fmt.Errorf(`line %d: invalid $TTL`, line)
+			}
+			zone.Ttl = ttl
+			continue
+		case "$INCLUDE", "$GENERATE":
+			zone.Unsupported = append(zone.Unsupported, ZoneEntry{Line: line, Type: tokens[0], Text: strings.Join(tokens, " ")})
+			continue
+		}
+		if tokens[0] != "" {
+			owner = absoluteName(tokens[0], current)
+		}
+		if owner == "" {
+			return nil, fmt.Errorf(`line %d: no owner name`, line)
+		}
+		rest := tokens[1:]
+		ttl := 0
+		for len(rest) > 0 {
+			if v, ok := parseZoneTtl(rest[0]); ok {
+				ttl = v
+				rest = rest[1:]
+				continue
+			}
+			switch strings.ToUpper(rest[0]) {
+			case "IN", "CH", "HS":
+				rest = rest[1:]
+				continue
+			}
+			break
+		}
+		if len(rest) < 1 {
+			return nil, fmt.Errorf(`line %d: no record type`, line)
+		}
+		typ := strings.ToUpper(rest[0])
+		rdata := rest[1:]
+		entry := ZoneEntry{Line: line, Name: owner, Type: typ, Text: strings.Join(rdata, " ")}
+		if typ == "SOA" || typ == "NS" && strings.EqualFold(owner, zone.Origin) {
+			zone.Skipped = append(zone.Skipped, entry)
+			continue
+		}
+		if !zoneSupportedTypes[typ] {
+			zone.Unsupported = append(zone.Unsupported, entry)
+			continue
+		}
+		spec, err := zoneRecordSpec(owner, typ, rdata, current)
+		if err != nil {
+			return nil, fmt.Errorf(`line %d: %s`, line, err)
+		}
+		spec.Ttl = ttl
+		zone.Records = append(zone.Records, *spec)
+	}
+	if zone.Origin == "" {
+		return nil, fmt.Errorf(`no origin`)
+	}
+	return &zone, nil
+}
+
+func zoneRecordSpec(owner, typ string, rdata []string, origin string) (*RecordSpec, error) {
+	atoi := func(s string) (int, error) {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf(`invalid number "%s" in %s record`, s, typ)
+		}
+		return n, nil
+	}
+	need := map[string]int{"MX": 2, "SRV": 4, "CAA": 3}[typ]
+	if need == 0 {
+		need = 1
+	}
+	if len(rdata) < need {
+		return nil, fmt.Errorf(`too few fields in %s record`, typ)
+	}
+	switch typ {
+	case "A":
+		return NewARecord(owner, rdata[0]), nil
+	case "AAAA":
+		return NewAAAARecord(owner, rdata[0]), nil
+	case "CNAME":
+		return NewCNAMERecord(owner, absoluteName(rdata[0], origin)), nil
+	case "NS":
+		return NewNSRecord(owner, absoluteName(rdata[0], origin)), nil
+	case "PTR":
+		return NewPTRRecord(owner, absoluteName(rdata[0], origin)), nil
+	case "MX":
+		priority, err := atoi(rdata[0])
+		if err != nil {
+			return nil, err
+		}
+		return NewMXRecord(owner, absoluteName(rdata[1], origin), priority), nil
+	case "SRV":
+		priority, err := atoi(rdata[0])
+		if err != nil {
+			return nil, err
+		}
+		weight, err := atoi(rdata[1])
+		if err != nil {
+			return nil, err
+		}
+		port, err := atoi(rdata[2])
+		if err != nil {
+			return nil, err
+		}
+		return NewSRVRecord(owner, absoluteName(rdata[3], origin), priority, weight, port), nil
+	case "TXT":
+		chunks := make([]string, len(rdata))
+		for k, v := range rdata {
+			if !strings.HasPrefix(v, `"`) {
+				v = escapeTxt([]byte(v))
+			}
+			chunks[k] = v
+		}
+		return &RecordSpec{Name: owner, Type: "TXT", Data: strings.Join(chunks, " ")}, nil
+	case "CAA":
+		flags, err := atoi(rdata[0])
+		if err != nil {
+			return nil, err
+		}
+		value := strings.Join(rdata[2:], " ")
+		if strings.HasPrefix(value, `"`) {
+			value = strings.Trim(value, `"`)
+		}
+		return NewCAARecord(owner, flags, strings.ToLower(rdata[1]), value), nil
+	}
+	return nil, fmt.Errorf(`unsupported type %s`, typ)
+}
+
+// ゾーンインポート
+// ドメインを作成し、ゾーンファイルのレコードを登録する
+func (api *V3) ImportZone(r io.Reader, origin, email string) (*ImportZoneResult, error) {
+	zone, err := ParseZone(r, origin)
+	if err != nil {
+		return nil, err
+	}
+	// 登録前に全てのレコードを検証する
+	errs := []error{}
+	for _, spec := range zone.Records {
+		if err := spec.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf(`invalid records: %w`, errors.Join(errs...))
+	}
+	ttl := zone.Ttl
+	if ttl == 0 {
+		ttl = 3600
+	}
+	domain, err := api.CreateDomain(zone.Origin, email, ttl)
+	if err != nil {
+		return nil, err
+	}
+	result := ImportZoneResult{
+		Domain:      domain,
+		Skipped:     zone.Skipped,
+		Unsupported: zone.Unsupported,
+	}
+	for _, spec := range zone.Records {
+		v, err := api.CreateRecordBySpec(domain.Uuid, &spec)
+		if err != nil {
+			result.Failed = append(result.Failed, ImportZoneError{Record: spec, Error: err})
+			continue
+		}
+		result.Created = append(result.Created, Record(*v))
+	}
+	if len(result.Failed) > 0 {
+		return &result, fmt.Errorf(`%d of %d records failed`, len(result.Failed), len(zone.Records))
+	}
+	return &result, nil
+}
@@ -0,0 +1,214 @@
+package conoha
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+const zoneFile = `$ORIGIN example.com.
+$TTL 1h
+@   IN SOA ns1.example.com. hostmaster.example.com. (
+        2024050101 ; serial
+        3600       ; refresh
+        900        ; retry
+        1209600    ; expire
+        300 )      ; minimum
+    IN NS  ns1.conoha.io.
+    IN MX  10 mail
+www 300 IN A 203.0.113.5
+        IN AAAA 2001:db8::5
+ftp IN CNAME www
+@   IN TXT "v=spf1 include:_spf.example.com -all" ; spf
+_sip._tcp IN SRV 10 60 5060 sip.example.com.
+@   IN CAA 0 issue "letsencrypt.org"
+sub IN NS ns1.example.net.
+@   IN SSHFP 1 1 123456789abcdef67890123456789abcdef67890
+$ORIGIN dev.example.com.
+api IN A 203.0.113.10
+`
+
+func TestParseZone(t *testing.T) {
+	zone, err := ParseZone(strings.NewReader(zoneFile), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zone.Origin != "example.com." || zone.Ttl != 3600 {
+		t.Errorf("Origin: %s, Ttl: %d", zone.Origin, zone.Ttl)
+	}
+	if len(zone.Skipped) != 2 || len(zone.Unsupported) != 1 || zone.Unsupported[0].Type != "SSHFP" {
+		t.Errorf("Skipped: %v, Unsupported: %v", zone.Skipped, zone.Unsupported)
+	}
+	expected := []string{
+		"MX example.com. mail.example.com.",
+		"A www.example.com. 203.0.113.5",
+		"AAAA www.example.com. 2001:db8::5",
+		"CNAME ftp.example.com. www.example.com.",
+		`TXT example.com. "v=spf1 include:_spf.example.com -all"`,
+		"SRV _sip._tcp.example.com. sip.example.com.",
+		`CAA example.com. 0 issue "letsencrypt.org"`,
+		"NS sub.example.com. ns1.example.net.",
+		"A api.dev.example.com. 203.0.113.10",
+	}
+	if len(zone.Records) != len(expected) {
+		t.Fatalf("Records: %v", zone.Records)
+	}
+	for k, r := range zone.Records {
+		actual := r.Type + " " + r.Name + " " + r.Data
+		if actual != expected[k] {
+			t.Errorf("expected %s, actual %s", expected[k], actual)
+		}
+		if err := r.Validate(); err != nil {
+			t.Error(err)
+		}
+	}
+	if zone.Records[0].Priority != 10 || zone.Records[1].Ttl != 300 || zone.Records[2].Ttl != 0 {
+		t.Errorf("Priority: %d, Ttl: %d, %d", zone.Records[0].Priority, zone.Records[1].Ttl, zone.Records[2].Ttl)
+	}
+	if r := zone.Records[5]; r.Priority != 10 || r.Weight != 60 || r.Port != 5060 {
+		t.Errorf("SRV: %+v", r)
+	}
+}
+
+func TestWriteZone(t *testing.T) {
+	domain := Domain{Name: "example.com.", Ttl: 3600}
+	records := []Record{
+		{Name: "www.example.com.", Type: "A", Data: "203.0.113.5", Ttl: 300},
+		{Name: "example.com.", Type: "MX", Data: "mail.example.com.", Priority: 10, Ttl: 3600},
+		{Name: "example.com.", Type: "NS", Data: "ns1.conoha.io."},
+		{Name: "example.com.", Type: "TXT", Data: "v=spf1 -all"},
+	}
+	b := strings.Builder{}
+	err := WriteZone(&b, &domain, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zone, err := ParseZone(strings.NewReader(b.String()), "")
+	if err != nil {
+		t.Fatalf("%s\n%s", err, b.String())
+	}
+	if zone.Origin != "example.com." || zone.Ttl != 3600 || len(zone.Records) != 3 || len(zone.Skipped) != 1 {
+		t.Fatalf("%+v\n%s", zone, b.String())
+	}
+	if r := zone.Records[0]; r.Type != "MX" || r.Data != "mail.example.com." || r.Priority != 10 || r.Ttl != 0 {
+		t.Errorf("MX: %+v", r)
+	}
+	if r := zone.Records[1]; r.Type != "TXT" || r.Data != `"v=spf1 -all"` {
+		t.Errorf("TXT: %+v", r)
+	}
+	if r := zone.Records[2]; r.Name != "www.example.com." || r.Ttl != 300 {
+		t.Errorf("A: %+v", r)
+	}
+}
+
+func TestImportZone(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	result, err := api.ImportZone(strings.NewReader(zoneFile), "", "hostmaster@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, ok := s.domains[result.Domain.Uuid]
+	if !ok || d.Name != "example.com." || d.Ttl != 3600 || d.Email != "hostmaster@example.com" {
+		t.Fatalf("Domain: %+v", d)
+	}
+	if len(result.Created) != 9 || len(result.Failed) != 0 {
+		t.Errorf("Created: %d, Failed: %v", len(result.Created), result.Failed)
+	}
+	if r := s.find("www.example.com", "A"); len(r) != 1 || r[0].Data != "203.0.113.5" || r[0].Ttl != 300 || r[0].DomainUuid != d.Uuid {
+		t.Errorf("www: %+v", r)
+	}
+	if r := s.find("example.com", "MX"); len(r) != 1 || r[0].Priority != 10 {
+		t.Errorf("MX: %+v", r)
+	}
+	// SOAと頂点のNSは登録しない
+	if len(result.Skipped) != 2 || len(s.find("example.com", "NS")) != 0 || len(s.find("example.com", "SOA")) != 0 {
+		t.Errorf("Skipped: %v", result.Skipped)
+	}
+	// 未対応のタイプは行番号付きで報告し、登録しない
+	if len(result.Unsupported) != 1 {
+		t.Fatalf("Unsupported: %v", result.Unsupported)
+	}
+	if u := result.Unsupported[0]; u.Line != 18 || u.Name != "example.com." || u.Type != "SSHFP" || !strings.HasPrefix(u.Text, "1 1 ") {
+		t.Errorf("Unsupported: %+v", u)
+	}
+	if len(s.find("example.com", "SSHFP")) != 0 {
+		t.Error("SSHFP record created")
+	}
+}
+
+func TestImportZoneFailed(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	n := 0
+	s.fail = func(r *http.Request) bool {
+		if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/records") {
+			return false
+		}
+		n++
+		return n == 3
+	}
+	result, err := api.ImportZone(strings.NewReader(zoneFile), "", "hostmaster@example.com")
+	if err == nil || err.Error() != "1 of 9 records failed" {
+		t.Fatalf("error: %v", err)
+	}
+	if result == nil || result.Domain == nil || len(result.Created) != 8 || len(result.Failed) != 1 {
+		t.Fatalf("result: %+v", result)
+	}
+	if f := result.Failed[0]; f.Record.Type != "AAAA" || f.Record.Name != "www.example.com." || f.Error == nil {
+		t.Errorf("Failed: %+v", f)
+	}
+	if len(s.find("www.example.com", "AAAA")) != 0 || len(s.find("ftp.example.com", "CNAME")) != 1 {
+		t.Error("records after failure are not created")
+	}
+
+	// 不正なレコードがあればドメインを作成しない
+	s.fail = nil
+	_, err = api.ImportZone(strings.NewReader("$ORIGIN example.net.\nwww IN A 203.0.113\n"), "", "hostmaster@example.net")
+	if err == nil {
+		t.Fatal("invalid record is imported")
+	}
+	for _, d := range s.domains {
+		if d.Name == "example.net." {
+			t.Error("domain is created for invalid zone")
+		}
+	}
+}
+
+func TestExportZone(t *testing.T) {
+	s, api := newDnsTestServer(t)
+	d := s.addDomain("example.com")
+	s.addRecord(d, Record{Name: "www.example.com", Type: "A", Data: "203.0.113.5", Ttl: 300})
+	s.addRecord(d, Record{Name: "example.com", Type: "MX", Data: "mail.example.com.", Priority: 10})
+	s.addRecord(d, Record{Name: "example.com", Type: "TXT", Data: "v=spf1 -all"})
+	other := s.addDomain("example.net")
+	s.addRecord(other, Record{Name: "www.example.net", Type: "A", Data: "198.51.100.1"})
+
+	b := bytes.Buffer{}
+	if err := api.ExportZone(d.Uuid, &b); err != nil {
+		t.Fatal(err)
+	}
+	zone, err := ParseZone(&b, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zone.Origin != "example.com." || zone.Ttl != 3600 || len(zone.Records) != 3 {
+		t.Fatalf("%+v", zone)
+	}
+	// 書き出したゾーンをそのまま取り込める
+	s2, api2 := newDnsTestServer(t)
+	b.Reset()
+	api.ExportZone(d.Uuid, &b)
+	result, err := api2.ImportZone(&b, "", d.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Created) != 3 || len(s2.find("www.example.com", "A")) != 1 || len(s2.find("www.example.net", "A")) != 0 {
+		t.Errorf("Created: %v", result.Created)
+	}
+
+	if err := api.ExportZone(uuid.New(), &b); err == nil {
+		t.Error("export of unknown domain succeeded")
+	}
+}
@@ -5,4 +5,6 @@ go 1.25.0
 require (
 	github.com/elfincafe/annette v0.0.3
 	github.com/google/uuid v1.6.0
+	github.com/libdns/libdns v1.1.1
+	golang.org/x/net v0.57.0
 )
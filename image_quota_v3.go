@@ -0,0 +1,253 @@
+package conoha
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type (
+	ImageQuota struct {
+		Allowed int64 // 上限(バイト)
+		Used    int64 // 使用量(バイト)
+	}
+	ImageRetentionPolicy struct {
+		Prefixes       []string      // 世代管理の対象とするイメージ名のプレフィックス
+		KeepNewest     int           // プレフィックスごとに残す世代数(0の場合は世代管理しない)
+		UntaggedMaxAge time.Duration // タグのないイメージの保持期間(0の場合は削除しない)
+		Now            time.Time     // 基準時刻(ゼロ値の場合は現在時刻)
+	}
+	ImageCleanupItem struct {
+		Image  Image
+		Reason string
+		Error  error
+	}
+	ImageCleanupReport struct {
+		DryRun     bool
+		Deletes    []ImageCleanupItem
+		Keeps      []Image
+		FreedBytes int64
+	}
+)
+
+// 容量の文字列("550GB"など)をバイト数に変換する
+func parseCapacity(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"TB", 1 << 40},
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+	for _, u := range units {
+		if !strings.HasSuffix(s, u.suffix) {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), 64)
+		if err != nil {
+			return 0, err
+		}
+		return int64(n * float64(u.size)), nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func (q *ImageQuota) Available() int64 {
+	if q.Allowed <= q.Used {
+		return 0
+	}
+	return q.Allowed - q.Used
+}
+
+// 指定サイズのイメージがアップロード可能か
+func (q *ImageQuota) Fits(size int64) bool {
+	return size <= q.Available()
+}
+
+func (q *ImageQuota) String() string {
+	return fmt.Sprintf(`Used:%d, Allowed:%d, Available:%d`, q.Used, q.Allowed, q.Available())
+}
+
+// イメージ容量の使用状況取得
+func (api *V3) GetImageQuota() (*ImageQuota, error) {
+	c, err := api.GetImageCapacity()
+	if err != nil {
+		return nil, err
+	}
+	u, err := api.GetUsedImageCapacity()
+	if err != nil {
+		return nil, err
+	}
+	q := ImageQuota{}
+	for _, v := range c.Quota {
+		n, err := parseCapacity(v.ImageSize)
+		if err != nil {
+			return nil, err
+		}
+		q.Allowed += n
+	}
+	for _, v := range u.Images {
+		q.Used += v.Size
+	}
+	return &q, nil
+}
+
+// 指定サイズのイメージがアップロード可能か
+func (api *V3) CanUploadImage(size int64) (bool, *ImageQuota, error) {
+	q, err := api.GetImageQuota()
+	if err != nil {
+		return false, nil, err
+	}
+	return q.Fits(size), q, nil
+}
+
+// 削除対象のイメージを判定する
+func (p *ImageRetentionPolicy) Plan(images []Image) *ImageCleanupReport {
+	now := p.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	report := ImageCleanupReport{DryRun: true}
+	reasons := map[uuid.UUID]string{}
+
+	// プレフィックスごとの世代管理
+	if p.KeepNewest > 0 {
+		groups := map[string][]Image{}
+		for _, i := range images {
+			prefix := p.prefixOf(i.Name)
+			if prefix == "" || !deletableImage(&i) {
+				continue
+			}
+			groups[prefix] = append(groups[prefix], i)
+		}
+		for prefix, g := range groups {
+			sort.SliceStable(g, func(a, b int) bool {
+				return g[a].CreatedAt.After(g[b].CreatedAt)
+			})
+			for n, i := range g {
+				if n < p.KeepNewest {
+					continue
+				}
+				reasons[i.Id] = fmt.Sprintf(`older than newest %d of "%s"`, p.KeepNewest, prefix)
+			}
+		}
+	}
+
+	// タグのない古いイメージ
+	if p.UntaggedMaxAge > 0 {
+		for _, i := range images {
+			if _, ok := reasons[i.Id]; ok || len(i.Tags) > 0 || !deletableImage(&i) {
+				continue
+			}
+			if now.Sub(i.CreatedAt) > p.UntaggedMaxAge {
+				reasons[i.Id] = fmt.Sprintf(`untagged and older than %s`, p.UntaggedMaxAge)
+			}
+		}
+	}
+
+	for _, i := range images {
+		reason, ok := reasons[i.Id]
+		if !ok {
+			report.Keeps = append(report.Keeps, i)
+			continue
+		}
+		report.Deletes = append(report.Deletes, ImageCleanupItem{Image: i, Reason: reason})
+		report.FreedBytes += i.Size
+	}
+	sort.SliceStable(report.Deletes, func(a, b int) bool {
+		return report.Deletes[a].Image.CreatedAt.Before(report.Deletes[b].Image.CreatedAt)
+	})
+	return &report
+}
+
+// 最も長く一致するプレフィックスを返す
+func (p *ImageRetentionPolicy) prefixOf(name string) string {
+	prefix := ""
+	for _, v := range p.Prefixes {
+		if strings.HasPrefix(name, v) && len(v) > len(prefix) {
+			prefix = v
+		}
+	}
+	return prefix
+}
+
+// 保護されたイメージや処理中のイメージは削除対象にしない
+func deletableImage(i *Image) bool {
+	if i.Protected {
+		return false
+	}
+	switch i.Status {
+	case "saving", "importing", "uploading", "pending_delete", "deleted":
+		return false
+	}
+	return true
+}
+
+func (r *ImageCleanupReport) String() string {
+	b := strings.Builder{}
+	mode := ""
+	if r.DryRun {
+		mode = " (dry run)"
+	}
+	fmt.Fprintf(&b, "Delete %d images, keep %d images, free %d bytes%s\n", len(r.Deletes), len(r.Keeps), r.FreedBytes, mode)
+	for _, d := range r.Deletes {
+		fmt.Fprintf(&b, "- %s %s %s %d bytes: %s", d.Image.Id, d.Image.Name, d.Image.CreatedAt.Format(time.RFC3339), d.Image.Size, d.Reason)
+		if d.Error != nil {
+			fmt.Fprintf(&b, " [%s]", d.Error)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// 自プロジェクトのイメージを全件取得する
+func (api *V3) getOwnImages() ([]Image, error) {
+	images := []Image{}
+	filter := ImageFilter{Owner: api.TenantId, Visibility: "private", Limit: 100}
+	for {
+		v, err := api.GetImagesByFilter(&filter)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, v.Images...)
+		if v.Next == "" || len(v.Images) == 0 {
+			break
+		}
+		filter.Marker = v.Images[len(v.Images)-1].Id
+	}
+	return images, nil
+}
+
+// 保持ポリシーに従ってイメージを削除する
+// dryRun の場合は削除対象の判定のみ行う
+func (api *V3) CleanupImages(policy *ImageRetentionPolicy, dryRun bool) (*ImageCleanupReport, error) {
+	images, err := api.getOwnImages()
+	if err != nil {
+		return nil, err
+	}
+	report := policy.Plan(images)
+	report.DryRun = dryRun
+	if dryRun {
+		return report, nil
+	}
+	report.FreedBytes = 0
+	var last error
+	for k, d := range report.Deletes {
+		err = api.DeleteImage(d.Image.Id)
+		if err != nil {
+			report.Deletes[k].Error = err
+			last = err
+			continue
+		}
+		report.FreedBytes += d.Image.Size
+	}
+	return report, last
+}
@@ -0,0 +1,175 @@
+package conoha
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseCapacity(t *testing.T) {
+	tests := map[string]int64{
+		"550GB":  550 << 30,
+		"1.5 TB": 3 << 39,
+		"100MB":  100 << 20,
+		"1024":   1024,
+	}
+	for s, expected := range tests {
+		n, err := parseCapacity(s)
+		if err != nil {
+			t.Errorf("%s: %s", s, err)
+		} else if n != expected {
+			t.Errorf("%s: expected %d, actual %d", s, expected, n)
+		}
+	}
+	if _, err := parseCapacity("large"); err == nil {
+		t.Errorf("large: error expected")
+	}
+}
+
+func TestImageQuotaFits(t *testing.T) {
+	q := ImageQuota{Allowed: 50 << 30, Used: 48 << 30}
+	if !q.Fits(2 << 30) {
+		t.Errorf("2GB should fit: %s", q.String())
+	}
+	if q.Fits(2<<30 + 1) {
+		t.Errorf("2GB+1 should not fit: %s", q.String())
+	}
+	q.Used = 60 << 30
+	if q.Available() != 0 {
+		t.Errorf("Available: %d", q.Available())
+	}
+}
+
+func TestImageRetentionPolicyPlan(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	image := func(name string, age time.Duration, tags ...string) Image {
+		return Image{Id: uuid.New(), Name: name, Status: "active", Size: 1 << 30, CreatedAt: now.Add(-age), Tags: tags}
+	}
+	images := []Image{
+		image("nightly-app-1", 72*time.Hour, "build"),
+		image("nightly-app-2", 48*time.Hour, "build"),
+		image("nightly-app-3", 24*time.Hour, "build"),
+		image("nightly-app-db-1", 72*time.Hour, "build"),
+		image("scratch", 30*24*time.Hour),
+		image("scratch-new", time.Hour),
+		image("base", 365*24*time.Hour, "golden"),
+	}
+	images[0].Protected = true
+	policy := ImageRetentionPolicy{
+		Prefixes:       []string{"nightly-app-", "nightly-app-db-"},
+		KeepNewest:     1,
+		UntaggedMaxAge: 7 * 24 * time.Hour,
+		Now:            now,
+	}
+	report := policy.Plan(images)
+	if len(report.Deletes) != 2 {
+		t.Fatalf("Deletes: %s", report.String())
+	}
+	if report.Deletes[0].Image.Name != "scratch" || report.Deletes[1].Image.Name != "nightly-app-2" {
+		t.Errorf("Deletes: %s", report.String())
+	}
+	if report.FreedBytes != 2<<30 || len(report.Keeps) != 5 {
+		t.Errorf("FreedBytes: %d, Keeps: %d", report.FreedBytes, len(report.Keeps))
+	}
+}
+
+func TestCleanupImages(t *testing.T) {
+	now := time.Now()
+	const tenant = "0123456789abcdef0123456789abcdef"
+	image := func(name, owner, visibility string, age time.Duration, tags ...string) Image {
+		return Image{Id: uuid.New(), Name: name, Owner: owner, Visibility: visibility, Status: "active", Size: 1 << 30, CreatedAt: now.Add(-age), Tags: tags}
+	}
+	images := []Image{
+		image("scratch-1", tenant, "private", 30*24*time.Hour),
+		image("base", tenant, "private", 365*24*time.Hour, "golden"),
+		image("scratch-2", tenant, "private", 10*24*time.Hour),
+		image("shared", tenant, "public", 30*24*time.Hour),
+		image("scratch-3", tenant, "private", 20*24*time.Hour),
+		image("other", "fedcba9876543210fedcba9876543210", "private", 30*24*time.Hour),
+		image("scratch-new", tenant, "private", time.Hour),
+	}
+	failed := images[2].Id
+
+	mu := sync.Mutex{}
+	deleted := []uuid.UUID{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			q := r.URL.Query()
+			if q.Get("owner") != tenant || q.Get("visibility") != "private" {
+				t.Errorf("query: %s", r.URL.RawQuery)
+			}
+			list := []Image{}
+			for _, i := range images {
+				if i.Owner == q.Get("owner") && i.Visibility == q.Get("visibility") {
+					list = append(list, i)
+				}
+			}
+			if marker := q.Get("marker"); marker != "" {
+				k := slices.IndexFunc(list, func(i Image) bool { return i.Id.String() == marker })
+				list = list[k+1:]
+			}
+			// 2件ずつ返す
+			next := ""
+			if len(list) > 2 {
+				list = list[:2]
+				next = "/v2/images?marker=" + list[1].Id.String()
+			}
+			json.NewEncoder(w).Encode(map[string]any{"images": list, "next": next})
+		case http.MethodDelete:
+			id := uuid.MustParse(strings.TrimPrefix(r.URL.Path, "/v2/images/"))
+			deleted = append(deleted, id)
+			if id == failed {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"message": "forbidden"}`))
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+	api := NewV3()
+	api.TenantId = tenant
+	api.Endpoints.Image, _ = url.Parse(srv.URL)
+
+	policy := ImageRetentionPolicy{UntaggedMaxAge: 7 * 24 * time.Hour, Now: now}
+	report, err := api.CleanupImages(&policy, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || len(report.Deletes) != 3 || len(deleted) != 0 {
+		t.Fatalf("dry run: %s, deleted: %v", report.String(), deleted)
+	}
+
+	report, err = api.CleanupImages(&policy, false)
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	if report == nil || report.DryRun || len(report.Deletes) != 3 || len(report.Keeps) != 2 {
+		t.Fatalf("report: %+v", report)
+	}
+	// 他のオーナーや公開イメージは削除しない
+	expected := []uuid.UUID{images[0].Id, images[4].Id, images[2].Id}
+	if !slices.Equal(deleted, expected) {
+		t.Errorf("expected %v, actual %v", expected, deleted)
+	}
+	// 削除できなかったイメージはエラーとして報告し、解放量に含めない
+	for _, d := range report.Deletes {
+		if (d.Error != nil) != (d.Image.Id == failed) {
+			t.Errorf("%s: %v", d.Image.Name, d.Error)
+		}
+	}
+	if report.FreedBytes != 2<<30 {
+		t.Errorf("FreedBytes: %d", report.FreedBytes)
+	}
+}
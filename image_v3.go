@@ -1,8 +1,17 @@
 package conoha
 
 import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
+	"net/http"
 	"net/url"
 	"os"
 	"strings"
@@ -13,48 +22,58 @@ import (
 )
 
 type (
-	image struct {
-		HwRescueBus            string    `json:"hw_rescue_bus,omitempty"`
-		HwRescueDevice         string    `json:"hw_rescue_device,omitempty"`
-		HwVifMultiqueueEnabled bool      `json:"hw_vif_multiqueue_enabled,omitempty"`
-		HwQemuGuestAgent       bool      `json:"hw_qemu_guest_agent,omitempty"`
-		HwVideoModel           string    `json:"hw_video_model,omitempty"`
-		Architecture           string    `json:"architecture,omitempty"`
-		Bootable               bool      `json:"bootable"`
-		Name                   string    `json:"name"`
-		DiskFormat             string    `json:"disk_format"`
-		ContainerFormat        string    `json:"container_format"`
-		Visibility             string    `json:"visibility"`
-		Size                   int       `json:"size"`
-		VirtualSize            int       `json:"virtual_size"`
-		Status                 string    `json:"status"`
-		Checksum               int       `json:"checksum"`
-		Protected              bool      `json:"protected"`
-		MinRam                 int       `json:"min_ram"`
-		MinDisk                int       `json:"min_disk"`
-		Owner                  string    `json:"owner"`
-		OsType                 string    `json:"os_type,omitempty"`
-		OsHidden               bool      `json:"os_hidden"`
-		OsHashAlgo             string    `json:"os_hash_algo"`
-		OsHashValue            string    `json:"os_hash_value"`
-		Id                     uuid.UUID `json:"id"`
-		CreatedAt              time.Time `json:"created_at"`
-		UpdatedAt              time.Time `json:"updated_at"`
-		Tags                   []string  `json:"tags"`
-		Self                   string    `json:"self"`
-		File                   string    `json:"file"`
-		Schema                 string    `json:"schema"`
-	}
-	CreateIsoImageResponse image
+	Image struct {
+		Id              uuid.UUID         `json:"id"`
+		Name            string            `json:"name"`
+		Status          string            `json:"status"`
+		Visibility      string            `json:"visibility"`
+		Protected       bool              `json:"protected"`
+		OsHidden        bool              `json:"os_hidden"`
+		Checksum        string            `json:"checksum"`
+		OsHashAlgo      string            `json:"os_hash_algo"`
+		OsHashValue     string            `json:"os_hash_value"`
+		Owner           string            `json:"owner"`
+		Size            int64             `json:"size"`
+		VirtualSize     int64             `json:"virtual_size"`
+		MinRam          int               `json:"min_ram"`
+		MinDisk         int               `json:"min_disk"`
+		DiskFormat      string            `json:"disk_format"`
+		ContainerFormat string            `json:"container_format"`
+		CreatedAt       time.Time         `json:"created_at"`
+		UpdatedAt       time.Time         `json:"updated_at"`
+		Tags            []string          `json:"tags"`
+		DirectUrl       string            `json:"direct_url,omitempty"`
+		Locations       []ImageLocation   `json:"locations,omitempty"`
+		Stores          string            `json:"stores,omitempty"`
+		Self            string            `json:"self"`
+		File            string            `json:"file"`
+		Schema          string            `json:"schema"`
+		Properties      map[string]string `json:"-"` // 上記以外の追加プロパティ
+		// よく使われる追加プロパティ(Propertiesにも含まれる)
+		HwRescueBus            string `json:"-"`
+		HwRescueDevice         string `json:"-"`
+		HwVifMultiqueueEnabled bool   `json:"-"`
+		HwQemuGuestAgent       bool   `json:"-"`
+		HwVideoModel           string `json:"-"`
+		Architecture           string `json:"-"`
+		Bootable               bool   `json:"-"`
+		OsType                 string `json:"-"`
+	}
+	ImageLocation struct {
+		Url      string         `json:"url"`
+		Metadata map[string]any `json:"metadata"`
+	}
+	CreateIsoImageResponse = Image
 	GetImagesResponse      struct {
-		Images []image `json:"images"`
+		Images []Image `json:"images"`
 		Schema string  `json:"schema"`
 		First  string  `json:"first"`
+		Next   string  `json:"next,omitempty"`
 	}
 	GetUsedImageCapacityResponse struct {
 		Images []struct {
-			Size int
-		} ``
+			Size int64 `json:"size"`
+		} `json:"images"`
 	}
 	GetImageCapacityResponse struct {
 		Quota []struct {
@@ -62,33 +81,501 @@ type (
 		} `json:"quota"`
 	}
 	UpdateImageCapacityResponse GetImageCapacityResponse
-	GetImageResponse            image
+	GetImageResponse            = Image
+	TransferProgress            struct {
+		Sent    int64         // 転送済みバイト数
+		Total   int64         // 総バイト数(不明な場合は0)
+		Rate    float64       // 転送速度(bytes/sec)
+		Elapsed time.Duration // 経過時間
+		Eta     time.Duration // 残り時間(不明な場合は-1)
+	}
+	UploadImageOptions struct {
+		Size       int64                  // 総バイト数(不明な場合は0)
+		Progress   func(TransferProgress) // 進捗コールバック
+		Interval   time.Duration          // 進捗コールバックの最小間隔(デフォルト1秒)
+		Retries    int                    // 通信エラーと5xxの場合の再送回数(io.Seekerの場合のみ)
+		SkipVerify bool                   // ハッシュ値の検証を行わない
+	}
+	UploadImageResponse struct {
+		Size   int64
+		Md5    string
+		Sha256 string
+		Sha512 string
+	}
+	DownloadImageOptions struct {
+		Offset     int64                  // 再開位置(Rangeリクエスト)
+		Prefix     io.Reader              // 再開時に取得済みの先頭Offsetバイト(ハッシュ値の計算用)
+		Progress   func(TransferProgress) // 進捗コールバック
+		Interval   time.Duration          // 進捗コールバックの最小間隔(デフォルト1秒)
+		Retries    int                    // 通信エラーと5xxの場合の再開回数
+		SkipVerify bool                   // ハッシュ値の検証を行わない
+	}
+	DownloadImageResponse UploadImageResponse
+	ImageFilter           struct {
+		Name            string
+		Status          string // queued, saving, active, killed, deleted, deactivated
+		Visibility      string // public, private, shared, community, all
+		Owner           string
+		Tags            []string // 全てのタグを持つイメージに絞り込む
+		DiskFormat      string
+		ContainerFormat string
+		OsType          string
+		CreatedAfter    time.Time
+		CreatedBefore   time.Time // CreatedAfter と両方指定した場合は作成日時の昇順になる(Sort は指定できない)
+		UpdatedAfter    time.Time
+		Sort            []ImageSortKey
+		Limit           int
+		Marker          uuid.UUID
+	}
+	ImageSortKey struct {
+		Key string // name, status, size, created_at, updated_at など
+		Dir string // asc, desc
+	}
+	ImagePatch struct {
+		ops []imagePatchOp
+	}
+	imagePatchOp struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value,omitempty"`
+	}
+	UpdateImageResponse = Image
+	progressReader      struct {
+		r        io.Reader
+		total    int64
+		base     int64
+		sent     int64
+		started  time.Time
+		last     time.Time
+		interval time.Duration
+		callback func(TransferProgress)
+		md5      hash.Hash
+		sha256   hash.Hash
+		sha512   hash.Hash
+	}
 )
 
+// Glance v2の基本項目のキー(これ以外は追加プロパティ)
+var imageCoreKeys = map[string]bool{
+	"id": true, "name": true, "status": true, "visibility": true, "protected": true,
+	"os_hidden": true, "checksum": true, "os_hash_algo": true, "os_hash_value": true,
+	"owner": true, "size": true, "virtual_size": true, "min_ram": true, "min_disk": true,
+	"disk_format": true, "container_format": true, "created_at": true, "updated_at": true,
+	"tags": true, "direct_url": true, "locations": true, "stores": true, "self": true,
+	"file": true, "schema": true,
+}
+
+func (i *Image) UnmarshalJSON(b []byte) error {
+	type alias Image
+	var v alias
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+	var raw map[string]json.RawMessage
+	err = json.Unmarshal(b, &raw)
+	if err != nil {
+		return err
+	}
+	v.Properties = map[string]string{}
+	for k, r := range raw {
+		if imageCoreKeys[k] {
+			continue
+		}
+		var str string
+		if json.Unmarshal(r, &str) == nil {
+			v.Properties[k] = str
+		} else {
+			v.Properties[k] = string(r)
+		}
+	}
+	*i = Image(v)
+	i.HwRescueBus = i.Properties["hw_rescue_bus"]
+	i.HwRescueDevice = i.Properties["hw_rescue_device"]
+	i.HwVifMultiqueueEnabled = toBool(i.Properties["hw_vif_multiqueue_enabled"])
+	i.HwQemuGuestAgent = toBool(i.Properties["hw_qemu_guest_agent"])
+	i.HwVideoModel = i.Properties["hw_video_model"]
+	i.Architecture = i.Properties["architecture"]
+	i.Bootable = toBool(i.Properties["bootable"])
+	i.OsType = i.Properties["os_type"]
+	return nil
+}
+
+// 追加プロパティは基本項目と同じ階層に文字列として出力する
+// よく使われる追加プロパティのフィールドは Properties より優先する
+func (i Image) MarshalJSON() ([]byte, error) {
+	type alias Image
+	b, err := json.Marshal(alias(i))
+	if err != nil {
+		return nil, err
+	}
+	var v map[string]json.RawMessage
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return nil, err
+	}
+	props := map[string]string{}
+	for k, p := range i.Properties {
+		if !imageCoreKeys[k] {
+			props[k] = p
+		}
+	}
+	for k, p := range map[string]string{
+		"hw_rescue_bus":    i.HwRescueBus,
+		"hw_rescue_device": i.HwRescueDevice,
+		"hw_video_model":   i.HwVideoModel,
+		"architecture":     i.Architecture,
+		"os_type":          i.OsType,
+	} {
+		if p != "" {
+			props[k] = p
+		}
+	}
+	for k, p := range map[string]bool{
+		"hw_vif_multiqueue_enabled": i.HwVifMultiqueueEnabled,
+		"hw_qemu_guest_agent":       i.HwQemuGuestAgent,
+		"bootable":                  i.Bootable,
+	} {
+		if p != toBool(props[k]) {
+			props[k] = fmt.Sprint(p)
+		}
+	}
+	for k, p := range props {
+		v[k], err = json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(v)
+}
+
+func (i *Image) toJst() {
+	i.CreatedAt = toJst(i.CreatedAt)
+	i.UpdatedAt = toJst(i.UpdatedAt)
+}
+
+// Glanceの追加プロパティは文字列のため真偽値として解釈する
+func toBool(s string) bool {
+	switch strings.ToLower(s) {
+	case "true", "yes", "1", "on":
+		return true
+	}
+	return false
+}
+
+func newProgressReader(r io.Reader, total int64, interval time.Duration, callback func(TransferProgress)) *progressReader {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	now := time.Now()
+	return &progressReader{
+		r:        r,
+		total:    total,
+		started:  now,
+		last:     now,
+		interval: interval,
+		callback: callback,
+		md5:      md5.New(),
+		sha256:   sha256.New(),
+		sha512:   sha512.New(),
+	}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.add(b[:n])
+	return n, err
+}
+
+// 転送済みのデータをハッシュ値と転送済みバイト数に反映する
+func (p *progressReader) add(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	p.md5.Write(b)
+	p.sha256.Write(b)
+	p.sha512.Write(b)
+	p.sent += int64(len(b))
+	if time.Since(p.last) >= p.interval {
+		p.report()
+	}
+}
+
+// 書き込み先のエラー(通信エラーではないため再開しない)
+type writeError struct {
+	err error
+}
+
+func (e *writeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *writeError) Unwrap() error {
+	return e.err
+}
+
+// w に書き込めたバイト数だけ転送済みとして扱う
+type progressWriter struct {
+	p *progressReader
+	w io.Writer
+}
+
+func (pw *progressWriter) Write(b []byte) (int, error) {
+	n, err := pw.w.Write(b)
+	pw.p.add(b[:n])
+	if err == nil && n < len(b) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		return n, &writeError{err}
+	}
+	return n, nil
+}
+
+func (p *progressReader) report() {
+	p.last = time.Now()
+	if p.callback == nil {
+		return
+	}
+	v := TransferProgress{
+		Sent:    p.sent,
+		Total:   p.total,
+		Elapsed: p.last.Sub(p.started),
+		Eta:     -1,
+	}
+	if v.Elapsed > 0 {
+		v.Rate = float64(p.sent-p.base) / v.Elapsed.Seconds()
+	}
+	if p.total > 0 && v.Rate > 0 {
+		v.Eta = time.Duration(float64(p.total-p.sent) / v.Rate * float64(time.Second))
+		if v.Eta < 0 {
+			v.Eta = 0
+		}
+	}
+	p.callback(v)
+}
+
+// 取得済みのデータをハッシュ値と転送済みバイト数に反映する
+func (p *progressReader) skip(r io.Reader, n int64) error {
+	w := io.MultiWriter(p.md5, p.sha256, p.sha512)
+	m, err := io.CopyN(w, r, n)
+	if err != nil {
+		return err
+	}
+	p.sent += m
+	p.base += m
+	return nil
+}
+
+func (p *progressReader) response() *UploadImageResponse {
+	return &UploadImageResponse{
+		Size:   p.sent,
+		Md5:    hex.EncodeToString(p.md5.Sum(nil)),
+		Sha256: hex.EncodeToString(p.sha256.Sum(nil)),
+		Sha512: hex.EncodeToString(p.sha512.Sum(nil)),
+	}
+}
+
+func (u *UploadImageResponse) verify(h *Image) error {
+	if h.Size > 0 && h.Size != u.Size {
+		return fmt.Errorf(`Size mismatch: expected %d, actual %d`, h.Size, u.Size)
+	}
+	if h.Checksum != "" && !strings.EqualFold(h.Checksum, u.Md5) {
+		return fmt.Errorf(`Checksum mismatch: expected %s, actual %s`, h.Checksum, u.Md5)
+	}
+	actual := ""
+	switch strings.ToLower(h.OsHashAlgo) {
+	case "sha256":
+		actual = u.Sha256
+	case "sha512":
+		actual = u.Sha512
+	case "md5":
+		actual = u.Md5
+	default:
+		return nil
+	}
+	if h.OsHashValue != "" && !strings.EqualFold(h.OsHashValue, actual) {
+		return fmt.Errorf(`Hash mismatch(%s): expected %s, actual %s`, h.OsHashAlgo, h.OsHashValue, actual)
+	}
+	return nil
+}
+
 func (api *V3) UploadIsoImage(imageId uuid.UUID, path string) error {
-	endpoint := api.Endpoints.Image
-	endpoint.Path = fmt.Sprintf("/v2/images/%s/file", imageId)
 	f, err := os.Open(path)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	client := annette.New(endpoint)
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	_, err = api.UploadImage(context.Background(), imageId, f, &UploadImageOptions{Size: st.Size()})
+	return err
+}
+
+// イメージアップロード
+// r が io.Seeker を実装している場合は通信エラーと5xxの場合に先頭から再送する
+func (api *V3) UploadImage(ctx context.Context, imageId uuid.UUID, r io.Reader, opts *UploadImageOptions) (*UploadImageResponse, error) {
+	if opts == nil {
+		opts = &UploadImageOptions{}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	seeker, seekable := r.(io.Seeker)
+	var start int64
+	if seekable {
+		pos, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			seekable = false
+		}
+		start = pos
+	}
+	var v *UploadImageResponse
+	var err error
+	for attempt := 0; ; attempt++ {
+		v, err = api.uploadImage(ctx, imageId, r, opts)
+		if err == nil || !seekable || attempt >= opts.Retries || ctx.Err() != nil || !isRetryable(err) {
+			break
+		}
+		if _, serr := seeker.Seek(start, io.SeekStart); serr != nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !opts.SkipVerify {
+		h, err := api.GetImage(imageId)
+		if err != nil {
+			return nil, err
+		}
+		err = v.verify(h)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func (api *V3) uploadImage(ctx context.Context, imageId uuid.UUID, r io.Reader, opts *UploadImageOptions) (*UploadImageResponse, error) {
+	endpoint := *api.Endpoints.Image
+	endpoint.Path = fmt.Sprintf("/v2/images/%s/file", imageId)
+	pr := newProgressReader(r, opts.Size, opts.Interval, opts.Progress)
+	client := annette.New(&endpoint)
+	client.Context = ctx
 	client.Header.Set("Accept", "application/json")
 	client.Header.Set("Content-Type", "application/octet-stream")
 	client.Header.Set("X-Auth-Token", api.Token)
-	res, err := client.UploadByPut(f)
+	res, err := client.Put(pr)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !res.IsStatus204() {
-		return toError(res.Binary())
+		return nil, toStatusError(res.StatusCode(), res.Binary())
 	}
-	return nil
+	pr.report()
+	if opts.Size > 0 && pr.sent != opts.Size {
+		return nil, fmt.Errorf(`Size mismatch: expected %d, sent %d`, opts.Size, pr.sent)
+	}
+	return pr.response(), nil
+}
+
+// イメージダウンロード
+// 通信が途中で切れた場合はRangeリクエストで続きから再開する
+func (api *V3) DownloadImage(ctx context.Context, imageId uuid.UUID, w io.Writer, opts *DownloadImageOptions) (*DownloadImageResponse, error) {
+	if opts == nil {
+		opts = &DownloadImageOptions{}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	h, err := api.GetImage(imageId)
+	if err != nil {
+		return nil, err
+	}
+	verify := !opts.SkipVerify
+	pr := newProgressReader(nil, h.Size, opts.Interval, opts.Progress)
+	if opts.Offset > 0 {
+		if opts.Prefix != nil {
+			err = pr.skip(opts.Prefix, opts.Offset)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			// 先頭部分のハッシュ値が計算できないため検証しない
+			pr.sent = opts.Offset
+			pr.base = opts.Offset
+			verify = false
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		err = api.downloadImage(ctx, imageId, w, pr)
+		var we *writeError
+		if err == nil || attempt >= opts.Retries || ctx.Err() != nil || errors.As(err, &we) || !isRetryable(err) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	pr.report()
+	v := pr.response()
+	if verify {
+		err = v.verify(h)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return (*DownloadImageResponse)(v), nil
+}
+
+// イメージのダウンロードはレスポンスボディをストリームで扱う必要があるため net/http を直接使用する
+func (api *V3) downloadImage(ctx context.Context, imageId uuid.UUID, w io.Writer, pr *progressReader) error {
+	endpoint := *api.Endpoints.Image
+	endpoint.Path = fmt.Sprintf("/v2/images/%s/file", imageId)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Auth-Token", api.Token)
+	if pr.sent > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", pr.sent))
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		if pr.sent > 0 {
+			// Rangeリクエストが無視された場合は取得済みの部分を読み捨てる
+			_, err = io.CopyN(io.Discard, res.Body, pr.sent)
+			if err != nil {
+				return err
+			}
+		}
+	case http.StatusPartialContent:
+		// Do Nothing
+	case http.StatusNoContent:
+		return nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		if pr.total > 0 && pr.sent >= pr.total {
+			return nil
+		}
+		fallthrough
+	default:
+		body, _ := io.ReadAll(res.Body)
+		return toStatusError(res.StatusCode, body)
+	}
+	_, err = io.Copy(&progressWriter{p: pr, w: w}, res.Body)
+	return err
 }
 
 func (api *V3) CreateIsoImage(name string) (*CreateIsoImageResponse, error) {
-	endpoint := api.Endpoints.Image
+	endpoint := *api.Endpoints.Image
 	endpoint.Path = "/v2/images"
 	if name == "" {
 		u, _ := uuid.NewRandom()
@@ -101,8 +588,9 @@ func (api *V3) CreateIsoImage(name string) (*CreateIsoImageResponse, error) {
 		"hw_rescue_device": "cdrom",
 		"container_format": "bare"
   	}`, name)
-	client := annette.New(endpoint)
+	client := annette.New(&endpoint)
 	client.Header.Set("Accept", "application/json")
+	client.Header.Set("Content-Type", "application/json")
 	client.Header.Set("X-Auth-Token", api.Token)
 	res, err := client.Post(strings.NewReader(body))
 	if err != nil {
@@ -116,45 +604,121 @@ func (api *V3) CreateIsoImage(name string) (*CreateIsoImageResponse, error) {
 	if err != nil {
 		return nil, err
 	}
-	v.CreatedAt = toJst(v.CreatedAt)
-	v.UpdatedAt = toJst(v.UpdatedAt)
+	v.toJst()
 	return &v, nil
 }
 
 func (api *V3) GetImages(args map[string]string) (*GetImagesResponse, error) {
-	endpoint := api.Endpoints.Image
-	endpoint.Path = "/v2/images"
 	q := url.Values{}
 	for k, v := range args {
 		q.Set(k, v)
 	}
-	endpoint.RawQuery = q.Encode()
-	client := annette.New(endpoint)
-	client.Header.Set("Accept", "application/json")
-	client.Header.Set("X-Auth-Token", api.Token)
-	res, err := client.Get()
+	return api.getImages(q)
+}
+
+// イメージ一覧取得(フィルタ指定)
+func (api *V3) GetImagesByFilter(filter *ImageFilter) (*GetImagesResponse, error) {
+	if filter == nil {
+		filter = &ImageFilter{}
+	}
+	if filter.createdRange() && len(filter.Sort) > 0 {
+		return nil, fmt.Errorf(`Sort cannot be used with both CreatedAfter and CreatedBefore`)
+	}
+	v, err := api.getImages(filter.values())
 	if err != nil {
 		return nil, err
 	}
-	if !res.IsStatus200() {
-		return nil, toError(res.Binary())
+	if filter.createdRange() {
+		// created_at は1条件しか指定できないため、作成日時の昇順で取得して上限を超えたところで打ち切る
+		for k, i := range v.Images {
+			if i.CreatedAt.After(filter.CreatedBefore) {
+				v.Images = v.Images[:k]
+				v.Next = ""
+				break
+			}
+		}
 	}
+	return v, nil
+}
+
+func (f *ImageFilter) createdRange() bool {
+	return !f.CreatedAfter.IsZero() && !f.CreatedBefore.IsZero()
+}
+
+func (api *V3) getImages(q url.Values) (*GetImagesResponse, error) {
 	var v GetImagesResponse
-	err = json.Unmarshal(res.Binary(), &v)
+	err := api.request(api.Endpoints.Image, "GET", "/v2/images", q, nil, 200, &v)
 	if err != nil {
 		return nil, err
 	}
-	for k, i := range v.Images {
-		v.Images[k].CreatedAt = toJst(i.CreatedAt)
-		v.Images[k].UpdatedAt = toJst(i.UpdatedAt)
+	for k := range v.Images {
+		v.Images[k].toJst()
 	}
 	return &v, nil
 }
 
+func (f *ImageFilter) values() url.Values {
+	q := url.Values{}
+	if f.Name != "" {
+		q.Set("name", f.Name)
+	}
+	if f.Status != "" {
+		q.Set("status", f.Status)
+	}
+	if f.Visibility != "" {
+		q.Set("visibility", f.Visibility)
+	}
+	if f.Owner != "" {
+		q.Set("owner", f.Owner)
+	}
+	for _, t := range f.Tags {
+		q.Add("tag", t)
+	}
+	if f.DiskFormat != "" {
+		q.Set("disk_format", f.DiskFormat)
+	}
+	if f.ContainerFormat != "" {
+		q.Set("container_format", f.ContainerFormat)
+	}
+	if f.OsType != "" {
+		q.Set("os_type", f.OsType)
+	}
+	if !f.CreatedAfter.IsZero() {
+		q.Set("created_at", "gte:"+f.CreatedAfter.UTC().Format(time.RFC3339))
+	} else if !f.CreatedBefore.IsZero() {
+		q.Set("created_at", "lte:"+f.CreatedBefore.UTC().Format(time.RFC3339))
+	}
+	if !f.UpdatedAfter.IsZero() {
+		q.Set("updated_at", "gte:"+f.UpdatedAfter.UTC().Format(time.RFC3339))
+	}
+	keys := []string{}
+	sort := f.Sort
+	if f.createdRange() {
+		sort = []ImageSortKey{{Key: "created_at", Dir: "asc"}, {Key: "id", Dir: "asc"}}
+	}
+	for _, k := range sort {
+		dir := strings.ToLower(k.Dir)
+		if dir != "desc" {
+			dir = "asc"
+		}
+		keys = append(keys, k.Key+":"+dir)
+	}
+	if len(keys) > 0 {
+		q.Set("sort", strings.Join(keys, ","))
+	}
+	if f.Limit > 0 {
+		q.Set("limit", fmt.Sprintf("%d", f.Limit))
+	}
+	if f.Marker != uuid.Nil {
+		q.Set("marker", f.Marker.String())
+	}
+	return q
+}
+
 func (api *V3) GetUsedImageCapacity() (*GetUsedImageCapacityResponse, error) {
-	endpoint := api.Endpoints.Image
+	endpoint := *api.Endpoints.Image
 	endpoint.Path = "/v2/images/total"
-	client := annette.New(endpoint)
+	client := annette.New(&endpoint)
 	client.Header.Set("Accept", "application/json")
 	client.Header.Set("X-Auth-Token", api.Token)
 	res, err := client.Get()
@@ -173,9 +737,9 @@ func (api *V3) GetUsedImageCapacity() (*GetUsedImageCapacityResponse, error) {
 }
 
 func (api *V3) GetImageCapacity() (*GetImageCapacityResponse, error) {
-	endpoint := api.Endpoints.Image
+	endpoint := *api.Endpoints.Image
 	endpoint.Path = "/v2/quota"
-	client := annette.New(endpoint)
+	client := annette.New(&endpoint)
 	client.Header.Set("Accept", "application/json")
 	client.Header.Set("X-Auth-Token", api.Token)
 	res, err := client.Get()
@@ -194,13 +758,14 @@ func (api *V3) GetImageCapacity() (*GetImageCapacityResponse, error) {
 }
 
 func (api *V3) UpdateImageCapacity(imageSize string) (*UpdateImageCapacityResponse, error) {
-	endpoint := api.Endpoints.Image
+	endpoint := *api.Endpoints.Image
 	endpoint.Path = "/v2/quota"
 	body := fmt.Sprintf(`{
 		"quota": {"image_size": "%s"}
 	}`, imageSize)
-	client := annette.New(endpoint)
+	client := annette.New(&endpoint)
 	client.Header.Set("Accept", "application/json")
+	client.Header.Set("Content-Type", "application/json")
 	client.Header.Set("X-Auth-Token", api.Token)
 	res, err := client.Put(strings.NewReader(body))
 	if err != nil {
@@ -218,25 +783,25 @@ func (api *V3) UpdateImageCapacity(imageSize string) (*UpdateImageCapacityRespon
 }
 
 func (api *V3) DeleteImage(imageId uuid.UUID) error {
-	endpoint := api.Endpoints.Image
+	endpoint := *api.Endpoints.Image
 	endpoint.Path = fmt.Sprintf("/v2/images/%s", imageId)
-	client := annette.New(endpoint)
+	client := annette.New(&endpoint)
 	client.Header.Set("Accept", "application/json")
 	client.Header.Set("X-Auth-Token", api.Token)
 	res, err := client.Delete()
 	if err != nil {
 		return err
 	}
-	if !res.IsStatus200() {
+	if !res.IsStatus200() && !res.IsStatus204() {
 		return toError(res.Binary())
 	}
 	return nil
 }
 
 func (api *V3) GetImage(imageId uuid.UUID) (*GetImageResponse, error) {
-	endpoint := api.Endpoints.Image
+	endpoint := *api.Endpoints.Image
 	endpoint.Path = fmt.Sprintf("/v2/images/%s", imageId)
-	client := annette.New(endpoint)
+	client := annette.New(&endpoint)
 	client.Header.Set("Accept", "application/json")
 	client.Header.Set("X-Auth-Token", api.Token)
 	res, err := client.Get()
@@ -251,5 +816,87 @@ func (api *V3) GetImage(imageId uuid.UUID) (*GetImageResponse, error) {
 	if err != nil {
 		return nil, err
 	}
+	v.toJst()
 	return &v, nil
 }
+
+func NewImagePatch() *ImagePatch {
+	return &ImagePatch{ops: []imagePatchOp{}}
+}
+
+func (p *ImagePatch) SetName(name string) *ImagePatch {
+	p.ops = append(p.ops, imagePatchOp{Op: "replace", Path: "/name", Value: name})
+	return p
+}
+
+func (p *ImagePatch) SetTags(tags []string) *ImagePatch {
+	if tags == nil {
+		tags = []string{}
+	}
+	p.ops = append(p.ops, imagePatchOp{Op: "replace", Path: "/tags", Value: tags})
+	return p
+}
+
+func (p *ImagePatch) SetProtected(protected bool) *ImagePatch {
+	p.ops = append(p.ops, imagePatchOp{Op: "replace", Path: "/protected", Value: protected})
+	return p
+}
+
+func (p *ImagePatch) SetMinDisk(minDisk int) *ImagePatch {
+	p.ops = append(p.ops, imagePatchOp{Op: "replace", Path: "/min_disk", Value: minDisk})
+	return p
+}
+
+func (p *ImagePatch) SetMinRam(minRam int) *ImagePatch {
+	p.ops = append(p.ops, imagePatchOp{Op: "replace", Path: "/min_ram", Value: minRam})
+	return p
+}
+
+// 任意のプロパティを追加・上書きする
+func (p *ImagePatch) SetProperty(key, value string) *ImagePatch {
+	p.ops = append(p.ops, imagePatchOp{Op: "add", Path: "/" + escapePatchPath(key), Value: value})
+	return p
+}
+
+func (p *ImagePatch) RemoveProperty(key string) *ImagePatch {
+	p.ops = append(p.ops, imagePatchOp{Op: "remove", Path: "/" + escapePatchPath(key)})
+	return p
+}
+
+func (p *ImagePatch) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.ops)
+}
+
+func (p *ImagePatch) contentType() string {
+	return "application/openstack-images-v2.1-json-patch"
+}
+
+// JSON Pointer(RFC 6901)のエスケープ
+func escapePatchPath(key string) string {
+	key = strings.ReplaceAll(key, "~", "~0")
+	return strings.ReplaceAll(key, "/", "~1")
+}
+
+// イメージ更新
+func (api *V3) UpdateImage(imageId uuid.UUID, patch *ImagePatch) (*UpdateImageResponse, error) {
+	if patch == nil {
+		patch = NewImagePatch()
+	}
+	var v UpdateImageResponse
+	err := api.request(api.Endpoints.Image, "PATCH", fmt.Sprintf("/v2/images/%s", imageId), nil, patch, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	v.toJst()
+	return &v, nil
+}
+
+// イメージタグ追加
+func (api *V3) AddImageTag(imageId uuid.UUID, tag string) error {
+	return api.request(api.Endpoints.Image, "PUT", fmt.Sprintf("/v2/images/%s/tags/%s", imageId, url.PathEscape(tag)), nil, nil, 204, nil)
+}
+
+// イメージタグ削除
+func (api *V3) DeleteImageTag(imageId uuid.UUID, tag string) error {
+	return api.request(api.Endpoints.Image, "DELETE", fmt.Sprintf("/v2/images/%s/tags/%s", imageId, url.PathEscape(tag)), nil, nil, 204, nil)
+}
@@ -1 +1,553 @@
 package conoha
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GET /v2/images/{image_id} のレスポンス
+const imageJson = `{
+	"hw_rescue_bus": "ide",
+	"hw_rescue_device": "cdrom",
+	"hw_qemu_guest_agent": "yes",
+	"hw_vif_multiqueue_enabled": "true",
+	"hw_video_model": "vga",
+	"architecture": "x86_64",
+	"os_type": "linux",
+	"os_distro": "ubuntu",
+	"name": "ubuntu-24.04-server-amd64.iso",
+	"disk_format": "iso",
+	"container_format": "bare",
+	"visibility": "private",
+	"size": 2773874688,
+	"virtual_size": null,
+	"status": "active",
+	"checksum": "e8f6e7c6a4f1bb1e4d4b4a8a1c0c4a5b",
+	"protected": false,
+	"min_ram": 0,
+	"min_disk": 0,
+	"owner": "9c3e4ba5b1f84ed9a0a3b5fd6c2e1a4d",
+	"os_hidden": false,
+	"os_hash_algo": "sha512",
+	"os_hash_value": "1a2997d2e69fbf75a64c88714ca40531bb7c42fd0d64cdefd4480ac8b14c315400247e487d6b60ae4cb61a8edb634e3773f2b7cc2b2f3332fd8ba1e149a46b83",
+	"id": "1f1a3c57-5a8b-4f0b-9d1e-8a3d0f5b7c21",
+	"created_at": "2024-05-01T03:04:05Z",
+	"updated_at": "2024-05-01T03:10:00Z",
+	"tags": ["iso", "ubuntu"],
+	"self": "/v2/images/1f1a3c57-5a8b-4f0b-9d1e-8a3d0f5b7c21",
+	"file": "/v2/images/1f1a3c57-5a8b-4f0b-9d1e-8a3d0f5b7c21/file",
+	"schema": "/v2/schemas/image"
+}`
+
+func TestImageUnmarshalJSON(t *testing.T) {
+	var v Image
+	err := json.Unmarshal([]byte(imageJson), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Id != uuid.MustParse("1f1a3c57-5a8b-4f0b-9d1e-8a3d0f5b7c21") {
+		t.Errorf("Id: %s", v.Id)
+	}
+	if v.Checksum != "e8f6e7c6a4f1bb1e4d4b4a8a1c0c4a5b" {
+		t.Errorf("Checksum: %s", v.Checksum)
+	}
+	if v.Size != 2773874688 || v.VirtualSize != 0 {
+		t.Errorf("Size: %d, VirtualSize: %d", v.Size, v.VirtualSize)
+	}
+	if v.OsHashAlgo != "sha512" || len(v.OsHashValue) != 128 {
+		t.Errorf("OsHashAlgo: %s, OsHashValue: %s", v.OsHashAlgo, v.OsHashValue)
+	}
+	if len(v.Tags) != 2 || v.Tags[0] != "iso" {
+		t.Errorf("Tags: %v", v.Tags)
+	}
+	if !v.HwQemuGuestAgent || !v.HwVifMultiqueueEnabled || v.Bootable {
+		t.Errorf("HwQemuGuestAgent: %t, HwVifMultiqueueEnabled: %t, Bootable: %t", v.HwQemuGuestAgent, v.HwVifMultiqueueEnabled, v.Bootable)
+	}
+	if v.HwRescueBus != "ide" || v.HwRescueDevice != "cdrom" || v.OsType != "linux" || v.Architecture != "x86_64" {
+		t.Errorf("HwRescueBus: %s, HwRescueDevice: %s, OsType: %s, Architecture: %s", v.HwRescueBus, v.HwRescueDevice, v.OsType, v.Architecture)
+	}
+	// 全てのキーが基本項目か追加プロパティのいずれかに含まれること
+	var raw map[string]any
+	json.Unmarshal([]byte(imageJson), &raw)
+	for k := range raw {
+		if _, ok := v.Properties[k]; !ok && !imageCoreKeys[k] {
+			t.Errorf("missing key: %s", k)
+		}
+	}
+	if len(v.Properties) != 8 || v.Properties["os_distro"] != "ubuntu" {
+		t.Errorf("Properties: %v", v.Properties)
+	}
+}
+
+func TestImageMarshalJSON(t *testing.T) {
+	var v Image
+	err := json.Unmarshal([]byte(imageJson), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v2 Image
+	err = json.Unmarshal(b, &v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, v2) {
+		t.Errorf("round trip:\n%+v\n%+v", v, v2)
+	}
+	// 追加プロパティは基本項目と同じ階層に出力される
+	var raw map[string]any
+	json.Unmarshal(b, &raw)
+	if raw["os_distro"] != "ubuntu" || raw["hw_qemu_guest_agent"] != "yes" || raw["Properties"] != nil {
+		t.Errorf("json: %s", b)
+	}
+
+	// フィールドで設定した追加プロパティは Properties より優先する
+	v.OsType, v.Bootable, v.HwQemuGuestAgent = "windows", true, false
+	b, err = json.Marshal(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw = nil
+	json.Unmarshal(b, &raw)
+	if raw["os_type"] != "windows" || raw["bootable"] != "true" || raw["hw_qemu_guest_agent"] != "false" {
+		t.Errorf("json: %s", b)
+	}
+}
+
+func TestGetImagesResponse(t *testing.T) {
+	body := `{
+		"images": [` + imageJson + `],
+		"schema": "/v2/schemas/images",
+		"first": "/v2/images?limit=1",
+		"next": "/v2/images?limit=1&marker=1f1a3c57-5a8b-4f0b-9d1e-8a3d0f5b7c21"
+	}`
+	var v GetImagesResponse
+	err := json.Unmarshal([]byte(body), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Images) != 1 || v.Images[0].Checksum == "" || v.Images[0].Properties["os_distro"] != "ubuntu" {
+		t.Errorf("Images: %v", v.Images)
+	}
+	if v.Next == "" {
+		t.Errorf("Next is empty")
+	}
+}
+
+func TestGetUsedImageCapacityResponse(t *testing.T) {
+	var v GetUsedImageCapacityResponse
+	err := json.Unmarshal([]byte(`{"images": [{"size": 2773874688}]}`), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Images) != 1 || v.Images[0].Size != 2773874688 {
+		t.Errorf("Images: %v", v.Images)
+	}
+}
+
+func TestImageResponsesInJst(t *testing.T) {
+	contentType := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/quota":
+			contentType = r.Header.Get("Content-Type")
+			io.WriteString(w, `{"quota": [{"image_size": "550GB"}]}`)
+		case "/v2/images":
+			io.WriteString(w, `{"images": [`+imageJson+`]}`)
+		default:
+			io.WriteString(w, imageJson)
+		}
+	}))
+	defer srv.Close()
+	api := NewV3()
+	api.Endpoints.Image, _ = url.Parse(srv.URL)
+	expected := time.Date(2024, 5, 1, 12, 4, 5, 0, time.FixedZone("JST", 9*60*60))
+
+	v1, err := api.GetImage(uuid.MustParse("1f1a3c57-5a8b-4f0b-9d1e-8a3d0f5b7c21"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v1.CreatedAt.String() != expected.String() {
+		t.Errorf("GetImage: %s", v1.CreatedAt)
+	}
+	v2, err := api.GetImages(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2.Images[0].CreatedAt.String() != expected.String() {
+		t.Errorf("GetImages: %s", v2.Images[0].CreatedAt)
+	}
+	_, err = api.UpdateImageCapacity("550GB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type: %s", contentType)
+	}
+}
+
+// イメージファイルの転送を確認するテスト用サーバー
+type imageTestServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	data     []byte
+	checksum string // 空でない場合はイメージ情報のチェックサムを上書きする
+	failures []int  // ファイル転送のリクエストに順番に返すステータス
+	puts     int
+	// ダウンロード
+	ranges      []string // 受け取ったRangeヘッダー
+	ignoreRange bool     // Rangeヘッダーを無視して全体を返す
+	cut         int      // 0でない場合は次のダウンロードをこのバイト数で切断する
+}
+
+func newImageTestServer(t *testing.T) (*imageTestServer, *V3) {
+	s := &imageTestServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	api := NewV3()
+	api.Endpoints.Image, _ = url.Parse(s.URL)
+	return s, api
+}
+
+func (s *imageTestServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file := strings.HasSuffix(r.URL.Path, "/file")
+	if file && len(s.failures) > 0 {
+		status := s.failures[0]
+		s.failures = s.failures[1:]
+		if r.Method == http.MethodPut {
+			s.puts++
+			io.Copy(io.Discard, r.Body)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, `{"message": "failure"}`)
+		return
+	}
+	switch {
+	case file && r.Method == http.MethodPut:
+		s.puts++
+		s.data, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	case file && r.Method == http.MethodGet:
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+		start := 0
+		if rg := r.Header.Get("Range"); rg != "" && !s.ignoreRange {
+			fmt.Sscanf(rg, "bytes=%d-", &start)
+			if start >= len(s.data) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(s.data)-1, len(s.data)))
+			w.Header().Set("Content-Length", strconv.Itoa(len(s.data)-start))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set("Content-Length", strconv.Itoa(len(s.data)))
+		}
+		body := s.data[start:]
+		if s.cut > 0 {
+			body, s.cut = body[:s.cut], 0
+		}
+		w.Write(body)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v2/images/"):
+		sum := md5.Sum(s.data)
+		checksum := hex.EncodeToString(sum[:])
+		if s.checksum != "" {
+			checksum = s.checksum
+		}
+		sha := sha512.Sum512(s.data)
+		json.NewEncoder(w).Encode(map[string]any{
+			"id": "1f1a3c57-5a8b-4f0b-9d1e-8a3d0f5b7c21", "status": "active", "size": len(s.data),
+			"checksum": checksum, "os_hash_algo": "sha512", "os_hash_value": hex.EncodeToString(sha[:]),
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestUploadImage(t *testing.T) {
+	s, api := newImageTestServer(t)
+	id := uuid.MustParse("1f1a3c57-5a8b-4f0b-9d1e-8a3d0f5b7c21")
+	body := bytes.Repeat([]byte("0123456789"), 1000)
+	progress := []TransferProgress{}
+	s.failures = []int{http.StatusServiceUnavailable}
+	v, err := api.UploadImage(context.Background(), id, bytes.NewReader(body), &UploadImageOptions{
+		Size:     int64(len(body)),
+		Retries:  2,
+		Interval: time.Nanosecond,
+		Progress: func(p TransferProgress) { progress = append(progress, p) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.puts != 2 || !bytes.Equal(s.data, body) {
+		t.Errorf("puts: %d, size: %d", s.puts, len(s.data))
+	}
+	if v.Size != int64(len(body)) || len(progress) == 0 || progress[len(progress)-1].Sent != int64(len(body)) || progress[len(progress)-1].Total != int64(len(body)) {
+		t.Errorf("response: %+v, progress: %+v", v, progress)
+	}
+
+	// 4xxは再送しない
+	s.puts = 0
+	s.failures = []int{http.StatusConflict, http.StatusConflict}
+	_, err = api.UploadImage(context.Background(), id, bytes.NewReader(body), &UploadImageOptions{Retries: 2})
+	if err == nil || s.puts != 1 {
+		t.Errorf("puts: %d, error: %v", s.puts, err)
+	}
+
+	// 読み直せない場合は再送しない
+	s.puts = 0
+	s.failures = []int{http.StatusServiceUnavailable}
+	_, err = api.UploadImage(context.Background(), id, io.MultiReader(bytes.NewReader(body)), &UploadImageOptions{Retries: 2})
+	if err == nil || s.puts != 1 {
+		t.Errorf("puts: %d, error: %v", s.puts, err)
+	}
+
+	// 送信したデータとイメージ情報のハッシュ値が一致しない
+	s.checksum = "00000000000000000000000000000000"
+	_, err = api.UploadImage(context.Background(), id, bytes.NewReader(body), nil)
+	if err == nil || !strings.Contains(err.Error(), "Checksum mismatch") {
+		t.Errorf("error: %v", err)
+	}
+	_, err = api.UploadImage(context.Background(), id, bytes.NewReader(body), &UploadImageOptions{SkipVerify: true})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// 書き込み先のエラーを確認する
+type limitedWriter struct {
+	bytes.Buffer
+	limit int
+}
+
+func (w *limitedWriter) Write(b []byte) (int, error) {
+	if w.Len()+len(b) <= w.limit {
+		return w.Buffer.Write(b)
+	}
+	n, _ := w.Buffer.Write(b[:w.limit-w.Len()])
+	return n, errors.New("disk full")
+}
+
+func TestDownloadImage(t *testing.T) {
+	s, api := newImageTestServer(t)
+	id := uuid.MustParse("1f1a3c57-5a8b-4f0b-9d1e-8a3d0f5b7c21")
+	s.data = bytes.Repeat([]byte("0123456789"), 1000)
+
+	// 切断された位置からRangeリクエストで再開する
+	s.cut = 3000
+	var w bytes.Buffer
+	v, err := api.DownloadImage(context.Background(), id, &w, &DownloadImageOptions{Retries: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w.Bytes(), s.data) || v.Size != int64(len(s.data)) {
+		t.Errorf("size: %d, response: %+v", w.Len(), v)
+	}
+	if len(s.ranges) != 2 || s.ranges[0] != "" || s.ranges[1] != "bytes=3000-" {
+		t.Errorf("ranges: %q", s.ranges)
+	}
+
+	// Rangeリクエストが無視された場合は取得済みの部分を読み捨てる
+	s.ranges, s.cut, s.ignoreRange = nil, 5000, true
+	w.Reset()
+	_, err = api.DownloadImage(context.Background(), id, &w, &DownloadImageOptions{Retries: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w.Bytes(), s.data) || len(s.ranges) != 2 {
+		t.Errorf("size: %d, ranges: %q", w.Len(), s.ranges)
+	}
+	s.ignoreRange = false
+
+	// 取得済みの場合は416でも成功する
+	s.ranges = nil
+	w.Reset()
+	_, err = api.DownloadImage(context.Background(), id, &w, &DownloadImageOptions{Offset: int64(len(s.data)), Prefix: bytes.NewReader(s.data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Len() != 0 || len(s.ranges) != 1 || s.ranges[0] != "bytes=10000-" {
+		t.Errorf("size: %d, ranges: %q", w.Len(), s.ranges)
+	}
+
+	// 書き込み先のエラーは再開しない
+	s.ranges = nil
+	lw := &limitedWriter{limit: 4000}
+	_, err = api.DownloadImage(context.Background(), id, lw, &DownloadImageOptions{Retries: 2})
+	if err == nil || !strings.Contains(err.Error(), "disk full") || len(s.ranges) != 1 || lw.Len() != 4000 {
+		t.Errorf("ranges: %q, size: %d, error: %v", s.ranges, lw.Len(), err)
+	}
+
+	// 4xxは再開しない
+	s.ranges = nil
+	s.failures = []int{http.StatusForbidden}
+	_, err = api.DownloadImage(context.Background(), id, &bytes.Buffer{}, &DownloadImageOptions{Retries: 2})
+	if err == nil || len(s.ranges) != 0 || len(s.failures) != 0 {
+		t.Errorf("ranges: %q, error: %v", s.ranges, err)
+	}
+
+	// ハッシュ値が一致しない
+	s.checksum = "00000000000000000000000000000000"
+	_, err = api.DownloadImage(context.Background(), id, &bytes.Buffer{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "Checksum mismatch") {
+		t.Errorf("error: %v", err)
+	}
+	_, err = api.DownloadImage(context.Background(), id, &bytes.Buffer{}, &DownloadImageOptions{SkipVerify: true})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestImageFilterValues(t *testing.T) {
+	after := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2024, 6, 1, 9, 0, 0, 0, time.FixedZone("JST", 9*60*60))
+	marker := uuid.MustParse("1f1a3c57-5a8b-4f0b-9d1e-8a3d0f5b7c21")
+	tests := []struct {
+		filter   ImageFilter
+		expected string
+	}{
+		{ImageFilter{}, ""},
+		{
+			ImageFilter{Name: "ubuntu", Status: "active", Visibility: "private", Owner: "tenant", Tags: []string{"a", "b"}, DiskFormat: "qcow2", ContainerFormat: "bare", OsType: "linux", Limit: 10, Marker: marker},
+			"container_format=bare&disk_format=qcow2&limit=10&marker=1f1a3c57-5a8b-4f0b-9d1e-8a3d0f5b7c21&name=ubuntu&os_type=linux&owner=tenant&status=active&tag=a&tag=b&visibility=private",
+		},
+		{
+			ImageFilter{CreatedAfter: after, UpdatedAfter: after, Sort: []ImageSortKey{{Key: "name"}, {Key: "size", Dir: "DESC"}}},
+			"created_at=gte%3A2024-05-01T00%3A00%3A00Z&sort=name%3Aasc%2Csize%3Adesc&updated_at=gte%3A2024-05-01T00%3A00%3A00Z",
+		},
+		{ImageFilter{CreatedBefore: before}, "created_at=lte%3A2024-06-01T00%3A00%3A00Z"},
+		// 両方指定した場合は下限と作成日時の昇順
+		{
+			ImageFilter{CreatedAfter: after, CreatedBefore: before, Sort: []ImageSortKey{{Key: "name"}}},
+			"created_at=gte%3A2024-05-01T00%3A00%3A00Z&sort=created_at%3Aasc%2Cid%3Aasc",
+		},
+	}
+	for _, tt := range tests {
+		if q := tt.filter.values().Encode(); q != tt.expected {
+			t.Errorf("%+v: %s", tt.filter, q)
+		}
+	}
+}
+
+func TestGetImagesByFilterCreatedRange(t *testing.T) {
+	queries := []url.Values{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+		images := []string{}
+		for _, d := range []string{"2024-05-02", "2024-05-20", "2024-06-02"} {
+			images = append(images, fmt.Sprintf(`{"id": "1f1a3c57-5a8b-4f0b-9d1e-8a3d0f5b7c21", "created_at": "%sT00:00:00Z"}`, d))
+		}
+		fmt.Fprintf(w, `{"images": [%s], "next": "/v2/images?marker=1f1a3c57-5a8b-4f0b-9d1e-8a3d0f5b7c21"}`, strings.Join(images, ","))
+	}))
+	defer srv.Close()
+	api := NewV3()
+	api.Endpoints.Image, _ = url.Parse(srv.URL)
+
+	v, err := api.GetImagesByFilter(&ImageFilter{
+		CreatedAfter:  time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		CreatedBefore: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 上限を超えたイメージ以降は返さず、次のページもない
+	if len(v.Images) != 2 || v.Next != "" {
+		t.Errorf("images: %d, next: %s", len(v.Images), v.Next)
+	}
+	if len(queries) != 1 || queries[0].Get("created_at") != "gte:2024-05-01T00:00:00Z" || queries[0].Get("sort") != "created_at:asc,id:asc" {
+		t.Errorf("queries: %v", queries)
+	}
+	// 作成日時の昇順で取得するため並び順は指定できない
+	_, err = api.GetImagesByFilter(&ImageFilter{
+		CreatedAfter:  time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		CreatedBefore: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		Sort:          []ImageSortKey{{Key: "name"}},
+	})
+	if err == nil || len(queries) != 1 {
+		t.Errorf("queries: %d, error: %v", len(queries), err)
+	}
+}
+
+func TestUpdateImage(t *testing.T) {
+	var method, contentType string
+	var body []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, contentType = r.Method, r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&body)
+		io.WriteString(w, imageJson)
+	}))
+	defer srv.Close()
+	api := NewV3()
+	api.Endpoints.Image, _ = url.Parse(srv.URL)
+
+	patch := NewImagePatch().SetMinDisk(30).SetProperty("a/b~c", "x").RemoveProperty("old")
+	_, err := api.UpdateImage(uuid.MustParse("1f1a3c57-5a8b-4f0b-9d1e-8a3d0f5b7c21"), patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPatch || contentType != "application/openstack-images-v2.1-json-patch" {
+		t.Errorf("method: %s, Content-Type: %s", method, contentType)
+	}
+	b, _ := json.Marshal(body)
+	expected := `[{"op":"replace","path":"/min_disk","value":30},{"op":"add","path":"/a~1b~0c","value":"x"},{"op":"remove","path":"/old"}]`
+	if string(b) != expected {
+		t.Errorf("body: %s", b)
+	}
+}
+
+func TestImageTags(t *testing.T) {
+	requests := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"itemNotFound": {"code": 404, "message": "Tag not found"}}`)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	api := NewV3()
+	api.Endpoints.Image, _ = url.Parse(srv.URL)
+	id := uuid.MustParse("1f1a3c57-5a8b-4f0b-9d1e-8a3d0f5b7c21")
+
+	if err := api.AddImageTag(id, "web server/1?"); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.DeleteImageTag(id, "web server/1?"); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.DeleteImageTag(id, "missing"); err == nil {
+		t.Error("missing tag is deleted")
+	}
+	expected := []string{
+		"PUT /v2/images/1f1a3c57-5a8b-4f0b-9d1e-8a3d0f5b7c21/tags/web%20server%2F1%3F",
+		"DELETE /v2/images/1f1a3c57-5a8b-4f0b-9d1e-8a3d0f5b7c21/tags/web%20server%2F1%3F",
+		"DELETE /v2/images/1f1a3c57-5a8b-4f0b-9d1e-8a3d0f5b7c21/tags/missing",
+	}
+	if strings.Join(requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("requests: %q", requests)
+	}
+}
@@ -0,0 +1,172 @@
+package conoha
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type (
+	// プールのメンバーを1台ずつ切り離して更新する
+	RollingDeploy struct {
+		PoolId        uuid.UUID
+		Members       []uuid.UUID   // 対象のメンバー(空の場合はプールの全メンバー)
+		DrainTime     time.Duration // 重みを0にしてから更新するまでの待ち時間(既存の接続の終了待ち)
+		HealthTimeout time.Duration // 更新後に ONLINE になるまでの最大待ち時間(デフォルト5分)
+		Interval      time.Duration // 状態の確認間隔(デフォルト5秒)
+		// ヘルスモニターのないプールも対象にする(更新後のヘルスチェックは行わない)
+		// false の場合はヘルスモニターのないプールはエラーにする
+		AllowNoMonitor bool
+		OnProgress     func(m *Member, phase string)
+		api            *V3
+		loadBalancerId uuid.UUID
+		noMonitor      bool
+	}
+	RollingDeployResult struct {
+		Member   Member
+		Deployed bool
+		Error    error
+	}
+)
+
+func NewRollingDeploy(api *V3, poolId uuid.UUID) *RollingDeploy {
+	return &RollingDeploy{
+		PoolId:        poolId,
+		DrainTime:     30 * time.Second,
+		HealthTimeout: 5 * time.Minute,
+		Interval:      5 * time.Second,
+		api:           api,
+	}
+}
+
+func (d *RollingDeploy) progress(m *Member, phase string) {
+	if d.OnProgress != nil {
+		d.OnProgress(m, phase)
+	}
+}
+
+func (d *RollingDeploy) interval() time.Duration {
+	if d.Interval <= 0 {
+		return 5 * time.Second
+	}
+	return d.Interval
+}
+
+// メンバーの変更が反映される(ロードバランサーの provisioning_status が ACTIVE になる)まで待つ
+// 反映中のロードバランサーは変更できない
+func (d *RollingDeploy) waitActive(ctx context.Context) error {
+	_, err := d.api.WaitLoadBalancerActive(ctx, d.loadBalancerId, d.interval())
+	return err
+}
+
+func (d *RollingDeploy) setWeight(ctx context.Context, memberId uuid.UUID, weight int) error {
+	_, err := d.api.UpdateMember(d.PoolId, memberId, &UpdateMemberRequest{Weight: &weight})
+	if err != nil {
+		return err
+	}
+	return d.waitActive(ctx)
+}
+
+// プールのロードバランサーとヘルスモニターを確認する
+func (d *RollingDeploy) prepare() error {
+	pool, err := d.api.GetPool(d.PoolId)
+	if err != nil {
+		return err
+	}
+	if len(pool.LoadBalancers) == 0 {
+		return fmt.Errorf(`pool %s: no load balancer`, d.PoolId)
+	}
+	d.loadBalancerId = pool.LoadBalancers[0].Id
+	d.noMonitor = pool.HealthMonitorId == ""
+	if d.noMonitor && !d.AllowNoMonitor {
+		return fmt.Errorf(`pool %s: no health monitor`, d.PoolId)
+	}
+	return nil
+}
+
+func (d *RollingDeploy) members() ([]Member, error) {
+	if len(d.Members) == 0 {
+		v, err := d.api.GetMembers(d.PoolId, nil)
+		if err != nil {
+			return nil, err
+		}
+		return v.Members, nil
+	}
+	members := []Member{}
+	for _, id := range d.Members {
+		m, err := d.api.GetMember(d.PoolId, id)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, *m)
+	}
+	return members, nil
+}
+
+// メンバーごとに 切り離し → 待機 → deploy → ヘルスチェック → 重みの復元 を行う
+// deploy が失敗した場合やヘルスチェックに合格しない場合は、重みを元に戻して中止する
+func (d *RollingDeploy) Run(ctx context.Context, deploy func(ctx context.Context, m *Member) error) ([]RollingDeployResult, error) {
+	if err := d.prepare(); err != nil {
+		return nil, err
+	}
+	members, err := d.members()
+	if err != nil {
+		return nil, err
+	}
+	results := []RollingDeployResult{}
+	for _, m := range members {
+		result := RollingDeployResult{Member: m}
+		result.Error = d.deploy(ctx, &m, deploy)
+		result.Deployed = result.Error == nil
+		results = append(results, result)
+		if result.Error != nil {
+			return results, fmt.Errorf(`member %s (%s:%d): %w`, m.Id, m.Address, m.ProtocolPort, result.Error)
+		}
+	}
+	return results, nil
+}
+
+func (d *RollingDeploy) deploy(ctx context.Context, m *Member, deploy func(ctx context.Context, m *Member) error) (err error) {
+	weight := m.Weight
+	if weight > 0 {
+		d.progress(m, "drain")
+		if err := d.setWeight(ctx, m.Id, 0); err != nil {
+			return err
+		}
+	}
+	// 中断された場合も重みは元に戻す
+	defer func() {
+		if weight == 0 {
+			return
+		}
+		d.progress(m, "restore")
+		if e := d.setWeight(context.WithoutCancel(ctx), m.Id, weight); e != nil && err == nil {
+			err = e
+		}
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d.DrainTime):
+	}
+
+	d.progress(m, "deploy")
+	if err := deploy(ctx, m); err != nil {
+		return err
+	}
+
+	if d.noMonitor {
+		return nil
+	}
+	d.progress(m, "health")
+	timeout := d.HealthTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	hctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	_, err = d.api.WaitMemberOnline(hctx, d.PoolId, m.Id, d.interval())
+	return err
+}
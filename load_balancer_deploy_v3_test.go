@@ -0,0 +1,180 @@
+package conoha
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ロードバランサーに接続したプールを作成する
+func newDeployTestPool(t *testing.T, s *resourceTestServer, api *V3, monitor bool) (uuid.UUID, uuid.UUID) {
+	lb, err := api.CreateLoadBalancer(&CreateLoadBalancerRequest{Name: "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := api.CreatePool(&CreatePoolRequest{Name: "web", LoadBalancerId: &lb.Id, Protocol: "HTTP", LbAlgorithm: "ROUND_ROBIN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj := s.objects["/v2.0/lbaas/pools"][pool.Id.String()]
+	obj["loadbalancers"] = []map[string]any{{"id": lb.Id.String()}}
+	if monitor {
+		obj["healthmonitor_id"] = uuid.NewString()
+	}
+	return lb.Id, pool.Id
+}
+
+func TestRollingDeploy(t *testing.T) {
+	s, api := newLbTestServer(t)
+	lb, pool := newDeployTestPool(t, s, api, true)
+	// 最初の2回はロードバランサーが変更中
+	lbGets := 0
+	s.get = func(collection string, obj map[string]any) {
+		if obj["id"] != lb.String() {
+			return
+		}
+		lbGets++
+		obj["provisioning_status"] = "ACTIVE"
+		if lbGets <= 2 {
+			obj["provisioning_status"] = "PENDING_UPDATE"
+		}
+	}
+	collection := fmt.Sprintf("/v2.0/lbaas/pools/%s/members", pool)
+	ids := []uuid.UUID{}
+	for k, weight := range []int{10, 5, 1} {
+		m, err := api.CreateMember(pool, &CreateMemberRequest{Address: fmt.Sprintf("192.0.2.%d", k+1), ProtocolPort: 80, Weight: &weight})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, m.Id)
+	}
+
+	d := NewRollingDeploy(api, pool)
+	d.Members = ids
+	d.DrainTime = time.Millisecond
+	d.Interval = time.Millisecond
+	phases := []string{}
+	d.OnProgress = func(m *Member, phase string) {
+		phases = append(phases, phase)
+	}
+	deployed := []string{}
+	results, err := d.Run(context.Background(), func(ctx context.Context, m *Member) error {
+		// 更新中のメンバーは切り離されている
+		if w := s.object(collection, m.Id.String())["weight"]; w != float64(0) {
+			t.Errorf("%s: weight %v", m.Address, w)
+		}
+		deployed = append(deployed, m.Address)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || !results[2].Deployed || fmt.Sprint(deployed) != "[192.0.2.1 192.0.2.2 192.0.2.3]" {
+		t.Errorf("results: %+v, deployed: %v", results, deployed)
+	}
+	if fmt.Sprint(phases[:4]) != "[drain deploy health restore]" {
+		t.Errorf("phases: %v", phases)
+	}
+	// 重みの変更ごとに ACTIVE になるまでロードバランサーを確認する
+	if lbGets != 8 {
+		t.Errorf("load balancer gets: %d", lbGets)
+	}
+	for k, weight := range []float64{10, 5, 1} {
+		if w := s.object(collection, ids[k].String())["weight"]; w != weight {
+			t.Errorf("member %d: weight %v", k, w)
+		}
+	}
+}
+
+func TestRollingDeployAbort(t *testing.T) {
+	s, api := newLbTestServer(t)
+	_, pool := newDeployTestPool(t, s, api, true)
+	collection := fmt.Sprintf("/v2.0/lbaas/pools/%s/members", pool)
+	ids := []uuid.UUID{}
+	for k := 0; k < 3; k++ {
+		weight := 10
+		m, err := api.CreateMember(pool, &CreateMemberRequest{Address: fmt.Sprintf("192.0.2.%d", k+1), ProtocolPort: 80, Weight: &weight})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, m.Id)
+	}
+	// 2台目は更新後にヘルスチェックに合格しない
+	broken := false
+	s.get = func(collection string, obj map[string]any) {
+		if obj["id"] == ids[1].String() && broken {
+			obj["operating_status"] = "ERROR"
+		}
+	}
+
+	d := NewRollingDeploy(api, pool)
+	d.Members = ids
+	d.DrainTime = 0
+	d.Interval = time.Millisecond
+	d.HealthTimeout = 20 * time.Millisecond
+	deployed := 0
+	results, err := d.Run(context.Background(), func(ctx context.Context, m *Member) error {
+		deployed++
+		s.mu.Lock()
+		broken = m.Id == ids[1]
+		s.mu.Unlock()
+		return nil
+	})
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if deployed != 2 || len(results) != 2 || !results[0].Deployed || results[1].Deployed {
+		t.Errorf("deployed: %d, results: %+v", deployed, results)
+	}
+	// 失敗したメンバーの重みも元に戻す
+	for k := range ids {
+		if w := s.object(collection, ids[k].String())["weight"]; w != float64(10) {
+			t.Errorf("member %d: weight %v", k, w)
+		}
+	}
+
+	results, err = d.Run(context.Background(), func(ctx context.Context, m *Member) error {
+		return fmt.Errorf("deploy failed")
+	})
+	if err == nil || len(results) != 1 {
+		t.Errorf("error: %v, results: %+v", err, results)
+	}
+	if w := s.object(collection, ids[0].String())["weight"]; w != float64(10) {
+		t.Errorf("weight %v", w)
+	}
+}
+
+func TestRollingDeployNoMonitor(t *testing.T) {
+	s, api := newLbTestServer(t)
+	_, pool := newDeployTestPool(t, s, api, false)
+	weight := 10
+	if _, err := api.CreateMember(pool, &CreateMemberRequest{Address: "192.0.2.1", ProtocolPort: 80, Weight: &weight}); err != nil {
+		t.Fatal(err)
+	}
+	d := NewRollingDeploy(api, pool)
+	d.DrainTime = 0
+	d.Interval = time.Millisecond
+	deploy := func(ctx context.Context, m *Member) error { return nil }
+	if _, err := d.Run(context.Background(), deploy); err == nil {
+		t.Error("pool without health monitor is deployed")
+	}
+
+	// ヘルスチェックを行わずに更新する
+	d.AllowNoMonitor = true
+	phases := []string{}
+	d.OnProgress = func(m *Member, phase string) {
+		phases = append(phases, phase)
+	}
+	results, err := d.Run(context.Background(), deploy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].Deployed || fmt.Sprint(phases) != "[drain deploy restore]" {
+		t.Errorf("results: %+v, phases: %v", results, phases)
+	}
+}
@@ -1 +1,621 @@
 package conoha
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	LbProtocolHttp  = "HTTP"
+	LbProtocolHttps = "HTTPS"
+	LbProtocolTcp   = "TCP"
+	LbProtocolUdp   = "UDP"
+
+	LbAlgorithmRoundRobin       = "ROUND_ROBIN"
+	LbAlgorithmLeastConnections = "LEAST_CONNECTIONS"
+	LbAlgorithmSourceIp         = "SOURCE_IP"
+
+	LbPersistenceSourceIp   = "SOURCE_IP"
+	LbPersistenceHttpCookie = "HTTP_COOKIE"
+	LbPersistenceAppCookie  = "APP_COOKIE"
+
+	LbMonitorHttp       = "HTTP"
+	LbMonitorHttps      = "HTTPS"
+	LbMonitorPing       = "PING"
+	LbMonitorTcp        = "TCP"
+	LbMonitorTlsHello   = "TLS-HELLO"
+	LbMonitorUdpConnect = "UDP-CONNECT"
+)
+
+type (
+	// タイムゾーンなし(UTC)で返される日時
+	LbTime struct {
+		time.Time
+	}
+	LbRef struct {
+		Id uuid.UUID `json:"id"`
+	}
+	LoadBalancer struct {
+		Id                 uuid.UUID `json:"id"`
+		Name               string    `json:"name"`
+		Description        string    `json:"description"`
+		ProjectId          string    `json:"project_id"`
+		VipAddress         string    `json:"vip_address"`
+		VipPortId          string    `json:"vip_port_id"`
+		VipSubnetId        string    `json:"vip_subnet_id"`
+		VipNetworkId       string    `json:"vip_network_id"`
+		Provider           string    `json:"provider"`
+		FlavorId           string    `json:"flavor_id"`
+		AdminStateUp       bool      `json:"admin_state_up"`
+		ProvisioningStatus string    `json:"provisioning_status"`
+		OperatingStatus    string    `json:"operating_status"`
+		Listeners          []LbRef   `json:"listeners"`
+		Pools              []LbRef   `json:"pools"`
+		Tags               []string  `json:"tags"`
+		CreatedAt          LbTime    `json:"created_at"`
+		UpdatedAt          LbTime    `json:"updated_at"`
+	}
+	Listener struct {
+		Id                   uuid.UUID `json:"id"`
+		Name                 string    `json:"name"`
+		Description          string    `json:"description"`
+		ProjectId            string    `json:"project_id"`
+		Protocol             string    `json:"protocol"`
+		ProtocolPort         int       `json:"protocol_port"`
+		ConnectionLimit      int       `json:"connection_limit"` // -1の場合は無制限
+		DefaultPoolId        string    `json:"default_pool_id"`
+		LoadBalancers        []LbRef   `json:"loadbalancers"`
+		TimeoutClientData    int       `json:"timeout_client_data"`
+		TimeoutMemberConnect int       `json:"timeout_member_connect"`
+		TimeoutMemberData    int       `json:"timeout_member_data"`
+		AllowedCidrs         []string  `json:"allowed_cidrs"`
+		AdminStateUp         bool      `json:"admin_state_up"`
+		ProvisioningStatus   string    `json:"provisioning_status"`
+		OperatingStatus      string    `json:"operating_status"`
+		Tags                 []string  `json:"tags"`
+		CreatedAt            LbTime    `json:"created_at"`
+		UpdatedAt            LbTime    `json:"updated_at"`
+	}
+	SessionPersistence struct {
+		Type       string `json:"type"`
+		CookieName string `json:"cookie_name,omitempty"` // APP_COOKIE の場合のみ
+	}
+	Pool struct {
+		Id                 uuid.UUID           `json:"id"`
+		Name               string              `json:"name"`
+		Description        string              `json:"description"`
+		ProjectId          string              `json:"project_id"`
+		Protocol           string              `json:"protocol"`
+		LbAlgorithm        string              `json:"lb_algorithm"`
+		SessionPersistence *SessionPersistence `json:"session_persistence"`
+		LoadBalancers      []LbRef             `json:"loadbalancers"`
+		Listeners          []LbRef             `json:"listeners"`
+		Members            []LbRef             `json:"members"`
+		HealthMonitorId    string              `json:"healthmonitor_id"`
+		AdminStateUp       bool                `json:"admin_state_up"`
+		ProvisioningStatus string              `json:"provisioning_status"`
+		OperatingStatus    string              `json:"operating_status"`
+		Tags               []string            `json:"tags"`
+		CreatedAt          LbTime              `json:"created_at"`
+		UpdatedAt          LbTime              `json:"updated_at"`
+	}
+	Member struct {
+		Id                 uuid.UUID `json:"id"`
+		Name               string    `json:"name"`
+		ProjectId          string    `json:"project_id"`
+		Address            string    `json:"address"`
+		ProtocolPort       int       `json:"protocol_port"`
+		Weight             int       `json:"weight"` // 0の場合は新しい接続を割り当てない
+		SubnetId           string    `json:"subnet_id"`
+		Backup             bool      `json:"backup"`
+		MonitorAddress     string    `json:"monitor_address"`
+		MonitorPort        int       `json:"monitor_port"`
+		AdminStateUp       bool      `json:"admin_state_up"`
+		ProvisioningStatus string    `json:"provisioning_status"`
+		OperatingStatus    string    `json:"operating_status"`
+		Tags               []string  `json:"tags"`
+		CreatedAt          LbTime    `json:"created_at"`
+		UpdatedAt          LbTime    `json:"updated_at"`
+	}
+	HealthMonitor struct {
+		Id                 uuid.UUID `json:"id"`
+		Name               string    `json:"name"`
+		ProjectId          string    `json:"project_id"`
+		Type               string    `json:"type"`
+		Delay              int       `json:"delay"`   // 確認間隔(秒)
+		Timeout            int       `json:"timeout"` // タイムアウト(秒)
+		MaxRetries         int       `json:"max_retries"`
+		MaxRetriesDown     int       `json:"max_retries_down"`
+		HttpMethod         string    `json:"http_method"`
+		UrlPath            string    `json:"url_path"`
+		ExpectedCodes      string    `json:"expected_codes"` // 200、200,202、200-204 の形式
+		Pools              []LbRef   `json:"pools"`
+		AdminStateUp       bool      `json:"admin_state_up"`
+		ProvisioningStatus string    `json:"provisioning_status"`
+		OperatingStatus    string    `json:"operating_status"`
+		Tags               []string  `json:"tags"`
+		CreatedAt          LbTime    `json:"created_at"`
+		UpdatedAt          LbTime    `json:"updated_at"`
+	}
+	CreateLoadBalancerRequest struct {
+		Name         string     `json:"name,omitempty"`
+		Description  string     `json:"description,omitempty"`
+		VipSubnetId  *uuid.UUID `json:"vip_subnet_id,omitempty"`
+		VipNetworkId *uuid.UUID `json:"vip_network_id,omitempty"`
+		VipAddress   string     `json:"vip_address,omitempty"`
+		AdminStateUp *bool      `json:"admin_state_up,omitempty"`
+		Tags         []string   `json:"tags,omitempty"`
+	}
+	// nilの項目は変更しない
+	UpdateLoadBalancerRequest struct {
+		Name         *string   `json:"name,omitempty"`
+		Description  *string   `json:"description,omitempty"`
+		AdminStateUp *bool     `json:"admin_state_up,omitempty"`
+		Tags         *[]string `json:"tags,omitempty"`
+	}
+	CreateListenerRequest struct {
+		Name                 string     `json:"name,omitempty"`
+		Description          string     `json:"description,omitempty"`
+		LoadBalancerId       uuid.UUID  `json:"loadbalancer_id"`
+		Protocol             string     `json:"protocol"`
+		ProtocolPort         int        `json:"protocol_port"`
+		ConnectionLimit      *int       `json:"connection_limit,omitempty"`
+		DefaultPoolId        *uuid.UUID `json:"default_pool_id,omitempty"`
+		TimeoutClientData    *int       `json:"timeout_client_data,omitempty"`
+		TimeoutMemberConnect *int       `json:"timeout_member_connect,omitempty"`
+		TimeoutMemberData    *int       `json:"timeout_member_data,omitempty"`
+		AllowedCidrs         []string   `json:"allowed_cidrs,omitempty"`
+		AdminStateUp         *bool      `json:"admin_state_up,omitempty"`
+		Tags                 []string   `json:"tags,omitempty"`
+	}
+	// nilの項目は変更しない
+	UpdateListenerRequest struct {
+		Name                 *string    `json:"name,omitempty"`
+		Description          *string    `json:"description,omitempty"`
+		ConnectionLimit      *int       `json:"connection_limit,omitempty"`
+		DefaultPoolId        *uuid.UUID `json:"default_pool_id,omitempty"`
+		TimeoutClientData    *int       `json:"timeout_client_data,omitempty"`
+		TimeoutMemberConnect *int       `json:"timeout_member_connect,omitempty"`
+		TimeoutMemberData    *int       `json:"timeout_member_data,omitempty"`
+		AllowedCidrs         *[]string  `json:"allowed_cidrs,omitempty"`
+		AdminStateUp         *bool      `json:"admin_state_up,omitempty"`
+		Tags                 *[]string  `json:"tags,omitempty"`
+	}
+	// ListenerId か LoadBalancerId のどちらかを指定する
+	CreatePoolRequest struct {
+		Name               string              `json:"name,omitempty"`
+		Description        string              `json:"description,omitempty"`
+		ListenerId         *uuid.UUID          `json:"listener_id,omitempty"`
+		LoadBalancerId     *uuid.UUID          `json:"loadbalancer_id,omitempty"`
+		Protocol           string              `json:"protocol"`
+		LbAlgorithm        string              `json:"lb_algorithm"`
+		SessionPersistence *SessionPersistence `json:"session_persistence,omitempty"`
+		AdminStateUp       *bool               `json:"admin_state_up,omitempty"`
+		Tags               []string            `json:"tags,omitempty"`
+	}
+	// nilの項目は変更しない
+	UpdatePoolRequest struct {
+		Name               *string             `json:"name,omitempty"`
+		Description        *string             `json:"description,omitempty"`
+		LbAlgorithm        *string             `json:"lb_algorithm,omitempty"`
+		SessionPersistence *SessionPersistence `json:"session_persistence,omitempty"`
+		AdminStateUp       *bool               `json:"admin_state_up,omitempty"`
+		Tags               *[]string           `json:"tags,omitempty"`
+	}
+	CreateMemberRequest struct {
+		Name           string     `json:"name,omitempty"`
+		Address        string     `json:"address"`
+		ProtocolPort   int        `json:"protocol_port"`
+		Weight         *int       `json:"weight,omitempty"`
+		SubnetId       *uuid.UUID `json:"subnet_id,omitempty"`
+		Backup         *bool      `json:"backup,omitempty"`
+		MonitorAddress string     `json:"monitor_address,omitempty"`
+		MonitorPort    *int       `json:"monitor_port,omitempty"`
+		AdminStateUp   *bool      `json:"admin_state_up,omitempty"`
+		Tags           []string   `json:"tags,omitempty"`
+	}
+	// nilの項目は変更しない
+	UpdateMemberRequest struct {
+		Name           *string   `json:"name,omitempty"`
+		Weight         *int      `json:"weight,omitempty"`
+		Backup         *bool     `json:"backup,omitempty"`
+		MonitorAddress *string   `json:"monitor_address,omitempty"`
+		MonitorPort    *int      `json:"monitor_port,omitempty"`
+		AdminStateUp   *bool     `json:"admin_state_up,omitempty"`
+		Tags           *[]string `json:"tags,omitempty"`
+	}
+	CreateHealthMonitorRequest struct {
+		Name           string    `json:"name,omitempty"`
+		PoolId         uuid.UUID `json:"pool_id"`
+		Type           string    `json:"type"`
+		Delay          int       `json:"delay"`
+		Timeout        int       `json:"timeout"`
+		MaxRetries     int       `json:"max_retries"`
+		MaxRetriesDown *int      `json:"max_retries_down,omitempty"`
+		HttpMethod     string    `json:"http_method,omitempty"`
+		UrlPath        string    `json:"url_path,omitempty"`
+		ExpectedCodes  string    `json:"expected_codes,omitempty"`
+		AdminStateUp   *bool     `json:"admin_state_up,omitempty"`
+		Tags           []string  `json:"tags,omitempty"`
+	}
+	// nilの項目は変更しない
+	UpdateHealthMonitorRequest struct {
+		Name           *string   `json:"name,omitempty"`
+		Delay          *int      `json:"delay,omitempty"`
+		Timeout        *int      `json:"timeout,omitempty"`
+		MaxRetries     *int      `json:"max_retries,omitempty"`
+		MaxRetriesDown *int      `json:"max_retries_down,omitempty"`
+		HttpMethod     *string   `json:"http_method,omitempty"`
+		UrlPath        *string   `json:"url_path,omitempty"`
+		ExpectedCodes  *string   `json:"expected_codes,omitempty"`
+		AdminStateUp   *bool     `json:"admin_state_up,omitempty"`
+		Tags           *[]string `json:"tags,omitempty"`
+	}
+	GetLoadBalancersResponse struct {
+		LoadBalancers []LoadBalancer `json:"loadbalancers"`
+	}
+	GetListenersResponse struct {
+		Listeners []Listener `json:"listeners"`
+	}
+	GetPoolsResponse struct {
+		Pools []Pool `json:"pools"`
+	}
+	GetMembersResponse struct {
+		Members []Member `json:"members"`
+	}
+	GetHealthMonitorsResponse struct {
+		HealthMonitors []HealthMonitor `json:"healthmonitors"`
+	}
+)
+
+func (t *LbTime) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil || s == "" {
+		// null
+		return nil
+	}
+	v, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		v, err = time.ParseInLocation("2006-01-02T15:04:05", s, time.UTC)
+		if err != nil {
+			return err
+		}
+	}
+	t.Time = toJst(v)
+	return nil
+}
+
+func (t LbTime) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.Time)
+}
+
+// ロードバランサー一覧取得
+func (api *V3) GetLoadBalancers(query url.Values) (*GetLoadBalancersResponse, error) {
+	var v GetLoadBalancersResponse
+	err := api.request(api.Endpoints.LoadBalancer, "GET", "/v2.0/lbaas/loadbalancers", query, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// ロードバランサー詳細取得
+func (api *V3) GetLoadBalancer(id uuid.UUID) (*LoadBalancer, error) {
+	var v struct {
+		LoadBalancer LoadBalancer `json:"loadbalancer"`
+	}
+	err := api.request(api.Endpoints.LoadBalancer, "GET", fmt.Sprintf(`/v2.0/lbaas/loadbalancers/%s`, id), nil, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v.LoadBalancer, nil
+}
+
+// ロードバランサー作成
+func (api *V3) CreateLoadBalancer(req *CreateLoadBalancerRequest) (*LoadBalancer, error) {
+	body := map[string]any{"loadbalancer": req}
+	var v struct {
+		LoadBalancer LoadBalancer `json:"loadbalancer"`
+	}
+	err := api.request(api.Endpoints.LoadBalancer, "POST", "/v2.0/lbaas/loadbalancers", nil, body, 201, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v.LoadBalancer, nil
+}
+
+// ロードバランサー更新
+func (api *V3) UpdateLoadBalancer(id uuid.UUID, req *UpdateLoadBalancerRequest) (*LoadBalancer, error) {
+	body := map[string]any{"loadbalancer": req}
+	var v struct {
+		LoadBalancer LoadBalancer `json:"loadbalancer"`
+	}
+	err := api.request(api.Endpoints.LoadBalancer, "PUT", fmt.Sprintf(`/v2.0/lbaas/loadbalancers/%s`, id), nil, body, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v.LoadBalancer, nil
+}
+
+// ロードバランサー削除
+// cascade が true の場合はリスナー・プールなども削除する
+func (api *V3) DeleteLoadBalancer(id uuid.UUID, cascade bool) error {
+	var query url.Values
+	if cascade {
+		query = url.Values{"cascade": {"true"}}
+	}
+	return api.request(api.Endpoints.LoadBalancer, "DELETE", fmt.Sprintf(`/v2.0/lbaas/loadbalancers/%s`, id), query, nil, 204, nil)
+}
+
+// ロードバランサーが ACTIVE になるまで待つ
+// 変更中(PENDING_*)のロードバランサーは更新できないため、変更後に呼び出す
+func (api *V3) WaitLoadBalancerActive(ctx context.Context, id uuid.UUID, interval time.Duration) (*LoadBalancer, error) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	for {
+		lb, err := api.GetLoadBalancer(id)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case lb.ProvisioningStatus == "ACTIVE":
+			return lb, nil
+		case lb.ProvisioningStatus == "ERROR":
+			return lb, fmt.Errorf(`load balancer %s: provisioning status is ERROR`, id)
+		case !strings.HasPrefix(lb.ProvisioningStatus, "PENDING_"):
+			return lb, fmt.Errorf(`load balancer %s: unexpected provisioning status %s`, id, lb.ProvisioningStatus)
+		}
+		select {
+		case <-ctx.Done():
+			return lb, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// リスナー一覧取得
+func (api *V3) GetListeners(query url.Values) (*GetListenersResponse, error) {
+	var v GetListenersResponse
+	err := api.request(api.Endpoints.LoadBalancer, "GET", "/v2.0/lbaas/listeners", query, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// リスナー詳細取得
+func (api *V3) GetListener(id uuid.UUID) (*Listener, error) {
+	var v struct {
+		Listener Listener `json:"listener"`
+	}
+	err := api.request(api.Endpoints.LoadBalancer, "GET", fmt.Sprintf(`/v2.0/lbaas/listeners/%s`, id), nil, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v.Listener, nil
+}
+
+// リスナー作成
+func (api *V3) CreateListener(req *CreateListenerRequest) (*Listener, error) {
+	body := map[string]any{"listener": req}
+	var v struct {
+		Listener Listener `json:"listener"`
+	}
+	err := api.request(api.Endpoints.LoadBalancer, "POST", "/v2.0/lbaas/listeners", nil, body, 201, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v.Listener, nil
+}
+
+// リスナー更新
+func (api *V3) UpdateListener(id uuid.UUID, req *UpdateListenerRequest) (*Listener, error) {
+	body := map[string]any{"listener": req}
+	var v struct {
+		Listener Listener `json:"listener"`
+	}
+	err := api.request(api.Endpoints.LoadBalancer, "PUT", fmt.Sprintf(`/v2.0/lbaas/listeners/%s`, id), nil, body, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v.Listener, nil
+}
+
+// リスナー削除
+func (api *V3) DeleteListener(id uuid.UUID) error {
+	return api.request(api.Endpoints.LoadBalancer, "DELETE", fmt.Sprintf(`/v2.0/lbaas/listeners/%s`, id), nil, nil, 204, nil)
+}
+
+// プール一覧取得
+func (api *V3) GetPools(query url.Values) (*GetPoolsResponse, error) {
+	var v GetPoolsResponse
+	err := api.request(api.Endpoints.LoadBalancer, "GET", "/v2.0/lbaas/pools", query, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// プール詳細取得
+func (api *V3) GetPool(id uuid.UUID) (*Pool, error) {
+	var v struct {
+		Pool Pool `json:"pool"`
+	}
+	err := api.request(api.Endpoints.LoadBalancer, "GET", fmt.Sprintf(`/v2.0/lbaas/pools/%s`, id), nil, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v.Pool, nil
+}
+
+// プール作成
+func (api *V3) CreatePool(req *CreatePoolRequest) (*Pool, error) {
+	body := map[string]any{"pool": req}
+	var v struct {
+		Pool Pool `json:"pool"`
+	}
+	err := api.request(api.Endpoints.LoadBalancer, "POST", "/v2.0/lbaas/pools", nil, body, 201, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v.Pool, nil
+}
+
+// プール更新
+func (api *V3) UpdatePool(id uuid.UUID, req *UpdatePoolRequest) (*Pool, error) {
+	body := map[string]any{"pool": req}
+	var v struct {
+		Pool Pool `json:"pool"`
+	}
+	err := api.request(api.Endpoints.LoadBalancer, "PUT", fmt.Sprintf(`/v2.0/lbaas/pools/%s`, id), nil, body, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v.Pool, nil
+}
+
+// プール削除
+func (api *V3) DeletePool(id uuid.UUID) error {
+	return api.request(api.Endpoints.LoadBalancer, "DELETE", fmt.Sprintf(`/v2.0/lbaas/pools/%s`, id), nil, nil, 204, nil)
+}
+
+// メンバー一覧取得
+func (api *V3) GetMembers(poolId uuid.UUID, query url.Values) (*GetMembersResponse, error) {
+	var v GetMembersResponse
+	err := api.request(api.Endpoints.LoadBalancer, "GET", fmt.Sprintf(`/v2.0/lbaas/pools/%s/members`, poolId), query, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// メンバー詳細取得
+func (api *V3) GetMember(poolId, memberId uuid.UUID) (*Member, error) {
+	var v struct {
+		Member Member `json:"member"`
+	}
+	err := api.request(api.Endpoints.LoadBalancer, "GET", fmt.Sprintf(`/v2.0/lbaas/pools/%s/members/%s`, poolId, memberId), nil, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v.Member, nil
+}
+
+// メンバー追加
+func (api *V3) CreateMember(poolId uuid.UUID, req *CreateMemberRequest) (*Member, error) {
+	body := map[string]any{"member": req}
+	var v struct {
+		Member Member `json:"member"`
+	}
+	err := api.request(api.Endpoints.LoadBalancer, "POST", fmt.Sprintf(`/v2.0/lbaas/pools/%s/members`, poolId), nil, body, 201, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v.Member, nil
+}
+
+// メンバー更新
+func (api *V3) UpdateMember(poolId, memberId uuid.UUID, req *UpdateMemberRequest) (*Member, error) {
+	body := map[string]any{"member": req}
+	var v struct {
+		Member Member `json:"member"`
+	}
+	err := api.request(api.Endpoints.LoadBalancer, "PUT", fmt.Sprintf(`/v2.0/lbaas/pools/%s/members/%s`, poolId, memberId), nil, body, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v.Member, nil
+}
+
+// メンバー削除
+func (api *V3) DeleteMember(poolId, memberId uuid.UUID) error {
+	return api.request(api.Endpoints.LoadBalancer, "DELETE", fmt.Sprintf(`/v2.0/lbaas/pools/%s/members/%s`, poolId, memberId), nil, nil, 204, nil)
+}
+
+// メンバーの稼働状態が ONLINE になるまで待つ
+// ヘルスモニターがない場合(NO_MONITOR)は待たずに返す
+func (api *V3) WaitMemberOnline(ctx context.Context, poolId, memberId uuid.UUID, interval time.Duration) (*Member, error) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	for {
+		m, err := api.GetMember(poolId, memberId)
+		if err != nil {
+			return nil, err
+		}
+		if m.ProvisioningStatus == "ERROR" {
+			return m, fmt.Errorf(`member %s: provisioning status is ERROR`, memberId)
+		}
+		if m.OperatingStatus == "ONLINE" || m.OperatingStatus == "NO_MONITOR" {
+			return m, nil
+		}
+		select {
+		case <-ctx.Done():
+			return m, fmt.Errorf(`member %s: operating status is %s: %w`, memberId, m.OperatingStatus, ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
+
+// ヘルスモニター一覧取得
+func (api *V3) GetHealthMonitors(query url.Values) (*GetHealthMonitorsResponse, error) {
+	var v GetHealthMonitorsResponse
+	err := api.request(api.Endpoints.LoadBalancer, "GET", "/v2.0/lbaas/healthmonitors", query, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// ヘルスモニター詳細取得
+func (api *V3) GetHealthMonitor(id uuid.UUID) (*HealthMonitor, error) {
+	var v struct {
+		HealthMonitor HealthMonitor `json:"healthmonitor"`
+	}
+	err := api.request(api.Endpoints.LoadBalancer, "GET", fmt.Sprintf(`/v2.0/lbaas/healthmonitors/%s`, id), nil, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v.HealthMonitor, nil
+}
+
+// ヘルスモニター作成
+func (api *V3) CreateHealthMonitor(req *CreateHealthMonitorRequest) (*HealthMonitor, error) {
+	body := map[string]any{"healthmonitor": req}
+	var v struct {
+		HealthMonitor HealthMonitor `json:"healthmonitor"`
+	}
+	err := api.request(api.Endpoints.LoadBalancer, "POST", "/v2.0/lbaas/healthmonitors", nil, body, 201, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v.HealthMonitor, nil
+}
+
+// ヘルスモニター更新
+func (api *V3) UpdateHealthMonitor(id uuid.UUID, req *UpdateHealthMonitorRequest) (*HealthMonitor, error) {
+	body := map[string]any{"healthmonitor": req}
+	var v struct {
+		HealthMonitor HealthMonitor `json:"healthmonitor"`
+	}
+	err := api.request(api.Endpoints.LoadBalancer, "PUT", fmt.Sprintf(`/v2.0/lbaas/healthmonitors/%s`, id), nil, body, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v.HealthMonitor, nil
+}
+
+// ヘルスモニター削除
+func (api *V3) DeleteHealthMonitor(id uuid.UUID) error {
+	return api.request(api.Endpoints.LoadBalancer, "DELETE", fmt.Sprintf(`/v2.0/lbaas/healthmonitors/%s`, id), nil, nil, 204, nil)
+}
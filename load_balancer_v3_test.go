@@ -1 +1,216 @@
 package conoha
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newLbTestServer(t *testing.T) (*resourceTestServer, *V3) {
+	s := newResourceTestServer(t)
+	s.created = "2024-01-02T03:04:05"
+	s.notFound = func(message string) any {
+		return map[string]any{"faultcode": "Client", "faultstring": message, "debuginfo": nil}
+	}
+	api := NewV3()
+	api.Endpoints.LoadBalancer, _ = url.Parse(s.URL)
+	return s, api
+}
+
+func TestLoadBalancer(t *testing.T) {
+	s, api := newLbTestServer(t)
+	subnet := uuid.New()
+	lb, err := api.CreateLoadBalancer(&CreateLoadBalancerRequest{Name: "web", VipSubnetId: &subnet})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lb.Name != "web" || lb.VipSubnetId != subnet.String() || lb.ProvisioningStatus != "ACTIVE" {
+		t.Errorf("load balancer: %+v", lb)
+	}
+	if lb.CreatedAt.Format(time.RFC3339) != "2024-01-02T12:04:05+09:00" || !lb.UpdatedAt.IsZero() {
+		t.Errorf("created_at: %v, updated_at: %v", lb.CreatedAt, lb.UpdatedAt)
+	}
+	if _, ok := s.bodies[0]["vip_network_id"]; ok {
+		t.Errorf("body: %v", s.bodies[0])
+	}
+
+	name := "web2"
+	lb, err = api.UpdateLoadBalancer(lb.Id, &UpdateLoadBalancerRequest{Name: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lb.Name != "web2" || len(s.bodies[1]) != 1 {
+		t.Errorf("load balancer: %+v, body: %v", lb, s.bodies[1])
+	}
+
+	limit := 1000
+	listener, err := api.CreateListener(&CreateListenerRequest{LoadBalancerId: lb.Id, Protocol: LbProtocolHttp, ProtocolPort: 80, ConnectionLimit: &limit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listener.Protocol != "HTTP" || listener.ProtocolPort != 80 || listener.ConnectionLimit != 1000 {
+		t.Errorf("listener: %+v", listener)
+	}
+
+	pool, err := api.CreatePool(&CreatePoolRequest{
+		ListenerId:         &listener.Id,
+		Protocol:           LbProtocolHttp,
+		LbAlgorithm:        LbAlgorithmRoundRobin,
+		SessionPersistence: &SessionPersistence{Type: LbPersistenceHttpCookie},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.LbAlgorithm != "ROUND_ROBIN" || pool.SessionPersistence.Type != "HTTP_COOKIE" {
+		t.Errorf("pool: %+v", pool)
+	}
+	pools, err := api.GetPools(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools.Pools) != 1 || pools.Pools[0].Id != pool.Id {
+		t.Errorf("pools: %+v", pools)
+	}
+
+	if err := api.DeletePool(pool.Id); err != nil {
+		t.Fatal(err)
+	}
+	_, err = api.GetPool(pool.Id)
+	if err == nil || !strings.Contains(err.Error(), "could not be found") {
+		t.Errorf("error: %v", err)
+	}
+}
+
+func TestWaitLoadBalancerActive(t *testing.T) {
+	s, api := newLbTestServer(t)
+	lb, err := api.CreateLoadBalancer(&CreateLoadBalancerRequest{Name: "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	s.get = func(collection string, obj map[string]any) {
+		calls++
+		obj["provisioning_status"] = "PENDING_UPDATE"
+		if calls >= 3 {
+			obj["provisioning_status"] = "ACTIVE"
+		}
+	}
+	lb, err = api.WaitLoadBalancerActive(context.Background(), lb.Id, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lb.ProvisioningStatus != "ACTIVE" || calls != 3 {
+		t.Errorf("status: %s, calls: %d", lb.ProvisioningStatus, calls)
+	}
+
+	s.get = func(collection string, obj map[string]any) {
+		obj["provisioning_status"] = "ERROR"
+	}
+	if _, err := api.WaitLoadBalancerActive(context.Background(), lb.Id, time.Millisecond); err == nil {
+		t.Error("no error")
+	}
+}
+
+func TestMember(t *testing.T) {
+	s, api := newLbTestServer(t)
+	pool := uuid.New()
+	weight := 10
+	m, err := api.CreateMember(pool, &CreateMemberRequest{Address: "192.0.2.10", ProtocolPort: 8080, Weight: &weight})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Address != "192.0.2.10" || m.ProtocolPort != 8080 || m.Weight != 10 {
+		t.Errorf("member: %+v", m)
+	}
+	weight = 0
+	m, err = api.UpdateMember(pool, m.Id, &UpdateMemberRequest{Weight: &weight})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 重み0も送信する
+	if m.Weight != 0 || s.bodies[1]["weight"] != float64(0) {
+		t.Errorf("member: %+v, body: %v", m, s.bodies[1])
+	}
+	members, err := api.GetMembers(pool, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members.Members) != 1 {
+		t.Errorf("members: %+v", members)
+	}
+	if err := api.DeleteMember(pool, m.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.GetMember(pool, m.Id); err == nil {
+		t.Error("member is not deleted")
+	}
+}
+
+func TestHealthMonitor(t *testing.T) {
+	_, api := newLbTestServer(t)
+	hm, err := api.CreateHealthMonitor(&CreateHealthMonitorRequest{
+		PoolId:        uuid.New(),
+		Type:          LbMonitorHttp,
+		Delay:         5,
+		Timeout:       3,
+		MaxRetries:    2,
+		UrlPath:       "/healthz",
+		ExpectedCodes: "200-204",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hm.Type != "HTTP" || hm.Delay != 5 || hm.UrlPath != "/healthz" || hm.ExpectedCodes != "200-204" {
+		t.Errorf("health monitor: %+v", hm)
+	}
+	path := "/livez"
+	hm, err = api.UpdateHealthMonitor(hm.Id, &UpdateHealthMonitorRequest{UrlPath: &path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hm.UrlPath != "/livez" || hm.Delay != 5 {
+		t.Errorf("health monitor: %+v", hm)
+	}
+	if err := api.DeleteHealthMonitor(hm.Id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitMemberOnline(t *testing.T) {
+	s, api := newLbTestServer(t)
+	pool := uuid.New()
+	m, err := api.CreateMember(pool, &CreateMemberRequest{Address: "192.0.2.10", ProtocolPort: 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	s.get = func(collection string, obj map[string]any) {
+		calls++
+		obj["operating_status"] = "OFFLINE"
+		if calls >= 3 {
+			obj["operating_status"] = "ONLINE"
+		}
+	}
+	m, err = api.WaitMemberOnline(context.Background(), pool, m.Id, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.OperatingStatus != "ONLINE" || calls != 3 {
+		t.Errorf("status: %s, calls: %d", m.OperatingStatus, calls)
+	}
+
+	s.get = func(collection string, obj map[string]any) {
+		obj["operating_status"] = "ERROR"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = api.WaitMemberOnline(ctx, pool, m.Id, time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "ERROR") {
+		t.Errorf("error: %v", err)
+	}
+}
@@ -0,0 +1,401 @@
+package conoha
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type (
+	SecurityGroup struct {
+		Id                 uuid.UUID           `json:"id"`
+		Name               string              `json:"name"`
+		Description        string              `json:"description"`
+		TenantId           string              `json:"tenant_id"`
+		ProjectId          string              `json:"project_id"`
+		SecurityGroupRules []SecurityGroupRule `json:"security_group_rules"`
+		Tags               []string            `json:"tags"`
+		CreatedAt          time.Time           `json:"created_at"`
+		UpdatedAt          time.Time           `json:"updated_at"`
+	}
+	SecurityGroupRule struct {
+		Id              uuid.UUID `json:"id"`
+		SecurityGroupId string    `json:"security_group_id"`
+		Description     string    `json:"description"`
+		Direction       string    `json:"direction"`      // ingress, egress
+		Ethertype       string    `json:"ethertype"`      // IPv4, IPv6
+		Protocol        string    `json:"protocol"`       // 空の場合は全て
+		PortRangeMin    *int      `json:"port_range_min"` // ICMPの場合はタイプ
+		PortRangeMax    *int      `json:"port_range_max"` // ICMPの場合はコード
+		RemoteIpPrefix  string    `json:"remote_ip_prefix"`
+		RemoteGroupId   string    `json:"remote_group_id"`
+		TenantId        string    `json:"tenant_id"`
+		ProjectId       string    `json:"project_id"`
+		CreatedAt       time.Time `json:"created_at"`
+		UpdatedAt       time.Time `json:"updated_at"`
+	}
+	// ルールの内容(ポートが0の場合は指定なし)
+	SecurityGroupRuleSpec struct {
+		Direction      string
+		Ethertype      string // 空の場合は IPv4
+		Protocol       string
+		PortRangeMin   int
+		PortRangeMax   int  // 0の場合は PortRangeMin と同じ
+		IcmpType       *int // ICMPのタイプ(nilの場合は全て)
+		IcmpCode       *int // ICMPのコード(nilの場合は全て、IcmpType が必要)
+		RemoteIpPrefix string
+		RemoteGroupId  string
+		Description    string
+	}
+	SecurityGroupChanges struct {
+		Created []SecurityGroupRule
+		Deleted []SecurityGroupRule
+	}
+	GetSecurityGroupsResponse struct {
+		SecurityGroups []SecurityGroup `json:"security_groups"`
+	}
+	GetSecurityGroupRulesResponse struct {
+		SecurityGroupRules []SecurityGroupRule `json:"security_group_rules"`
+	}
+)
+
+func (g *SecurityGroup) toJst() {
+	g.CreatedAt = toJst(g.CreatedAt)
+	g.UpdatedAt = toJst(g.UpdatedAt)
+	for k := range g.SecurityGroupRules {
+		g.SecurityGroupRules[k].toJst()
+	}
+}
+
+func (r *SecurityGroupRule) toJst() {
+	r.CreatedAt = toJst(r.CreatedAt)
+	r.UpdatedAt = toJst(r.UpdatedAt)
+}
+
+func isIcmp(protocol string) bool {
+	switch strings.ToLower(protocol) {
+	case "icmp", "ipv6-icmp", "icmpv6", "1", "58":
+		return true
+	}
+	return false
+}
+
+// 比較のための正規化
+// ICMPの場合は PortRangeMin, PortRangeMax をタイプとコードにする(-1 は指定なし)
+func (s SecurityGroupRuleSpec) normalize() SecurityGroupRuleSpec {
+	s.Direction = strings.ToLower(s.Direction)
+	switch strings.ToLower(s.Ethertype) {
+	case "", "ipv4":
+		s.Ethertype = "IPv4"
+	case "ipv6":
+		s.Ethertype = "IPv6"
+	}
+	s.Protocol = strings.ToLower(s.Protocol)
+	if s.Protocol == "any" {
+		s.Protocol = ""
+	}
+	if isIcmp(s.Protocol) {
+		s.PortRangeMin, s.PortRangeMax = -1, -1
+		if s.IcmpType != nil {
+			s.PortRangeMin = *s.IcmpType
+		}
+		if s.IcmpCode != nil {
+			s.PortRangeMax = *s.IcmpCode
+		}
+	} else if s.PortRangeMin > 0 && s.PortRangeMax == 0 {
+		s.PortRangeMax = s.PortRangeMin
+	}
+	s.IcmpType, s.IcmpCode = nil, nil
+	if p, err := netip.ParsePrefix(s.RemoteIpPrefix); err == nil {
+		s.RemoteIpPrefix = p.Masked().String()
+	} else if a, err := netip.ParseAddr(s.RemoteIpPrefix); err == nil {
+		s.RemoteIpPrefix = netip.PrefixFrom(a, a.BitLen()).String()
+	}
+	// 全てのアドレスは指定なしと同じ
+	if s.RemoteIpPrefix == "0.0.0.0/0" || s.RemoteIpPrefix == "::/0" {
+		s.RemoteIpPrefix = ""
+	}
+	s.RemoteGroupId = strings.ToLower(s.RemoteGroupId)
+	s.Description = ""
+	return s
+}
+
+func (s *SecurityGroupRuleSpec) Validate() error {
+	n := s.normalize()
+	errs := []error{}
+	if n.Direction != "ingress" && n.Direction != "egress" {
+		errs = append(errs, fmt.Errorf(`invalid direction "%s"`, s.Direction))
+	}
+	if n.Ethertype != "IPv4" && n.Ethertype != "IPv6" {
+		errs = append(errs, fmt.Errorf(`invalid ethertype "%s"`, s.Ethertype))
+	}
+	if isIcmp(s.Protocol) {
+		if s.PortRangeMin != 0 || s.PortRangeMax != 0 {
+			errs = append(errs, errors.New(`use icmp type and code instead of port range`))
+		}
+		if n.PortRangeMin < -1 || n.PortRangeMin > 255 {
+			errs = append(errs, fmt.Errorf(`invalid icmp type %d`, n.PortRangeMin))
+		}
+		if n.PortRangeMax < -1 || n.PortRangeMax > 255 {
+			errs = append(errs, fmt.Errorf(`invalid icmp code %d`, n.PortRangeMax))
+		}
+		if s.IcmpType == nil && s.IcmpCode != nil {
+			errs = append(errs, errors.New(`icmp code requires icmp type`))
+		}
+	} else {
+		if n.PortRangeMin < 0 || n.PortRangeMax > 65535 || n.PortRangeMin > n.PortRangeMax {
+			errs = append(errs, fmt.Errorf(`invalid port range %d-%d`, s.PortRangeMin, s.PortRangeMax))
+		}
+		if s.IcmpType != nil || s.IcmpCode != nil {
+			errs = append(errs, fmt.Errorf(`icmp type and code are not allowed for protocol "%s"`, s.Protocol))
+		}
+	}
+	if s.RemoteIpPrefix != "" {
+		p, err := netip.ParsePrefix(s.RemoteIpPrefix)
+		if a, e := netip.ParseAddr(s.RemoteIpPrefix); e == nil {
+			p, err = netip.PrefixFrom(a, a.BitLen()), nil
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf(`invalid remote ip prefix "%s"`, s.RemoteIpPrefix))
+		} else if p.Addr().Is6() != (n.Ethertype == "IPv6") {
+			errs = append(errs, fmt.Errorf(`remote ip prefix "%s" does not match %s`, s.RemoteIpPrefix, n.Ethertype))
+		}
+		if s.RemoteGroupId != "" {
+			errs = append(errs, errors.New(`remote ip prefix and remote group are exclusive`))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *SecurityGroupRule) spec() SecurityGroupRuleSpec {
+	s := SecurityGroupRuleSpec{
+		Direction:      r.Direction,
+		Ethertype:      r.Ethertype,
+		Protocol:       r.Protocol,
+		RemoteIpPrefix: r.RemoteIpPrefix,
+		RemoteGroupId:  r.RemoteGroupId,
+		Description:    r.Description,
+	}
+	switch {
+	case isIcmp(r.Protocol):
+		s.IcmpType, s.IcmpCode = r.PortRangeMin, r.PortRangeMax
+	case r.PortRangeMin != nil && r.PortRangeMax != nil:
+		s.PortRangeMin, s.PortRangeMax = *r.PortRangeMin, *r.PortRangeMax
+	}
+	return s
+}
+
+// セキュリティグループ一覧取得
+func (api *V3) GetSecurityGroups(query url.Values) (*GetSecurityGroupsResponse, error) {
+	var v GetSecurityGroupsResponse
+	err := api.request(api.Endpoints.Network, "GET", "/v2.0/security-groups", query, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	for k := range v.SecurityGroups {
+		v.SecurityGroups[k].toJst()
+	}
+	return &v, nil
+}
+
+// セキュリティグループ詳細取得
+func (api *V3) GetSecurityGroup(id uuid.UUID) (*SecurityGroup, error) {
+	var v struct {
+		SecurityGroup SecurityGroup `json:"security_group"`
+	}
+	err := api.request(api.Endpoints.Network, "GET", fmt.Sprintf(`/v2.0/security-groups/%s`, id), nil, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	v.SecurityGroup.toJst()
+	return &v.SecurityGroup, nil
+}
+
+// セキュリティグループ作成
+func (api *V3) CreateSecurityGroup(name, description string) (*SecurityGroup, error) {
+	body := map[string]any{"security_group": map[string]string{"name": name, "description": description}}
+	var v struct {
+		SecurityGroup SecurityGroup `json:"security_group"`
+	}
+	err := api.request(api.Endpoints.Network, "POST", "/v2.0/security-groups", nil, body, 201, &v)
+	if err != nil {
+		return nil, err
+	}
+	v.SecurityGroup.toJst()
+	return &v.SecurityGroup, nil
+}
+
+// セキュリティグループ更新
+func (api *V3) UpdateSecurityGroup(id uuid.UUID, name, description string) (*SecurityGroup, error) {
+	body := map[string]any{"security_group": map[string]string{"name": name, "description": description}}
+	var v struct {
+		SecurityGroup SecurityGroup `json:"security_group"`
+	}
+	err := api.request(api.Endpoints.Network, "PUT", fmt.Sprintf(`/v2.0/security-groups/%s`, id), nil, body, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	v.SecurityGroup.toJst()
+	return &v.SecurityGroup, nil
+}
+
+// セキュリティグループ削除
+func (api *V3) DeleteSecurityGroup(id uuid.UUID) error {
+	return api.request(api.Endpoints.Network, "DELETE", fmt.Sprintf(`/v2.0/security-groups/%s`, id), nil, nil, 204, nil)
+}
+
+// セキュリティグループルール一覧取得
+func (api *V3) GetSecurityGroupRules(query url.Values) (*GetSecurityGroupRulesResponse, error) {
+	var v GetSecurityGroupRulesResponse
+	err := api.request(api.Endpoints.Network, "GET", "/v2.0/security-group-rules", query, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	for k := range v.SecurityGroupRules {
+		v.SecurityGroupRules[k].toJst()
+	}
+	return &v, nil
+}
+
+// セキュリティグループルール詳細取得
+func (api *V3) GetSecurityGroupRule(id uuid.UUID) (*SecurityGroupRule, error) {
+	var v struct {
+		SecurityGroupRule SecurityGroupRule `json:"security_group_rule"`
+	}
+	err := api.request(api.Endpoints.Network, "GET", fmt.Sprintf(`/v2.0/security-group-rules/%s`, id), nil, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	v.SecurityGroupRule.toJst()
+	return &v.SecurityGroupRule, nil
+}
+
+// セキュリティグループルール作成
+func (api *V3) CreateSecurityGroupRule(groupId uuid.UUID, spec *SecurityGroupRuleSpec) (*SecurityGroupRule, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	n := spec.normalize()
+	rule := map[string]any{
+		"security_group_id": groupId,
+		"direction":         n.Direction,
+		"ethertype":         n.Ethertype,
+	}
+	if n.Protocol != "" {
+		rule["protocol"] = n.Protocol
+	}
+	switch {
+	case isIcmp(n.Protocol):
+		// タイプとコードは指定したものだけ送る
+		if n.PortRangeMin >= 0 {
+			rule["port_range_min"] = n.PortRangeMin
+		}
+		if n.PortRangeMax >= 0 {
+			rule["port_range_max"] = n.PortRangeMax
+		}
+	case n.PortRangeMin > 0:
+		rule["port_range_min"] = n.PortRangeMin
+		rule["port_range_max"] = n.PortRangeMax
+	}
+	if n.RemoteIpPrefix != "" {
+		rule["remote_ip_prefix"] = n.RemoteIpPrefix
+	}
+	if n.RemoteGroupId != "" {
+		rule["remote_group_id"] = n.RemoteGroupId
+	}
+	if spec.Description != "" {
+		rule["description"] = spec.Description
+	}
+	body := map[string]any{"security_group_rule": rule}
+	var v struct {
+		SecurityGroupRule SecurityGroupRule `json:"security_group_rule"`
+	}
+	err := api.request(api.Endpoints.Network, "POST", "/v2.0/security-group-rules", nil, body, 201, &v)
+	if err != nil {
+		return nil, err
+	}
+	v.SecurityGroupRule.toJst()
+	return &v.SecurityGroupRule, nil
+}
+
+// セキュリティグループルール削除
+func (api *V3) DeleteSecurityGroupRule(id uuid.UUID) error {
+	return api.request(api.Endpoints.Network, "DELETE", fmt.Sprintf(`/v2.0/security-group-rules/%s`, id), nil, nil, 204, nil)
+}
+
+// 指定した名前のセキュリティグループのルールを rules と同じにする(グループがない場合は作成する)
+// 新しいグループには全ての通信を許可する egress のルールが作成されるため、必要な場合は rules に含める
+// 通信が途切れないよう、ルールの追加を先に行う
+func (api *V3) EnsureSecurityGroup(name, description string, rules []SecurityGroupRuleSpec) (*SecurityGroup, *SecurityGroupChanges, error) {
+	errs := []error{}
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+	groups, err := api.GetSecurityGroups(url.Values{"name": {name}})
+	if err != nil {
+		return nil, nil, err
+	}
+	var group *SecurityGroup
+	switch len(groups.SecurityGroups) {
+	case 0:
+		group, err = api.CreateSecurityGroup(name, description)
+		if err != nil {
+			return nil, nil, err
+		}
+	case 1:
+		group = &groups.SecurityGroups[0]
+	default:
+		return nil, nil, fmt.Errorf(`%d security groups named "%s"`, len(groups.SecurityGroups), name)
+	}
+
+	changes := &SecurityGroupChanges{}
+	current := map[SecurityGroupRuleSpec][]SecurityGroupRule{}
+	for _, r := range group.SecurityGroupRules {
+		k := r.spec().normalize()
+		current[k] = append(current[k], r)
+	}
+	desired := map[SecurityGroupRuleSpec]bool{}
+	for _, r := range rules {
+		k := r.normalize()
+		if desired[k] {
+			continue
+		}
+		desired[k] = true
+		if len(current[k]) > 0 {
+			continue
+		}
+		v, err := api.CreateSecurityGroupRule(group.Id, &r)
+		if err != nil {
+			return group, changes, err
+		}
+		changes.Created = append(changes.Created, *v)
+	}
+	for k, list := range current {
+		for i, r := range list {
+			// 重複したルールは1つだけ残す
+			if desired[k] && i == 0 {
+				continue
+			}
+			err := api.DeleteSecurityGroupRule(r.Id)
+			if err != nil {
+				return group, changes, err
+			}
+			changes.Deleted = append(changes.Deleted, r)
+		}
+	}
+	group, err = api.GetSecurityGroup(group.Id)
+	if err != nil {
+		return nil, changes, err
+	}
+	return group, changes, nil
+}
@@ -0,0 +1,113 @@
+package conoha
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSecurityGroupRuleSpec(t *testing.T) {
+	zero, eight, big := 0, 8, 256
+	a := SecurityGroupRuleSpec{Direction: "INGRESS", Protocol: "TCP", PortRangeMin: 22, RemoteIpPrefix: "203.0.113.5"}
+	b := SecurityGroupRuleSpec{Direction: "ingress", Ethertype: "IPv4", Protocol: "tcp", PortRangeMin: 22, PortRangeMax: 22, RemoteIpPrefix: "203.0.113.5/32", Description: "ssh"}
+	if a.normalize() != b.normalize() {
+		t.Errorf("%+v != %+v", a.normalize(), b.normalize())
+	}
+	// ICMPのタイプ0は指定なしと区別し、コードはタイプと同じにしない
+	icmp := SecurityGroupRuleSpec{Direction: "ingress", Protocol: "icmp"}
+	echoReply := SecurityGroupRuleSpec{Direction: "ingress", Protocol: "icmp", IcmpType: &zero}
+	echo := SecurityGroupRuleSpec{Direction: "ingress", Protocol: "icmp", IcmpType: &eight}
+	if icmp.normalize() == echoReply.normalize() || echo.normalize().PortRangeMax != -1 {
+		t.Errorf("icmp: %+v, %+v, %+v", icmp.normalize(), echoReply.normalize(), echo.normalize())
+	}
+	other := 8
+	if echo.normalize() != (SecurityGroupRuleSpec{Direction: "ingress", Protocol: "ICMP", IcmpType: &other}).normalize() {
+		t.Errorf("icmp: %+v", echo.normalize())
+	}
+	c := SecurityGroupRuleSpec{Direction: "egress", RemoteIpPrefix: "0.0.0.0/0"}
+	if c.normalize().RemoteIpPrefix != "" {
+		t.Errorf("remote ip prefix: %s", c.normalize().RemoteIpPrefix)
+	}
+	for _, s := range []SecurityGroupRuleSpec{
+		{Direction: "inbound"},
+		{Direction: "ingress", Ethertype: "ipx"},
+		{Direction: "ingress", PortRangeMin: 100, PortRangeMax: 80},
+		{Direction: "ingress", RemoteIpPrefix: "2001:db8::/32"},
+		{Direction: "ingress", RemoteIpPrefix: "203.0.113.0/24", RemoteGroupId: "d0c1b7c5-8f5e-4e4f-9e55-3a5f2e9f6d3a"},
+		{Direction: "ingress", Protocol: "icmp", PortRangeMin: 8},
+		{Direction: "ingress", Protocol: "icmp", IcmpType: &big},
+		{Direction: "ingress", Protocol: "icmp", IcmpCode: &zero},
+		{Direction: "ingress", Protocol: "tcp", IcmpType: &zero},
+	} {
+		if err := s.Validate(); err == nil {
+			t.Errorf("%+v is valid", s)
+		}
+	}
+}
+
+func TestEnsureSecurityGroup(t *testing.T) {
+	s, api := newNetworkTestServer(t)
+	// グループにルールを含めて返す
+	s.get = func(collection string, obj map[string]any) {
+		if collection != "/v2.0/security-groups" {
+			return
+		}
+		rules := []map[string]any{}
+		for _, r := range s.objects["/v2.0/security-group-rules"] {
+			if fmt.Sprint(r["security_group_id"]) == obj["id"] {
+				rules = append(rules, r)
+			}
+		}
+		obj["security_group_rules"] = rules
+	}
+	zero, eight := 0, 8
+	rules := []SecurityGroupRuleSpec{
+		{Direction: "ingress", Protocol: "tcp", PortRangeMin: 22, RemoteIpPrefix: "203.0.113.0/24"},
+		{Direction: "ingress", Protocol: "tcp", PortRangeMin: 443},
+		{Direction: "egress"},
+		{Direction: "egress", Ethertype: "IPv6"},
+		// echo reply(タイプ0)の全てのコード
+		{Direction: "ingress", Protocol: "icmp", IcmpType: &zero},
+		{Direction: "ingress", Protocol: "ICMP", IcmpType: &eight, IcmpCode: &zero},
+	}
+	group, changes, err := api.EnsureSecurityGroup("web", "web servers", rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if group.Name != "web" || len(group.SecurityGroupRules) != 6 || len(changes.Created) != 6 || len(changes.Deleted) != 0 {
+		t.Errorf("group: %+v, changes: %+v", group, changes)
+	}
+	if b := s.bodies[len(s.bodies)-2]; b["port_range_min"] != float64(0) || b["port_range_max"] != nil {
+		t.Errorf("icmp: %v", b)
+	}
+	if b := s.bodies[len(s.bodies)-1]; b["port_range_min"] != float64(8) || b["port_range_max"] != float64(0) {
+		t.Errorf("icmp: %v", b)
+	}
+
+	// 変更がない場合は何もしない
+	_, changes, err = api.EnsureSecurityGroup("web", "web servers", rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Created) != 0 || len(changes.Deleted) != 0 {
+		t.Errorf("changes: %+v", changes)
+	}
+
+	rules[1].PortRangeMin = 8443
+	group, changes, err = api.EnsureSecurityGroup("web", "web servers", rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Created) != 1 || *changes.Created[0].PortRangeMax != 8443 || len(changes.Deleted) != 1 || *changes.Deleted[0].PortRangeMin != 443 {
+		t.Errorf("changes: %+v", changes)
+	}
+	if len(group.SecurityGroupRules) != 6 {
+		t.Errorf("rules: %+v", group.SecurityGroupRules)
+	}
+	groups, err := api.GetSecurityGroups(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups.SecurityGroups) != 1 {
+		t.Errorf("groups: %+v", groups)
+	}
+}
@@ -1 +1,307 @@
 package conoha
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type (
+	Network struct {
+		Id           uuid.UUID `json:"id"`
+		Name         string    `json:"name"`
+		Description  string    `json:"description"`
+		TenantId     string    `json:"tenant_id"`
+		ProjectId    string    `json:"project_id"`
+		Status       string    `json:"status"`
+		Subnets      []string  `json:"subnets"`
+		AdminStateUp bool      `json:"admin_state_up"`
+		Shared       bool      `json:"shared"`
+		External     bool      `json:"router:external"`
+		Mtu          int       `json:"mtu"`
+		Tags         []string  `json:"tags"`
+		CreatedAt    time.Time `json:"created_at"`
+		UpdatedAt    time.Time `json:"updated_at"`
+	}
+	AllocationPool struct {
+		Start string `json:"start"`
+		End   string `json:"end"`
+	}
+	HostRoute struct {
+		Destination string `json:"destination"`
+		Nexthop     string `json:"nexthop"`
+	}
+	Subnet struct {
+		Id              uuid.UUID        `json:"id"`
+		Name            string           `json:"name"`
+		Description     string           `json:"description"`
+		NetworkId       string           `json:"network_id"`
+		TenantId        string           `json:"tenant_id"`
+		ProjectId       string           `json:"project_id"`
+		IpVersion       int              `json:"ip_version"`
+		Cidr            string           `json:"cidr"`
+		GatewayIp       string           `json:"gateway_ip"`
+		EnableDhcp      bool             `json:"enable_dhcp"`
+		AllocationPools []AllocationPool `json:"allocation_pools"`
+		DnsNameservers  []string         `json:"dns_nameservers"`
+		HostRoutes      []HostRoute      `json:"host_routes"`
+		Tags            []string         `json:"tags"`
+		CreatedAt       time.Time        `json:"created_at"`
+		UpdatedAt       time.Time        `json:"updated_at"`
+	}
+	// リクエストでは SubnetId と IpAddress のどちらかのみでもよい
+	FixedIp struct {
+		SubnetId  string `json:"subnet_id,omitempty"`
+		IpAddress string `json:"ip_address,omitempty"`
+	}
+	Port struct {
+		Id             uuid.UUID `json:"id"`
+		Name           string    `json:"name"`
+		Description    string    `json:"description"`
+		NetworkId      string    `json:"network_id"`
+		TenantId       string    `json:"tenant_id"`
+		ProjectId      string    `json:"project_id"`
+		MacAddress     string    `json:"mac_address"`
+		Status         string    `json:"status"`
+		AdminStateUp   bool      `json:"admin_state_up"`
+		DeviceId       string    `json:"device_id"`
+		DeviceOwner    string    `json:"device_owner"`
+		FixedIps       []FixedIp `json:"fixed_ips"`
+		SecurityGroups []string  `json:"security_groups"`
+		Tags           []string  `json:"tags"`
+		CreatedAt      time.Time `json:"created_at"`
+		UpdatedAt      time.Time `json:"updated_at"`
+	}
+	CreateNetworkRequest struct {
+		Name         string   `json:"name,omitempty"`
+		Description  string   `json:"description,omitempty"`
+		AdminStateUp *bool    `json:"admin_state_up,omitempty"`
+		Mtu          int      `json:"mtu,omitempty"`
+		Tags         []string `json:"tags,omitempty"`
+	}
+	CreateSubnetRequest struct {
+		Name            string           `json:"name,omitempty"`
+		Description     string           `json:"description,omitempty"`
+		NetworkId       uuid.UUID        `json:"network_id"`
+		IpVersion       int              `json:"ip_version"` // 0の場合は4
+		Cidr            string           `json:"cidr"`
+		GatewayIp       *string          `json:"gateway_ip,omitempty"`
+		EnableDhcp      *bool            `json:"enable_dhcp,omitempty"`
+		AllocationPools []AllocationPool `json:"allocation_pools,omitempty"`
+		DnsNameservers  []string         `json:"dns_nameservers,omitempty"`
+		HostRoutes      []HostRoute      `json:"host_routes,omitempty"`
+		Tags            []string         `json:"tags,omitempty"`
+	}
+	CreatePortRequest struct {
+		Name           string    `json:"name,omitempty"`
+		Description    string    `json:"description,omitempty"`
+		NetworkId      uuid.UUID `json:"network_id"`
+		FixedIps       []FixedIp `json:"fixed_ips,omitempty"`
+		SecurityGroups *[]string `json:"security_groups,omitempty"`
+		AdminStateUp   *bool     `json:"admin_state_up,omitempty"`
+		Tags           []string  `json:"tags,omitempty"`
+	}
+	// nilの項目は変更しない
+	UpdatePortRequest struct {
+		Name           *string    `json:"name,omitempty"`
+		Description    *string    `json:"description,omitempty"`
+		FixedIps       *[]FixedIp `json:"fixed_ips,omitempty"`
+		SecurityGroups *[]string  `json:"security_groups,omitempty"`
+		AdminStateUp   *bool      `json:"admin_state_up,omitempty"`
+	}
+	GetNetworksResponse struct {
+		Networks []Network `json:"networks"`
+	}
+	GetSubnetsResponse struct {
+		Subnets []Subnet `json:"subnets"`
+	}
+	GetPortsResponse struct {
+		Ports []Port `json:"ports"`
+	}
+)
+
+func (n *Network) toJst() {
+	n.CreatedAt = toJst(n.CreatedAt)
+	n.UpdatedAt = toJst(n.UpdatedAt)
+}
+
+func (s *Subnet) toJst() {
+	s.CreatedAt = toJst(s.CreatedAt)
+	s.UpdatedAt = toJst(s.UpdatedAt)
+}
+
+func (p *Port) toJst() {
+	p.CreatedAt = toJst(p.CreatedAt)
+	p.UpdatedAt = toJst(p.UpdatedAt)
+}
+
+// ネットワーク一覧取得
+func (api *V3) GetNetworks(query url.Values) (*GetNetworksResponse, error) {
+	var v GetNetworksResponse
+	err := api.request(api.Endpoints.Network, "GET", "/v2.0/networks", query, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	for k := range v.Networks {
+		v.Networks[k].toJst()
+	}
+	return &v, nil
+}
+
+// ネットワーク詳細取得
+func (api *V3) GetNetwork(id uuid.UUID) (*Network, error) {
+	var v struct {
+		Network Network `json:"network"`
+	}
+	err := api.request(api.Endpoints.Network, "GET", fmt.Sprintf(`/v2.0/networks/%s`, id), nil, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	v.Network.toJst()
+	return &v.Network, nil
+}
+
+// ネットワーク作成
+func (api *V3) CreateNetwork(req *CreateNetworkRequest) (*Network, error) {
+	body := map[string]any{"network": req}
+	var v struct {
+		Network Network `json:"network"`
+	}
+	err := api.request(api.Endpoints.Network, "POST", "/v2.0/networks", nil, body, 201, &v)
+	if err != nil {
+		return nil, err
+	}
+	v.Network.toJst()
+	return &v.Network, nil
+}
+
+// ネットワーク削除
+func (api *V3) DeleteNetwork(id uuid.UUID) error {
+	return api.request(api.Endpoints.Network, "DELETE", fmt.Sprintf(`/v2.0/networks/%s`, id), nil, nil, 204, nil)
+}
+
+// ローカルネットワーク作成(ネットワークとサブネット)
+// サブネットの作成に失敗した場合はネットワークを削除する
+func (api *V3) CreateLocalNetwork(name, cidr string) (*Network, *Subnet, error) {
+	network, err := api.CreateNetwork(&CreateNetworkRequest{Name: name})
+	if err != nil {
+		return nil, nil, err
+	}
+	subnet, err := api.CreateSubnet(&CreateSubnetRequest{NetworkId: network.Id, Cidr: cidr})
+	if err != nil {
+		return nil, nil, errors.Join(err, api.DeleteNetwork(network.Id))
+	}
+	network.Subnets = append(network.Subnets, subnet.Id.String())
+	return network, subnet, nil
+}
+
+// サブネット一覧取得
+func (api *V3) GetSubnets(query url.Values) (*GetSubnetsResponse, error) {
+	var v GetSubnetsResponse
+	err := api.request(api.Endpoints.Network, "GET", "/v2.0/subnets", query, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	for k := range v.Subnets {
+		v.Subnets[k].toJst()
+	}
+	return &v, nil
+}
+
+// サブネット詳細取得
+func (api *V3) GetSubnet(id uuid.UUID) (*Subnet, error) {
+	var v struct {
+		Subnet Subnet `json:"subnet"`
+	}
+	err := api.request(api.Endpoints.Network, "GET", fmt.Sprintf(`/v2.0/subnets/%s`, id), nil, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	v.Subnet.toJst()
+	return &v.Subnet, nil
+}
+
+// サブネット作成
+func (api *V3) CreateSubnet(req *CreateSubnetRequest) (*Subnet, error) {
+	r := *req
+	if r.IpVersion == 0 {
+		r.IpVersion = 4
+	}
+	body := map[string]any{"subnet": r}
+	var v struct {
+		Subnet Subnet `json:"subnet"`
+	}
+	err := api.request(api.Endpoints.Network, "POST", "/v2.0/subnets", nil, body, 201, &v)
+	if err != nil {
+		return nil, err
+	}
+	v.Subnet.toJst()
+	return &v.Subnet, nil
+}
+
+// サブネット削除
+func (api *V3) DeleteSubnet(id uuid.UUID) error {
+	return api.request(api.Endpoints.Network, "DELETE", fmt.Sprintf(`/v2.0/subnets/%s`, id), nil, nil, 204, nil)
+}
+
+// ポート一覧取得
+func (api *V3) GetPorts(query url.Values) (*GetPortsResponse, error) {
+	var v GetPortsResponse
+	err := api.request(api.Endpoints.Network, "GET", "/v2.0/ports", query, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	for k := range v.Ports {
+		v.Ports[k].toJst()
+	}
+	return &v, nil
+}
+
+// ポート詳細取得
+func (api *V3) GetPort(id uuid.UUID) (*Port, error) {
+	var v struct {
+		Port Port `json:"port"`
+	}
+	err := api.request(api.Endpoints.Network, "GET", fmt.Sprintf(`/v2.0/ports/%s`, id), nil, nil, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	v.Port.toJst()
+	return &v.Port, nil
+}
+
+// ポート作成
+func (api *V3) CreatePort(req *CreatePortRequest) (*Port, error) {
+	body := map[string]any{"port": req}
+	var v struct {
+		Port Port `json:"port"`
+	}
+	err := api.request(api.Endpoints.Network, "POST", "/v2.0/ports", nil, body, 201, &v)
+	if err != nil {
+		return nil, err
+	}
+	v.Port.toJst()
+	return &v.Port, nil
+}
+
+// ポート更新
+func (api *V3) UpdatePort(id uuid.UUID, req *UpdatePortRequest) (*Port, error) {
+	body := map[string]any{"port": req}
+	var v struct {
+		Port Port `json:"port"`
+	}
+	err := api.request(api.Endpoints.Network, "PUT", fmt.Sprintf(`/v2.0/ports/%s`, id), nil, body, 200, &v)
+	if err != nil {
+		return nil, err
+	}
+	v.Port.toJst()
+	return &v.Port, nil
+}
+
+// ポート削除
+func (api *V3) DeletePort(id uuid.UUID) error {
+	return api.request(api.Endpoints.Network, "DELETE", fmt.Sprintf(`/v2.0/ports/%s`, id), nil, nil, 204, nil)
+}
@@ -1 +1,100 @@
 package conoha
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newNetworkTestServer(t *testing.T) (*resourceTestServer, *V3) {
+	s := newResourceTestServer(t)
+	s.notFound = func(message string) any {
+		return map[string]any{"NeutronError": map[string]any{"type": "NotFound", "message": message, "detail": ""}}
+	}
+	api := NewV3()
+	api.Endpoints.Network, _ = url.Parse(s.URL)
+	return s, api
+}
+
+func TestCreateLocalNetwork(t *testing.T) {
+	s, api := newNetworkTestServer(t)
+	network, subnet, err := api.CreateLocalNetwork("local", "192.168.0.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if network.Name != "local" || subnet.Cidr != "192.168.0.0/24" || subnet.IpVersion != 4 || subnet.NetworkId != network.Id.String() {
+		t.Errorf("network: %+v, subnet: %+v", network, subnet)
+	}
+	if len(network.Subnets) != 1 || network.Subnets[0] != subnet.Id.String() {
+		t.Errorf("subnets: %v", network.Subnets)
+	}
+	if network.CreatedAt.Format(time.RFC3339) != "2024-01-02T12:04:05+09:00" {
+		t.Errorf("created_at: %v", network.CreatedAt)
+	}
+
+	// サブネットの作成に失敗した場合はネットワークを削除する
+	s.mu.Lock()
+	s.fail = func(r *http.Request) any {
+		if strings.HasSuffix(r.URL.Path, "/subnets") {
+			return map[string]any{"NeutronError": map[string]any{"type": "InvalidInput", "message": "Invalid input for cidr", "detail": ""}}
+		}
+		return nil
+	}
+	s.mu.Unlock()
+	_, _, err = api.CreateLocalNetwork("broken", "192.168.0.0/33")
+	if err == nil || !strings.Contains(err.Error(), "Invalid input for cidr") {
+		t.Errorf("error: %v", err)
+	}
+	networks, err := api.GetNetworks(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(networks.Networks) != 1 {
+		t.Errorf("networks: %+v", networks)
+	}
+}
+
+func TestPort(t *testing.T) {
+	_, api := newNetworkTestServer(t)
+	network := uuid.New()
+	port, err := api.CreatePort(&CreatePortRequest{NetworkId: network, FixedIps: []FixedIp{{IpAddress: "192.168.0.10"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(port.FixedIps) != 1 || port.FixedIps[0].IpAddress != "192.168.0.10" {
+		t.Errorf("port: %+v", port)
+	}
+	ips := []FixedIp{{IpAddress: "192.168.0.10"}, {IpAddress: "192.168.0.11"}}
+	port, err = api.UpdatePort(port.Id, &UpdatePortRequest{FixedIps: &ips})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(port.FixedIps) != 2 {
+		t.Errorf("port: %+v", port)
+	}
+	ports, err := api.GetPorts(url.Values{"network_id": {network.String()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ports.Ports) != 1 {
+		t.Errorf("ports: %+v", ports)
+	}
+	ports, err = api.GetPorts(url.Values{"network_id": {uuid.NewString()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ports.Ports) != 0 {
+		t.Errorf("ports: %+v", ports)
+	}
+	if err := api.DeletePort(port.Id); err != nil {
+		t.Fatal(err)
+	}
+	_, err = api.GetPort(port.Id)
+	if err == nil || !strings.Contains(err.Error(), "could not be found") {
+		t.Errorf("error: %v", err)
+	}
+}
@@ -0,0 +1,368 @@
+package conoha
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// セグメントの最大サイズ
+	maxSegmentSize = 5 << 30
+	// SLOのマニフェストに含められるセグメント数の上限
+	maxSloSegments = 1000
+)
+
+type (
+	LargeObjectOptions struct {
+		SegmentContainer string        // 空の場合は "<container>_segments"
+		SegmentSize      int64         // 0の場合は128MiB
+		Concurrency      int           // 0の場合は4
+		Retries          int           // セグメントごとの失敗時の再送回数
+		RetryInterval    time.Duration // 0の場合は1秒
+		ContentType      string
+		Metadata         map[string]string
+	}
+	ObjectSegment struct {
+		Container string
+		Name      string
+		Hash      string
+		Bytes     int64
+	}
+	sloManifestEntry struct {
+		Path      string `json:"path"`
+		Etag      string `json:"etag"`
+		SizeBytes int64  `json:"size_bytes"`
+	}
+)
+
+func (opts *LargeObjectOptions) withDefaults(container string) LargeObjectOptions {
+	o := LargeObjectOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.SegmentContainer == "" {
+		o.SegmentContainer = container + "_segments"
+	}
+	if o.SegmentSize <= 0 {
+		o.SegmentSize = 128 << 20
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 4
+	}
+	if o.RetryInterval <= 0 {
+		o.RetryInterval = time.Second
+	}
+	return o
+}
+
+// 通信エラーと5xxで失敗した場合は retries 回まで再実行する
+func retryStorage(ctx context.Context, retries int, interval time.Duration, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !isRetryable(err) || attempt >= retries || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(interval):
+		}
+	}
+}
+
+// 大きなオブジェクトのアップロード
+// r をセグメントに分割して並列にアップロードし、SLOのマニフェストを作成する
+// 1セグメントに収まる場合は通常のオブジェクトとしてアップロードする
+// メモリは SegmentSize * Concurrency 使用する
+func (api *V3) UploadLargeObject(ctx context.Context, container, name string, r io.Reader, opts *LargeObjectOptions) (*Object, error) {
+	if err := checkObjectName(container, name); err != nil {
+		return nil, err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	o := opts.withDefaults(container)
+	if o.SegmentSize > maxSegmentSize {
+		return nil, fmt.Errorf(`segment size %d exceeds %d bytes`, o.SegmentSize, int64(maxSegmentSize))
+	}
+	// 大きさが分かる場合はアップロード前にセグメント数を確認する
+	if l, ok := r.(interface{ Len() int }); ok {
+		if err := checkSegmentCount((int64(l.Len()) + o.SegmentSize - 1) / o.SegmentSize); err != nil {
+			return nil, err
+		}
+	}
+	br := bufio.NewReader(r)
+	bufs := make([][]byte, o.Concurrency)
+	bufs[0] = make([]byte, o.SegmentSize)
+	n, last, err := readSegment(br, bufs[0])
+	if err != nil {
+		return nil, err
+	}
+	if last {
+		var v *Object
+		err = retryStorage(ctx, o.Retries, o.RetryInterval, func() error {
+			var err error
+			v, err = api.UploadObject(ctx, container, name, bytes.NewReader(bufs[0][:n]), &UploadObjectOptions{ContentType: o.ContentType, Size: int64(n), Metadata: o.Metadata})
+			return err
+		})
+		return v, err
+	}
+	if err := api.CreateContainer(o.SegmentContainer, nil); err != nil {
+		return nil, err
+	}
+	prefix := fmt.Sprintf("%s/slo/%d/%d/", name, time.Now().UnixNano(), o.SegmentSize)
+	segments := []ObjectSegment{}
+	// 失敗したセグメントも保存されている可能性があるため、送信したものは全て削除対象にする
+	attempted := []ObjectSegment{}
+	sizes := []int{n}
+	for {
+		// Concurrency 個までセグメントを読み込んで並列にアップロードする
+		for !last && len(sizes) < o.Concurrency {
+			k := len(sizes)
+			if bufs[k] == nil {
+				bufs[k] = make([]byte, o.SegmentSize)
+			}
+			n, last, err = readSegment(br, bufs[k])
+			if err != nil {
+				return nil, errors.Join(err, api.deleteSegments(attempted, o.Concurrency))
+			}
+			if n > 0 {
+				sizes = append(sizes, n)
+			}
+		}
+		if len(sizes) == 0 {
+			break
+		}
+		if err := checkSegmentCount(int64(len(segments) + len(sizes))); err != nil {
+			return nil, errors.Join(err, api.deleteSegments(attempted, o.Concurrency))
+		}
+		window := make([]ObjectSegment, len(sizes))
+		for k := range window {
+			window[k] = ObjectSegment{Container: o.SegmentContainer, Name: fmt.Sprintf("%s%08d", prefix, len(segments)+k)}
+		}
+		attempted = append(attempted, window...)
+		errs := make([]error, len(sizes))
+		runLimited(len(sizes), o.Concurrency, func(k int) {
+			s := &window[k]
+			errs[k] = retryStorage(ctx, o.Retries, o.RetryInterval, func() error {
+				v, err := api.UploadObject(ctx, s.Container, s.Name, bytes.NewReader(bufs[k][:sizes[k]]), &UploadObjectOptions{Size: int64(sizes[k])})
+				if err != nil {
+					return err
+				}
+				s.Hash, s.Bytes = v.Hash, v.Bytes
+				return nil
+			})
+		})
+		if err := errors.Join(errs...); err != nil {
+			return nil, errors.Join(err, api.deleteSegments(attempted, o.Concurrency))
+		}
+		segments = append(segments, window...)
+		sizes = sizes[:0]
+	}
+	v, err := api.putSloManifest(ctx, container, name, segments, &o)
+	if err != nil {
+		return nil, errors.Join(err, api.deleteSegments(segments, o.Concurrency))
+	}
+	return v, nil
+}
+
+func checkSegmentCount(n int64) error {
+	if n > maxSloSegments {
+		return fmt.Errorf(`too many segments: %d (limit is %d), increase SegmentSize`, n, maxSloSegments)
+	}
+	return nil
+}
+
+// セグメントを1つ読み込む(last は r の終わりに達した場合)
+// バッファがちょうど埋まった場合は1バイト先読みして終わりかどうかを判定する
+func readSegment(r *bufio.Reader, buf []byte) (n int, last bool, err error) {
+	n, err = io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return n, true, nil
+	}
+	if err != nil {
+		return n, false, err
+	}
+	if _, err = r.Peek(1); err == io.EOF {
+		return n, true, nil
+	}
+	return n, false, err
+}
+
+func (api *V3) putSloManifest(ctx context.Context, container, name string, segments []ObjectSegment, o *LargeObjectOptions) (*Object, error) {
+	manifest := make([]sloManifestEntry, len(segments))
+	var total int64
+	for k, s := range segments {
+		manifest[k] = sloManifestEntry{Path: "/" + s.Container + "/" + s.Name, Etag: s.Hash, SizeBytes: s.Bytes}
+		total += s.Bytes
+	}
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	h := http.Header{}
+	h.Set("Content-Length", strconv.Itoa(len(b)))
+	if o.ContentType != "" {
+		h.Set("Content-Type", o.ContentType)
+	}
+	for k, v := range o.Metadata {
+		h.Set("X-Object-Meta-"+k, v)
+	}
+	etag := ""
+	err = retryStorage(ctx, o.Retries, o.RetryInterval, func() error {
+		res, err := api.storageRequest(ctx, "PUT", container, name, url.Values{"multipart-manifest": {"put"}}, h, bytes.NewReader(b), http.StatusCreated)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		etag = strings.Trim(res.Header.Get("Etag"), `"`)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Object{
+		Name:              name,
+		Hash:              etag,
+		Bytes:             total,
+		ContentType:       o.ContentType,
+		Metadata:          o.Metadata,
+		StaticLargeObject: true,
+	}, nil
+}
+
+// セグメントを削除する(既に存在しないものは無視する)
+func (api *V3) deleteSegments(segments []ObjectSegment, concurrency int) error {
+	errs := make([]error, len(segments))
+	runLimited(len(segments), concurrency, func(k int) {
+		err := api.DeleteObject(segments[k].Container, segments[k].Name)
+		if !errors.Is(err, ErrObjectNotFound) {
+			errs[k] = err
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// SLO, DLO のセグメント一覧取得(通常のオブジェクトの場合は nil)
+func (api *V3) GetObjectSegments(container, name string) ([]ObjectSegment, error) {
+	o, err := api.GetObject(container, name)
+	if err != nil {
+		return nil, err
+	}
+	return api.objectSegments(container, o)
+}
+
+func (api *V3) objectSegments(container string, o *Object) ([]ObjectSegment, error) {
+	switch {
+	case o.StaticLargeObject:
+		res, err := api.storageRequest(context.Background(), "GET", container, o.Name, url.Values{"multipart-manifest": {"get"}, "format": {"json"}}, nil, nil, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		var v []Object
+		if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
+			return nil, err
+		}
+		segments := make([]ObjectSegment, len(v))
+		for k, e := range v {
+			c, n, _ := strings.Cut(strings.TrimPrefix(e.Name, "/"), "/")
+			segments[k] = ObjectSegment{Container: c, Name: n, Hash: e.Hash, Bytes: e.Bytes}
+		}
+		return segments, nil
+	case o.ObjectManifest != "":
+		c, prefix, _ := strings.Cut(o.ObjectManifest, "/")
+		v, err := api.GetObjects(c, &StorageListOptions{Prefix: prefix})
+		if err != nil {
+			return nil, err
+		}
+		segments := make([]ObjectSegment, len(v))
+		for k, e := range v {
+			segments[k] = ObjectSegment{Container: c, Name: e.Name, Hash: e.Hash, Bytes: e.Bytes}
+		}
+		return segments, nil
+	}
+	return nil, nil
+}
+
+// 大きなオブジェクトのダウンロード
+// セグメントを並列にダウンロードしてMD5を検証し、順番に w に書き込む
+// 通常のオブジェクトの場合はそのままダウンロードする
+func (api *V3) DownloadLargeObject(ctx context.Context, container, name string, w io.Writer, opts *LargeObjectOptions) (*Object, error) {
+	if err := checkObjectName(container, name); err != nil {
+		return nil, err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	o := opts.withDefaults(container)
+	v, err := api.GetObject(container, name)
+	if err != nil {
+		return nil, err
+	}
+	segments, err := api.objectSegments(container, v)
+	if err != nil {
+		return nil, err
+	}
+	if segments == nil {
+		return api.DownloadObject(ctx, container, name, w, nil)
+	}
+	bufs := make([]bytes.Buffer, o.Concurrency)
+	for start := 0; start < len(segments); start += o.Concurrency {
+		window := segments[start:min(start+o.Concurrency, len(segments))]
+		errs := make([]error, len(window))
+		runLimited(len(window), o.Concurrency, func(k int) {
+			s := window[k]
+			errs[k] = retryStorage(ctx, o.Retries, o.RetryInterval, func() error {
+				bufs[k].Reset()
+				hash := md5.New()
+				if _, err := api.DownloadObject(ctx, s.Container, s.Name, io.MultiWriter(&bufs[k], hash), nil); err != nil {
+					return err
+				}
+				if sum := hex.EncodeToString(hash.Sum(nil)); s.Hash != "" && sum != s.Hash {
+					return fmt.Errorf(`%s/%s: MD5 mismatch: expected %s, got %s`, s.Container, s.Name, s.Hash, sum)
+				}
+				return nil
+			})
+		})
+		if err := errors.Join(errs...); err != nil {
+			return nil, err
+		}
+		for k := range window {
+			if _, err := bufs[k].WriteTo(w); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// 大きなオブジェクトの削除(セグメントも削除する)
+// 通常のオブジェクトの場合はそのまま削除する
+func (api *V3) DeleteLargeObject(container, name string, opts *LargeObjectOptions) error {
+	if err := checkObjectName(container, name); err != nil {
+		return err
+	}
+	o := opts.withDefaults(container)
+	segments, err := api.GetObjectSegments(container, name)
+	if err != nil {
+		return err
+	}
+	// マニフェストを先に削除して中途半端な内容が読まれないようにする
+	if err := api.DeleteObject(container, name); err != nil {
+		return err
+	}
+	return api.deleteSegments(segments, o.Concurrency)
+}
@@ -0,0 +1,232 @@
+package conoha
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUploadLargeObject(t *testing.T) {
+	s, api := newStorageTestServer(t)
+	if err := api.CreateContainer("backup", nil); err != nil {
+		t.Fatal(err)
+	}
+	// 各セグメントの最初のアップロードは失敗する
+	failed := map[string]bool{}
+	s.fail = func(r *http.Request) bool {
+		if r.Method != "PUT" || !strings.Contains(r.URL.Path, "/slo/") || failed[r.URL.Path] {
+			return false
+		}
+		failed[r.URL.Path] = true
+		return true
+	}
+	ctx := context.Background()
+	opts := &LargeObjectOptions{SegmentSize: 4, Concurrency: 2, Retries: 1, RetryInterval: time.Millisecond, ContentType: "application/gzip", Metadata: map[string]string{"Host": "db1"}}
+	o, err := api.UploadLargeObject(ctx, "backup", "db.tar.gz", strings.NewReader("0123456789"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !o.StaticLargeObject || o.Bytes != 10 || o.Hash == "" || len(failed) != 3 {
+		t.Errorf("object: %+v, failed: %v", o, failed)
+	}
+	if string(s.object("backup", "db.tar.gz").data) != "0123456789" {
+		t.Errorf("data: %s", s.object("backup", "db.tar.gz").data)
+	}
+	segments, err := api.GetObjectSegments("backup", "db.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 3 || segments[0].Container != "backup_segments" || segments[2].Bytes != 2 || !strings.HasPrefix(segments[0].Name, "db.tar.gz/slo/") {
+		t.Errorf("segments: %+v", segments)
+	}
+	h, err := api.GetObject("backup", "db.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.ContentType != "application/gzip" || h.Metadata["host"] != "db1" || !h.StaticLargeObject {
+		t.Errorf("object: %+v", h)
+	}
+
+	var w bytes.Buffer
+	if _, err := api.DownloadLargeObject(ctx, "backup", "db.tar.gz", &w, opts); err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != "0123456789" {
+		t.Errorf("body: %s", w.String())
+	}
+	// セグメントが壊れている場合は失敗する
+	s.object(segments[1].Container, segments[1].Name).data = []byte("XXXX")
+	_, err = api.DownloadLargeObject(ctx, "backup", "db.tar.gz", &bytes.Buffer{}, opts)
+	if err == nil || !strings.Contains(err.Error(), "MD5 mismatch") {
+		t.Errorf("error: %v", err)
+	}
+
+	if err := api.DeleteLargeObject("backup", "db.tar.gz", nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"db.tar.gz", segments[0].Name, segments[1].Name, segments[2].Name} {
+		if o := s.object("backup", name); o != nil {
+			t.Errorf("%s is not deleted", name)
+		}
+		if o := s.object("backup_segments", name); o != nil {
+			t.Errorf("%s is not deleted", name)
+		}
+	}
+
+	// セグメントの大きさの倍数
+	s.fail = nil
+	o, err = api.UploadLargeObject(ctx, "backup", "even", strings.NewReader("01234567"), &LargeObjectOptions{SegmentSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if segments, _ := api.GetObjectSegments("backup", "even"); len(segments) != 2 || o.Bytes != 8 {
+		t.Errorf("segments: %+v", segments)
+	}
+
+	// 1セグメントに収まる場合は通常のオブジェクト
+	for _, size := range []int64{8, 4} {
+		o, err = api.UploadLargeObject(ctx, "backup", "small", io.MultiReader(strings.NewReader("0123")), &LargeObjectOptions{SegmentSize: size})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if o.StaticLargeObject || o.Bytes != 4 || string(s.object("backup", "small").data) != "0123" {
+			t.Errorf("%d: object: %+v", size, o)
+		}
+		if segments, err := api.GetObjectSegments("backup", "small"); err != nil || segments != nil {
+			t.Errorf("%d: segments: %+v, error: %v", size, segments, err)
+		}
+	}
+}
+
+func TestUploadLargeObjectFailure(t *testing.T) {
+	s, api := newStorageTestServer(t)
+	if err := api.CreateContainer("backup", nil); err != nil {
+		t.Fatal(err)
+	}
+	s.fail = func(r *http.Request) bool {
+		return r.Method == "PUT" && strings.HasSuffix(r.URL.Path, "/00000002")
+	}
+	_, err := api.UploadLargeObject(context.Background(), "backup", "db.tar.gz", strings.NewReader("0123456789"), &LargeObjectOptions{SegmentSize: 4, Concurrency: 2})
+	if err == nil {
+		t.Fatal("upload succeeded")
+	}
+	// アップロード済みのセグメントは削除される
+	objects, err := api.GetObjects("backup_segments", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 0 {
+		t.Errorf("objects: %+v", objects)
+	}
+	if _, err := api.GetObject("backup", "db.tar.gz"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("error: %v", err)
+	}
+
+	// 保存された後に失敗を返したセグメントも削除される
+	s.fail = func(r *http.Request) bool {
+		if r.Method != "PUT" || !strings.HasSuffix(r.URL.Path, "/00000001") {
+			return false
+		}
+		container, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, storageTestBase+"/"), "/")
+		s.handleObject(httptest.NewRecorder(), r, container, name)
+		return true
+	}
+	_, err = api.UploadLargeObject(context.Background(), "backup", "db.tar.gz", strings.NewReader("0123456789"), &LargeObjectOptions{SegmentSize: 4, Concurrency: 2})
+	if err == nil {
+		t.Fatal("upload succeeded")
+	}
+	if objects, err := api.GetObjects("backup_segments", nil); err != nil || len(objects) != 0 {
+		t.Errorf("objects: %+v, error: %v", objects, err)
+	}
+}
+
+func TestUploadLargeObjectLimits(t *testing.T) {
+	s, api := newStorageTestServer(t)
+	ctx := context.Background()
+	_, err := api.UploadLargeObject(ctx, "backup", "db.tar.gz", strings.NewReader("0123"), &LargeObjectOptions{SegmentSize: maxSegmentSize + 1})
+	if err == nil || !strings.Contains(err.Error(), "segment size") {
+		t.Errorf("error: %v", err)
+	}
+	// 大きさが分かる場合は何も送信しない
+	_, err = api.UploadLargeObject(ctx, "backup", "db.tar.gz", strings.NewReader(strings.Repeat("0", maxSloSegments+1)), &LargeObjectOptions{SegmentSize: 1})
+	if err == nil || !strings.Contains(err.Error(), "too many segments") {
+		t.Errorf("error: %v", err)
+	}
+	if len(s.requests) != 0 {
+		t.Errorf("requests: %v", s.requests)
+	}
+	// 大きさが分からない場合はアップロード済みのセグメントを削除する
+	if err := api.CreateContainer("backup", nil); err != nil {
+		t.Fatal(err)
+	}
+	r := io.MultiReader(strings.NewReader(strings.Repeat("0", maxSloSegments+1)))
+	_, err = api.UploadLargeObject(ctx, "backup", "db.tar.gz", r, &LargeObjectOptions{SegmentSize: 1, Concurrency: 8})
+	if err == nil || !strings.Contains(err.Error(), "too many segments") {
+		t.Errorf("error: %v", err)
+	}
+	if objects, err := api.GetObjects("backup_segments", nil); err != nil || len(objects) != 0 {
+		t.Errorf("objects: %d, error: %v", len(objects), err)
+	}
+}
+
+func TestRetryStorage(t *testing.T) {
+	for _, c := range []struct {
+		err   error
+		calls int
+	}{
+		{toStatusError(http.StatusServiceUnavailable, nil), 3},
+		{io.ErrUnexpectedEOF, 3},
+		{toStatusError(http.StatusUnauthorized, nil), 1},
+		{ErrObjectNotFound, 1},
+	} {
+		calls := 0
+		err := retryStorage(context.Background(), 2, time.Millisecond, func() error {
+			calls++
+			return c.err
+		})
+		if err != c.err || calls != c.calls {
+			t.Errorf("%v: calls %d", c.err, calls)
+		}
+	}
+}
+
+func TestDynamicLargeObject(t *testing.T) {
+	s, api := newStorageTestServer(t)
+	s.put("segments", "video/001", []byte("abc"))
+	s.put("segments", "video/002", []byte("def"))
+	s.put("segments", "other", []byte("xyz"))
+	s.put("media", "video.mp4", nil)
+	s.object("media", "video.mp4").header.Set("X-Object-Manifest", "segments/video/")
+
+	segments, err := api.GetObjectSegments("media", "video.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 2 || segments[0].Name != "video/001" || segments[1].Container != "segments" {
+		t.Errorf("segments: %+v", segments)
+	}
+	var w bytes.Buffer
+	o, err := api.DownloadLargeObject(context.Background(), "media", "video.mp4", &w, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != "abcdef" || o.ObjectManifest != "segments/video/" {
+		t.Errorf("body: %s, object: %+v", w.String(), o)
+	}
+	if err := api.DeleteLargeObject("media", "video.mp4", nil); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := api.GetObjects("segments", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Name != "other" {
+		t.Errorf("objects: %+v", objects)
+	}
+}
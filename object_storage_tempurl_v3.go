@@ -0,0 +1,197 @@
+package conoha
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	TempUrlOptions struct {
+		Method   string // 空の場合は GET
+		Prefix   string // 指定した場合は Prefix で始まる全てのオブジェクトに有効
+		IpRange  string // 指定した場合はこのIPアドレス(CIDR)からのみ有効
+		Digest   string // sha1, sha256, sha512 (空の場合は sha256)
+		Filename string // ダウンロード時のファイル名
+		Inline   bool   // Content-Disposition: inline で返す
+	}
+	FormPostOptions struct {
+		Redirect     string // アップロード後のリダイレクト先
+		MaxFileSize  int64
+		MaxFileCount int
+		Digest       string // sha1, sha256, sha512 (空の場合は sha256)
+	}
+	// フォームの送信先とhiddenフィールド
+	FormPost struct {
+		Url    string
+		Fields map[string]string
+	}
+)
+
+// アカウントの一時URLキーを設定する(second が true の場合は2つ目のキー)
+func (api *V3) SetTempUrlKey(key string, second bool) error {
+	name := "Temp-Url-Key"
+	if second {
+		name += "-2"
+	}
+	if key == "" {
+		return api.UpdateStorageAccount(nil, []string{name})
+	}
+	return api.UpdateStorageAccount(map[string]string{name: key}, nil)
+}
+
+// コンテナの一時URLキーを設定する(second が true の場合は2つ目のキー)
+func (api *V3) SetContainerTempUrlKey(container, key string, second bool) error {
+	name := "Temp-Url-Key"
+	if second {
+		name += "-2"
+	}
+	if key == "" {
+		return api.UpdateContainer(container, &ContainerRequest{RemoveMetadata: []string{name}})
+	}
+	return api.UpdateContainer(container, &ContainerRequest{Metadata: map[string]string{name: key}})
+}
+
+func storageHmac(digest, key, message string) (string, error) {
+	var h func() hash.Hash
+	switch digest {
+	case "sha1":
+		h = sha1.New
+	case "", "sha256":
+		h = sha256.New
+	case "sha512":
+		h = sha512.New
+	default:
+		return "", fmt.Errorf(`unsupported digest %s`, digest)
+	}
+	mac := hmac.New(h, []byte(key))
+	mac.Write([]byte(message))
+	// sha512 の署名は "sha512:<base64>" の形式で送る
+	if digest == "sha512" {
+		return "sha512:" + base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+	}
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (api *V3) storageUrl(container, name string) (*url.URL, error) {
+	if api.Endpoints.ObjectStorage == nil {
+		return nil, fmt.Errorf(`endpoint is not set`)
+	}
+	endpoint := *api.Endpoints.ObjectStorage
+	endpoint.Path = storagePath(endpoint.Path, container, name)
+	endpoint.RawPath = ""
+	endpoint.RawQuery = ""
+	return &endpoint, nil
+}
+
+// 一時URLを作成する(通信は行わない)
+// key はアカウントかコンテナに設定した一時URLキー
+func (api *V3) TempUrl(container, name, key string, expires time.Time, opts *TempUrlOptions) (string, error) {
+	if opts == nil {
+		opts = &TempUrlOptions{}
+	}
+	if name == "" {
+		name = opts.Prefix
+	}
+	if err := checkObjectName(container, name); err != nil {
+		return "", err
+	}
+	if key == "" {
+		return "", fmt.Errorf(`temp url key is empty`)
+	}
+	method := strings.ToUpper(opts.Method)
+	if method == "" {
+		method = "GET"
+	}
+	if !slices.Contains([]string{"GET", "HEAD", "PUT", "POST", "DELETE"}, method) {
+		return "", fmt.Errorf(`unsupported method %s`, opts.Method)
+	}
+	if !strings.HasPrefix(name, opts.Prefix) {
+		return "", fmt.Errorf(`%s does not start with prefix %s`, name, opts.Prefix)
+	}
+	u, err := api.storageUrl(container, name)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{}
+	path := u.Path
+	if opts.Prefix != "" {
+		path = "prefix:" + storagePath(api.Endpoints.ObjectStorage.Path, container, opts.Prefix)
+		q.Set("temp_url_prefix", opts.Prefix)
+	}
+	message := fmt.Sprintf("%s\n%d\n%s", method, expires.Unix(), path)
+	if opts.IpRange != "" {
+		if _, err := netip.ParsePrefix(opts.IpRange); err != nil {
+			if _, err := netip.ParseAddr(opts.IpRange); err != nil {
+				return "", fmt.Errorf(`invalid ip range %s`, opts.IpRange)
+			}
+		}
+		message = "ip=" + opts.IpRange + "\n" + message
+		q.Set("temp_url_ip_range", opts.IpRange)
+	}
+	sig, err := storageHmac(opts.Digest, key, message)
+	if err != nil {
+		return "", err
+	}
+	q.Set("temp_url_sig", sig)
+	q.Set("temp_url_expires", strconv.FormatInt(expires.Unix(), 10))
+	if opts.Filename != "" {
+		q.Set("filename", opts.Filename)
+	}
+	u.RawQuery = q.Encode()
+	if opts.Inline {
+		u.RawQuery += "&inline"
+	}
+	return u.String(), nil
+}
+
+// フォームからのアップロード(FormPost)の署名を作成する(通信は行わない)
+// prefix で始まる名前でアップロードされる
+func (api *V3) FormPostSignature(container, prefix, key string, expires time.Time, opts *FormPostOptions) (*FormPost, error) {
+	if opts == nil {
+		opts = &FormPostOptions{}
+	}
+	if container == "" {
+		return nil, fmt.Errorf(`container name is empty`)
+	}
+	if key == "" {
+		return nil, fmt.Errorf(`temp url key is empty`)
+	}
+	if opts.MaxFileSize <= 0 || opts.MaxFileCount <= 0 {
+		return nil, fmt.Errorf(`max file size and max file count are required`)
+	}
+	u, err := api.storageUrl(container, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		// コンテナのパスの後ろにも / が必要
+		u.Path += "/"
+	}
+	message := fmt.Sprintf("%s\n%s\n%d\n%d\n%d", u.Path, opts.Redirect, opts.MaxFileSize, opts.MaxFileCount, expires.Unix())
+	sig, err := storageHmac(opts.Digest, key, message)
+	if err != nil {
+		return nil, err
+	}
+	return &FormPost{
+		Url: u.String(),
+		Fields: map[string]string{
+			"redirect":       opts.Redirect,
+			"max_file_size":  strconv.FormatInt(opts.MaxFileSize, 10),
+			"max_file_count": strconv.Itoa(opts.MaxFileCount),
+			"expires":        strconv.FormatInt(expires.Unix(), 10),
+			"signature":      sig,
+		},
+	}, nil
+}
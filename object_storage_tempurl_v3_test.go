@@ -0,0 +1,119 @@
+package conoha
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTempUrl(t *testing.T) {
+	api := NewV3()
+	api.Endpoints.ObjectStorage, _ = url.Parse("https://object-storage.example.com/v1/AUTH_test")
+	expires := time.Unix(1700000000, 0)
+
+	s, err := api.TempUrl("public", "dir/a b.txt", "secret", expires, &TempUrlOptions{Filename: "a.txt", Inline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "https://object-storage.example.com/v1/AUTH_test/public/dir/a%20b.txt?filename=a.txt&temp_url_expires=1700000000&temp_url_sig=998cf120db83da0897eb4db58d901a0194c4ced021a68aed402a220eaeb36b84&inline"
+	if s != want {
+		t.Errorf("url: %s", s)
+	}
+
+	s, err = api.TempUrl("public", "dir/a b.txt", "secret", expires, &TempUrlOptions{Method: "put", Digest: "sha1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(s)
+	if sig := u.Query().Get("temp_url_sig"); sig != "97d3935f82f8ad5b4f0190af99f245e0b1020aa3" {
+		t.Errorf("signature: %s", sig)
+	}
+
+	s, err = api.TempUrl("public", "", "secret", expires, &TempUrlOptions{Prefix: "dir/", IpRange: "192.0.2.0/24", Digest: "sha512"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ = url.Parse(s)
+	q := u.Query()
+	if u.Path != "/v1/AUTH_test/public/dir/" || q.Get("temp_url_prefix") != "dir/" || q.Get("temp_url_ip_range") != "192.0.2.0/24" {
+		t.Errorf("url: %s", s)
+	}
+	if sig := q.Get("temp_url_sig"); sig != "sha512:aPYaikTcR5CEh5JETvwqB5aRcwyHv5tUL1AufMzlUGeKBz9K/vaNE/ZR1im41msj9zZyUv6F0buxjhsj7FXcMQ==" {
+		t.Errorf("signature: %s", sig)
+	}
+
+	for _, opts := range []*TempUrlOptions{
+		{Method: "PATCH"},
+		{Digest: "md5"},
+		{IpRange: "192.0.2.0/33"},
+		{Prefix: "other/"},
+	} {
+		if _, err := api.TempUrl("public", "dir/a b.txt", "secret", expires, opts); err == nil {
+			t.Errorf("%+v is accepted", opts)
+		}
+	}
+	if _, err := api.TempUrl("public", "dir/a b.txt", "", expires, nil); err == nil {
+		t.Error("empty key is accepted")
+	}
+}
+
+func TestFormPostSignature(t *testing.T) {
+	api := NewV3()
+	api.Endpoints.ObjectStorage, _ = url.Parse("https://object-storage.example.com/v1/AUTH_test")
+	f, err := api.FormPostSignature("uploads", "user1/", "secret", time.Unix(1700000000, 0), &FormPostOptions{
+		Redirect:     "https://example.com/done",
+		MaxFileSize:  100 << 20,
+		MaxFileCount: 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Url != "https://object-storage.example.com/v1/AUTH_test/uploads/user1/" {
+		t.Errorf("url: %s", f.Url)
+	}
+	if f.Fields["signature"] != "c9a155c290ef01b13786d2d2f3f104ad7a432d868e2ad7583b95252327fd70c5" || f.Fields["max_file_size"] != "104857600" || f.Fields["expires"] != "1700000000" {
+		t.Errorf("fields: %v", f.Fields)
+	}
+	f, err = api.FormPostSignature("uploads", "", "secret", time.Unix(1700000000, 0), &FormPostOptions{MaxFileSize: 1, MaxFileCount: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Url != "https://object-storage.example.com/v1/AUTH_test/uploads/" {
+		t.Errorf("url: %s", f.Url)
+	}
+	if _, err := api.FormPostSignature("uploads", "", "secret", time.Unix(1700000000, 0), nil); err == nil {
+		t.Error("missing limits are accepted")
+	}
+}
+
+func TestSetTempUrlKey(t *testing.T) {
+	s, api := newStorageTestServer(t)
+	s.put("public", "a.txt", nil)
+	if err := api.SetTempUrlKey("secret", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.SetContainerTempUrlKey("public", "secret2", true); err != nil {
+		t.Fatal(err)
+	}
+	account, err := api.GetStorageAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := api.GetContainer("public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Metadata["temp-url-key"] != "secret" || c.Metadata["temp-url-key-2"] != "secret2" {
+		t.Errorf("account: %v, container: %v", account.Metadata, c.Metadata)
+	}
+	if err := api.SetTempUrlKey("", false); err != nil {
+		t.Fatal(err)
+	}
+	account, err = api.GetStorageAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := account.Metadata["temp-url-key"]; ok {
+		t.Errorf("metadata: %v", account.Metadata)
+	}
+}
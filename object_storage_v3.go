@@ -1 +1,540 @@
 package conoha
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// 誰でも読み取りと一覧取得ができる
+	ContainerAclPublicRead = ".r:*,.rlistings"
+)
+
+var ErrObjectNotFound = errors.New(`object not found`)
+
+type (
+	StorageTime struct {
+		time.Time
+	}
+	StorageAccount struct {
+		ContainerCount int64
+		ObjectCount    int64
+		BytesUsed      int64
+		Metadata       map[string]string
+	}
+	Container struct {
+		Name         string      `json:"name"`
+		Count        int64       `json:"count"`
+		Bytes        int64       `json:"bytes"`
+		LastModified StorageTime `json:"last_modified"`
+		// 以下は GetContainer の場合のみ
+		ReadAcl  string            `json:"-"`
+		WriteAcl string            `json:"-"`
+		Metadata map[string]string `json:"-"`
+	}
+	Object struct {
+		Name         string      `json:"name"`
+		Hash         string      `json:"hash"` // MD5(ETag)
+		Bytes        int64       `json:"bytes"`
+		ContentType  string      `json:"content_type"`
+		LastModified StorageTime `json:"last_modified"`
+		Subdir       string      `json:"subdir,omitempty"` // Delimiter を指定した場合の疑似ディレクトリ
+		// 以下は GetObject, DownloadObject の場合のみ
+		Metadata          map[string]string `json:"-"`
+		DeleteAt          time.Time         `json:"-"`
+		StaticLargeObject bool              `json:"-"` // SLOのマニフェスト
+		ObjectManifest    string            `json:"-"` // DLOのセグメントの場所(container/prefix)
+	}
+	StorageListOptions struct {
+		Prefix    string
+		Delimiter string
+		Marker    string
+		EndMarker string
+		Limit     int // 0の場合は全件取得する
+	}
+	// nilの項目は変更しない
+	ContainerRequest struct {
+		ReadAcl        *string
+		WriteAcl       *string
+		Metadata       map[string]string
+		RemoveMetadata []string
+	}
+	UploadObjectOptions struct {
+		ContentType string
+		Size        int64 // 0の場合はチャンク転送
+		Metadata    map[string]string
+		DeleteAfter time.Duration // 0の場合は自動削除しない
+	}
+	DownloadObjectOptions struct {
+		Offset int64
+		Length int64 // 0の場合は最後まで
+	}
+)
+
+// 一覧の last_modified はタイムゾーンなしのUTC(マイクロ秒まで)
+func (t *StorageTime) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil || s == "" {
+		// null
+		return nil
+	}
+	v, err := time.ParseInLocation("2006-01-02T15:04:05.999999", s, time.UTC)
+	if err != nil {
+		v, err = time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+	}
+	t.Time = toJst(v)
+	return nil
+}
+
+func (t StorageTime) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.Time)
+}
+
+// エンドポイントはテナントのパス(/v1/AUTH_xxx)を含むため、その後ろにコンテナとオブジェクトを追加する
+func storagePath(base, container, object string) string {
+	p := strings.TrimSuffix(base, "/")
+	if container == "" {
+		return p
+	}
+	p += "/" + container
+	if object != "" {
+		p += "/" + object
+	}
+	return p
+}
+
+// オブジェクトストレージはヘッダーでメタデータを扱い、ボディをストリームで扱う必要があるため net/http を直接使用する
+func (api *V3) storageRequest(ctx context.Context, method, container, object string, query url.Values, header http.Header, body io.Reader, status ...int) (*http.Response, error) {
+	if api.Endpoints.ObjectStorage == nil {
+		return nil, fmt.Errorf(`endpoint is not set`)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	endpoint := *api.Endpoints.ObjectStorage
+	endpoint.Path = storagePath(endpoint.Path, container, object)
+	endpoint.RawPath = ""
+	endpoint.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("X-Auth-Token", api.Token)
+	if n, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil {
+		req.ContentLength = n
+		req.Header.Del("Content-Length")
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(status, res.StatusCode) {
+		return res, nil
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf(`%w: %s`, ErrObjectNotFound, storagePath("", container, object))
+	}
+	b, _ := io.ReadAll(res.Body)
+	if len(b) == 0 {
+		b = []byte(res.Status)
+	}
+	return nil, toStatusError(res.StatusCode, b)
+}
+
+// ボディを読み捨ててレスポンスヘッダーのみ返す
+func (api *V3) storageHeader(method, container, object string, query url.Values, header http.Header, status ...int) (http.Header, error) {
+	res, err := api.storageRequest(context.Background(), method, container, object, query, header, nil, status...)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	return res.Header, nil
+}
+
+// prefix で始まるヘッダーをメタデータとして取り出す(キーは小文字)
+func storageMetadata(h http.Header, prefix string) map[string]string {
+	m := map[string]string{}
+	for k, v := range h {
+		if len(k) > len(prefix) && strings.EqualFold(k[:len(prefix)], prefix) && len(v) > 0 {
+			m[strings.ToLower(k[len(prefix):])] = v[0]
+		}
+	}
+	return m
+}
+
+func headerInt(h http.Header, key string) int64 {
+	n, _ := strconv.ParseInt(h.Get(key), 10, 64)
+	return n
+}
+
+func headerTime(h http.Header, key string) StorageTime {
+	t, err := http.ParseTime(h.Get(key))
+	if err != nil {
+		return StorageTime{}
+	}
+	return StorageTime{toJst(t)}
+}
+
+func (o *StorageListOptions) values() url.Values {
+	q := url.Values{"format": {"json"}}
+	if o == nil {
+		return q
+	}
+	if o.Prefix != "" {
+		q.Set("prefix", o.Prefix)
+	}
+	if o.Delimiter != "" {
+		q.Set("delimiter", o.Delimiter)
+	}
+	if o.Marker != "" {
+		q.Set("marker", o.Marker)
+	}
+	if o.EndMarker != "" {
+		q.Set("end_marker", o.EndMarker)
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	return q
+}
+
+// 一覧取得(Limit を指定しない場合は空のページが返るまで marker で全ページ取得する)
+// サーバーの設定により1ページの件数は変わるため、件数では終端を判定しない
+func storageList[T any](api *V3, container string, opts *StorageListOptions, name func(T) string) ([]T, error) {
+	q := opts.values()
+	all := []T{}
+	for {
+		res, err := api.storageRequest(context.Background(), "GET", container, "", q, nil, nil, http.StatusOK, http.StatusNoContent)
+		if err != nil {
+			return nil, err
+		}
+		var v []T
+		if res.StatusCode == http.StatusOK {
+			err = json.NewDecoder(res.Body).Decode(&v)
+		}
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, v...)
+		if (opts != nil && opts.Limit > 0) || len(v) == 0 {
+			return all, nil
+		}
+		q.Set("marker", name(v[len(v)-1]))
+	}
+}
+
+// アカウント情報取得
+func (api *V3) GetStorageAccount() (*StorageAccount, error) {
+	h, err := api.storageHeader("HEAD", "", "", nil, nil, http.StatusNoContent, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return &StorageAccount{
+		ContainerCount: headerInt(h, "X-Account-Container-Count"),
+		ObjectCount:    headerInt(h, "X-Account-Object-Count"),
+		BytesUsed:      headerInt(h, "X-Account-Bytes-Used"),
+		Metadata:       storageMetadata(h, "X-Account-Meta-"),
+	}, nil
+}
+
+// アカウントのメタデータ更新
+func (api *V3) UpdateStorageAccount(metadata map[string]string, remove []string) error {
+	h := http.Header{}
+	for k, v := range metadata {
+		h.Set("X-Account-Meta-"+k, v)
+	}
+	for _, k := range remove {
+		h.Set("X-Remove-Account-Meta-"+k, "x")
+	}
+	_, err := api.storageHeader("POST", "", "", nil, h, http.StatusNoContent)
+	return err
+}
+
+// コンテナ一覧取得
+func (api *V3) GetContainers(opts *StorageListOptions) ([]Container, error) {
+	return storageList(api, "", opts, func(c Container) string { return c.Name })
+}
+
+// コンテナ情報取得
+func (api *V3) GetContainer(name string) (*Container, error) {
+	if name == "" {
+		return nil, fmt.Errorf(`container name is empty`)
+	}
+	h, err := api.storageHeader("HEAD", name, "", nil, nil, http.StatusNoContent, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return &Container{
+		Name:         name,
+		Count:        headerInt(h, "X-Container-Object-Count"),
+		Bytes:        headerInt(h, "X-Container-Bytes-Used"),
+		LastModified: headerTime(h, "Last-Modified"),
+		ReadAcl:      h.Get("X-Container-Read"),
+		WriteAcl:     h.Get("X-Container-Write"),
+		Metadata:     storageMetadata(h, "X-Container-Meta-"),
+	}, nil
+}
+
+func (req *ContainerRequest) header() http.Header {
+	h := http.Header{}
+	if req == nil {
+		return h
+	}
+	if req.ReadAcl != nil {
+		h.Set("X-Container-Read", *req.ReadAcl)
+	}
+	if req.WriteAcl != nil {
+		h.Set("X-Container-Write", *req.WriteAcl)
+	}
+	for k, v := range req.Metadata {
+		h.Set("X-Container-Meta-"+k, v)
+	}
+	for _, k := range req.RemoveMetadata {
+		h.Set("X-Remove-Container-Meta-"+k, "x")
+	}
+	return h
+}
+
+// コンテナ作成(既に存在する場合は req の内容で更新される)
+func (api *V3) CreateContainer(name string, req *ContainerRequest) error {
+	if name == "" {
+		return fmt.Errorf(`container name is empty`)
+	}
+	_, err := api.storageHeader("PUT", name, "", nil, req.header(), http.StatusCreated, http.StatusAccepted)
+	return err
+}
+
+// コンテナのACLとメタデータ更新
+func (api *V3) UpdateContainer(name string, req *ContainerRequest) error {
+	if name == "" {
+		return fmt.Errorf(`container name is empty`)
+	}
+	_, err := api.storageHeader("POST", name, "", nil, req.header(), http.StatusNoContent)
+	return err
+}
+
+// コンテナ削除(空でない場合は失敗する)
+func (api *V3) DeleteContainer(name string) error {
+	if name == "" {
+		return fmt.Errorf(`container name is empty`)
+	}
+	_, err := api.storageHeader("DELETE", name, "", nil, nil, http.StatusNoContent)
+	return err
+}
+
+// オブジェクト一覧取得
+func (api *V3) GetObjects(container string, opts *StorageListOptions) ([]Object, error) {
+	if container == "" {
+		return nil, fmt.Errorf(`container name is empty`)
+	}
+	return storageList(api, container, opts, func(o Object) string {
+		if o.Subdir != "" {
+			return o.Subdir
+		}
+		return o.Name
+	})
+}
+
+func toObject(name string, h http.Header) *Object {
+	o := &Object{
+		Name:         name,
+		Hash:         strings.Trim(h.Get("Etag"), `"`),
+		Bytes:        headerInt(h, "Content-Length"),
+		ContentType:  h.Get("Content-Type"),
+		LastModified: headerTime(h, "Last-Modified"),
+		Metadata:     storageMetadata(h, "X-Object-Meta-"),
+	}
+	// Rangeリクエストの場合は全体のサイズ
+	if _, total, ok := strings.Cut(h.Get("Content-Range"), "/"); ok {
+		if n, err := strconv.ParseInt(total, 10, 64); err == nil {
+			o.Bytes = n
+		}
+	}
+	o.StaticLargeObject, _ = strconv.ParseBool(h.Get("X-Static-Large-Object"))
+	o.ObjectManifest, _ = url.PathUnescape(h.Get("X-Object-Manifest"))
+	if n := headerInt(h, "X-Delete-At"); n > 0 {
+		o.DeleteAt = toJst(time.Unix(n, 0))
+	}
+	return o
+}
+
+func checkObjectName(container, name string) error {
+	if container == "" {
+		return fmt.Errorf(`container name is empty`)
+	}
+	if name == "" {
+		return fmt.Errorf(`object name is empty`)
+	}
+	return nil
+}
+
+// オブジェクト情報取得
+func (api *V3) GetObject(container, name string) (*Object, error) {
+	if err := checkObjectName(container, name); err != nil {
+		return nil, err
+	}
+	h, err := api.storageHeader("HEAD", container, name, nil, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return toObject(name, h), nil
+}
+
+// オブジェクトアップロード
+// 送信した内容のMD5とレスポンスのETagを比較する
+func (api *V3) UploadObject(ctx context.Context, container, name string, r io.Reader, opts *UploadObjectOptions) (*Object, error) {
+	if err := checkObjectName(container, name); err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &UploadObjectOptions{}
+	}
+	h := http.Header{}
+	if opts.ContentType != "" {
+		h.Set("Content-Type", opts.ContentType)
+	}
+	if opts.Size > 0 {
+		h.Set("Content-Length", strconv.FormatInt(opts.Size, 10))
+	}
+	for k, v := range opts.Metadata {
+		h.Set("X-Object-Meta-"+k, v)
+	}
+	if opts.DeleteAfter > 0 {
+		h.Set("X-Delete-After", strconv.FormatInt(int64(opts.DeleteAfter/time.Second), 10))
+	}
+	hash := md5.New()
+	cr := &countingReader{r: io.TeeReader(r, hash)}
+	res, err := api.storageRequest(ctx, "PUT", container, name, nil, h, cr, http.StatusCreated)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if opts.Size > 0 && cr.n != opts.Size {
+		return nil, fmt.Errorf(`Size mismatch: expected %d, sent %d`, opts.Size, cr.n)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	etag := strings.Trim(res.Header.Get("Etag"), `"`)
+	if etag != "" && etag != sum {
+		return nil, fmt.Errorf(`ETag mismatch: expected %s, got %s`, sum, etag)
+	}
+	return &Object{
+		Name:         name,
+		Hash:         sum,
+		Bytes:        cr.n,
+		ContentType:  opts.ContentType,
+		LastModified: headerTime(res.Header, "Last-Modified"),
+		Metadata:     opts.Metadata,
+	}, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// オブジェクトダウンロード
+// Offset, Length を指定した場合はその範囲のみ書き込む
+func (api *V3) DownloadObject(ctx context.Context, container, name string, w io.Writer, opts *DownloadObjectOptions) (*Object, error) {
+	if err := checkObjectName(container, name); err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &DownloadObjectOptions{}
+	}
+	if opts.Offset < 0 || opts.Length < 0 {
+		return nil, fmt.Errorf(`invalid range: offset %d, length %d`, opts.Offset, opts.Length)
+	}
+	h := http.Header{}
+	if opts.Length > 0 {
+		h.Set("Range", fmt.Sprintf("bytes=%d-%d", opts.Offset, opts.Offset+opts.Length-1))
+	} else if opts.Offset > 0 {
+		h.Set("Range", fmt.Sprintf("bytes=%d-", opts.Offset))
+	}
+	res, err := api.storageRequest(ctx, "GET", container, name, nil, h, nil, http.StatusOK, http.StatusPartialContent)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var body io.Reader = res.Body
+	if res.StatusCode == http.StatusOK && h.Get("Range") != "" {
+		// Rangeリクエストが無視された場合は範囲外を読み捨てる
+		if _, err := io.CopyN(io.Discard, res.Body, opts.Offset); err != nil {
+			return nil, err
+		}
+		if opts.Length > 0 {
+			body = io.LimitReader(res.Body, opts.Length)
+		}
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		return nil, err
+	}
+	return toObject(name, res.Header), nil
+}
+
+// オブジェクトコピー(メタデータも引き継がれる)
+func (api *V3) CopyObject(srcContainer, srcName, dstContainer, dstName string) error {
+	if err := checkObjectName(srcContainer, srcName); err != nil {
+		return err
+	}
+	if err := checkObjectName(dstContainer, dstName); err != nil {
+		return err
+	}
+	h := http.Header{}
+	h.Set("X-Copy-From", (&url.URL{Path: storagePath("", srcContainer, srcName)}).EscapedPath())
+	h.Set("Content-Length", "0")
+	_, err := api.storageHeader("PUT", dstContainer, dstName, nil, h, http.StatusCreated)
+	return err
+}
+
+// オブジェクトのメタデータ更新
+// 既存のメタデータは全て metadata に置き換えられる
+func (api *V3) UpdateObject(container, name string, metadata map[string]string) error {
+	if err := checkObjectName(container, name); err != nil {
+		return err
+	}
+	h := http.Header{}
+	for k, v := range metadata {
+		h.Set("X-Object-Meta-"+k, v)
+	}
+	_, err := api.storageHeader("POST", container, name, nil, h, http.StatusAccepted)
+	return err
+}
+
+// オブジェクト削除
+func (api *V3) DeleteObject(container, name string) error {
+	if err := checkObjectName(container, name); err != nil {
+		return err
+	}
+	_, err := api.storageHeader("DELETE", container, name, nil, nil, http.StatusNoContent)
+	return err
+}
@@ -1 +1,599 @@
 package conoha
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type (
+	storageTestObject struct {
+		data     []byte
+		header   http.Header // Content-Type, X-Object-Meta-*, X-Delete-At
+		modified time.Time
+		manifest []sloManifestEntry // SLOの場合のみ
+	}
+	storageTestContainer struct {
+		header  http.Header // X-Container-Read, X-Container-Write, X-Container-Meta-*
+		objects map[string]*storageTestObject
+	}
+	// Swift の動作を模したテスト用サーバー
+	storageTestServer struct {
+		*httptest.Server
+		mu         sync.Mutex
+		account    http.Header
+		containers map[string]*storageTestContainer
+		requests   []string // "METHOD /container/object"
+		fail       func(r *http.Request) bool
+		pageSize   int // 一覧の1ページあたりの件数(0の場合は10000)
+	}
+)
+
+const storageTestBase = "/v1/AUTH_test"
+
+func newStorageTestServer(t *testing.T) (*storageTestServer, *V3) {
+	s := &storageTestServer{account: http.Header{}, containers: map[string]*storageTestContainer{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	api := NewV3()
+	api.Token = "token"
+	api.Endpoints.ObjectStorage, _ = url.Parse(s.URL + storageTestBase)
+	return s, api
+}
+
+func (s *storageTestServer) put(container, name string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.containers[container]
+	if !ok {
+		c = &storageTestContainer{header: http.Header{}, objects: map[string]*storageTestObject{}}
+		s.containers[container] = c
+	}
+	c.objects[name] = &storageTestObject{data: data, header: http.Header{"Content-Type": {"application/octet-stream"}}, modified: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+}
+
+func (s *storageTestServer) object(container, name string) *storageTestObject {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.containers[container]; ok {
+		return c.objects[name]
+	}
+	return nil
+}
+
+// prefix で始まるヘッダーを dst に反映する(X-Remove-* は削除)
+func applyStorageHeader(dst, src http.Header, prefixes ...string) {
+	for k, v := range src {
+		for _, p := range prefixes {
+			if strings.HasPrefix(k, "X-Remove-") && strings.HasPrefix("X-"+strings.TrimPrefix(k, "X-Remove-"), p) {
+				dst.Del("X-" + strings.TrimPrefix(k, "X-Remove-"))
+			} else if strings.HasPrefix(k, p) {
+				if v[0] == "" {
+					dst.Del(k)
+				} else {
+					dst[k] = v
+				}
+			}
+		}
+	}
+}
+
+func storageTestList[T any](w http.ResponseWriter, r *http.Request, pageSize int, names []string, delimiter bool, entry func(name string) T, subdir func(name string) T) {
+	slices.Sort(names)
+	q := r.URL.Query()
+	limit := pageSize
+	if limit == 0 {
+		limit = 10000
+	}
+	if n, err := strconv.Atoi(q.Get("limit")); err == nil {
+		limit = n
+	}
+	list := []T{}
+	last := ""
+	for _, name := range names {
+		if !strings.HasPrefix(name, q.Get("prefix")) || name <= q.Get("marker") || (q.Get("end_marker") != "" && name >= q.Get("end_marker")) {
+			continue
+		}
+		if d := q.Get("delimiter"); delimiter && d != "" {
+			if i := strings.Index(name[len(q.Get("prefix")):], d); i >= 0 {
+				dir := name[:len(q.Get("prefix"))+i+len(d)]
+				if dir != last && dir > q.Get("marker") {
+					list = append(list, subdir(dir))
+					last = dir
+				}
+				continue
+			}
+		}
+		list = append(list, entry(name))
+	}
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func (s *storageTestServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Header.Get("X-Auth-Token") != "token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	p, ok := strings.CutPrefix(r.URL.Path, storageTestBase)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	s.requests = append(s.requests, r.Method+" "+p)
+	if s.fail != nil && s.fail(r) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	container, name, _ := strings.Cut(strings.TrimPrefix(p, "/"), "/")
+	switch {
+	case container == "":
+		s.handleAccount(w, r)
+	case name == "":
+		s.handleContainer(w, r, container)
+	default:
+		s.handleObject(w, r, container, name)
+	}
+}
+
+func (s *storageTestServer) handleAccount(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "HEAD", "GET":
+		objects, bytes := 0, 0
+		for _, c := range s.containers {
+			for _, o := range c.objects {
+				objects++
+				bytes += len(o.data)
+			}
+		}
+		for k, v := range s.account {
+			w.Header()[k] = v
+		}
+		w.Header().Set("X-Account-Container-Count", strconv.Itoa(len(s.containers)))
+		w.Header().Set("X-Account-Object-Count", strconv.Itoa(objects))
+		w.Header().Set("X-Account-Bytes-Used", strconv.Itoa(bytes))
+		if r.Method == "HEAD" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		names := []string{}
+		for name := range s.containers {
+			names = append(names, name)
+		}
+		storageTestList(w, r, s.pageSize, names, false, func(name string) Container {
+			c := Container{Name: name, Count: int64(len(s.containers[name].objects))}
+			for _, o := range s.containers[name].objects {
+				c.Bytes += int64(len(o.data))
+			}
+			return c
+		}, nil)
+	case "POST":
+		applyStorageHeader(s.account, r.Header, "X-Account-Meta-")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *storageTestServer) handleContainer(w http.ResponseWriter, r *http.Request, name string) {
+	c, ok := s.containers[name]
+	if !ok && r.Method != "PUT" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case "HEAD", "GET":
+		for k, v := range c.header {
+			w.Header()[k] = v
+		}
+		bytes := 0
+		for _, o := range c.objects {
+			bytes += len(o.data)
+		}
+		w.Header().Set("X-Container-Object-Count", strconv.Itoa(len(c.objects)))
+		w.Header().Set("X-Container-Bytes-Used", strconv.Itoa(bytes))
+		if r.Method == "HEAD" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		names := []string{}
+		for name := range c.objects {
+			names = append(names, name)
+		}
+		storageTestList(w, r, s.pageSize, names, true, func(name string) map[string]any {
+			o := c.objects[name]
+			sum := md5.Sum(o.data)
+			return map[string]any{"name": name, "hash": hex.EncodeToString(sum[:]), "bytes": len(o.data), "content_type": o.header.Get("Content-Type"), "last_modified": o.modified.Format("2006-01-02T15:04:05.000000")}
+		}, func(dir string) map[string]any {
+			return map[string]any{"subdir": dir}
+		})
+	case "PUT":
+		status := http.StatusAccepted
+		if !ok {
+			c = &storageTestContainer{header: http.Header{}, objects: map[string]*storageTestObject{}}
+			s.containers[name] = c
+			status = http.StatusCreated
+		}
+		applyStorageHeader(c.header, r.Header, "X-Container-Meta-", "X-Container-Read", "X-Container-Write")
+		w.WriteHeader(status)
+	case "POST":
+		applyStorageHeader(c.header, r.Header, "X-Container-Meta-", "X-Container-Read", "X-Container-Write")
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		if len(c.objects) > 0 {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`<html><h1>Conflict</h1><p>There was a conflict when trying to complete your request.</p></html>`))
+			return
+		}
+		delete(s.containers, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *storageTestServer) handleObject(w http.ResponseWriter, r *http.Request, container, name string) {
+	c, ok := s.containers[container]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	o, ok := c.objects[name]
+	if !ok && r.Method != "PUT" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case "HEAD", "GET":
+		if o.manifest != nil && r.URL.Query().Get("multipart-manifest") == "get" {
+			list := []map[string]any{}
+			for _, e := range o.manifest {
+				list = append(list, map[string]any{"name": e.Path, "hash": e.Etag, "bytes": e.SizeBytes})
+			}
+			json.NewEncoder(w).Encode(list)
+			return
+		}
+		data := o.data
+		if m := o.header.Get("X-Object-Manifest"); m != "" {
+			// DLOはセグメントを連結して返す
+			data = nil
+			sc, prefix, _ := strings.Cut(m, "/")
+			if src, ok := s.containers[sc]; ok {
+				names := []string{}
+				for name := range src.objects {
+					if strings.HasPrefix(name, prefix) {
+						names = append(names, name)
+					}
+				}
+				slices.Sort(names)
+				for _, name := range names {
+					data = append(data, src.objects[name].data...)
+				}
+			}
+		}
+		for k, v := range o.header {
+			w.Header()[k] = v
+		}
+		sum := md5.Sum(data)
+		w.Header().Set("Etag", hex.EncodeToString(sum[:]))
+		http.ServeContent(w, r, name, o.modified, bytes.NewReader(data))
+	case "PUT":
+		o = &storageTestObject{header: http.Header{}, modified: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+		if r.URL.Query().Get("multipart-manifest") == "put" {
+			if err := json.NewDecoder(r.Body).Decode(&o.manifest); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			etags := ""
+			for _, e := range o.manifest {
+				sc, sn, _ := strings.Cut(strings.TrimPrefix(e.Path, "/"), "/")
+				src, ok := s.containers[sc]
+				if !ok || src.objects[sn] == nil {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(e.Path + ": 404 Not Found"))
+					return
+				}
+				sum := md5.Sum(src.objects[sn].data)
+				if e.Etag != hex.EncodeToString(sum[:]) || e.SizeBytes != int64(len(src.objects[sn].data)) {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(e.Path + ": Etag Mismatch"))
+					return
+				}
+				o.data = append(o.data, src.objects[sn].data...)
+				etags += e.Etag
+			}
+			o.header.Set("Content-Type", "application/octet-stream")
+			o.header.Set("X-Static-Large-Object", "True")
+			applyStorageHeader(o.header, r.Header, "Content-Type", "X-Object-Meta-")
+			c.objects[name] = o
+			sum := md5.Sum([]byte(etags))
+			w.Header().Set("Etag", `"`+hex.EncodeToString(sum[:])+`"`)
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if from := r.Header.Get("X-Copy-From"); from != "" {
+			p, _ := url.PathUnescape(from)
+			sc, sn, _ := strings.Cut(strings.TrimPrefix(p, "/"), "/")
+			src, ok := s.containers[sc]
+			if !ok || src.objects[sn] == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			o.data = slices.Clone(src.objects[sn].data)
+			o.header = src.objects[sn].header.Clone()
+		} else {
+			o.data, _ = io.ReadAll(r.Body)
+			o.header.Set("Content-Type", "application/octet-stream")
+		}
+		applyStorageHeader(o.header, r.Header, "Content-Type", "X-Object-Meta-", "X-Object-Manifest")
+		if n, err := strconv.Atoi(r.Header.Get("X-Delete-After")); err == nil {
+			o.header.Set("X-Delete-At", strconv.FormatInt(o.modified.Unix()+int64(n), 10))
+		}
+		c.objects[name] = o
+		sum := md5.Sum(o.data)
+		w.Header().Set("Etag", hex.EncodeToString(sum[:]))
+		w.Header().Set("Last-Modified", o.modified.Format(http.TimeFormat))
+		w.WriteHeader(http.StatusCreated)
+	case "POST":
+		for k := range o.header {
+			if strings.HasPrefix(k, "X-Object-Meta-") {
+				o.header.Del(k)
+			}
+		}
+		applyStorageHeader(o.header, r.Header, "X-Object-Meta-")
+		w.WriteHeader(http.StatusAccepted)
+	case "DELETE":
+		delete(c.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestStorageTime(t *testing.T) {
+	for s, want := range map[string]string{
+		`"2024-01-02T03:04:05.123456"`: "2024-01-02T12:04:05.123456+09:00",
+		`"2024-01-02T03:04:05"`:        "2024-01-02T12:04:05+09:00",
+		`"2024-01-02T03:04:05Z"`:       "2024-01-02T12:04:05+09:00",
+		`null`:                         "0001-01-01T00:00:00Z",
+	} {
+		var v StorageTime
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if got := v.Format(time.RFC3339Nano); got != want {
+			t.Errorf("%s: %s", s, got)
+		}
+	}
+	var v StorageTime
+	if err := json.Unmarshal([]byte(`"2024-01-02 03:04:05"`), &v); err == nil {
+		t.Error("invalid format is accepted")
+	}
+	if b, _ := json.Marshal(StorageTime{}); string(b) != "null" {
+		t.Errorf("marshal: %s", b)
+	}
+}
+
+func TestContainer(t *testing.T) {
+	s, api := newStorageTestServer(t)
+	acl := ContainerAclPublicRead
+	err := api.CreateContainer("web", &ContainerRequest{ReadAcl: &acl, Metadata: map[string]string{"Owner": "ops", "Env": "prod"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.CreateContainer("backup", nil); err != nil {
+		t.Fatal(err)
+	}
+	c, err := api.GetContainer("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ReadAcl != ContainerAclPublicRead || c.WriteAcl != "" || c.Metadata["owner"] != "ops" || c.Metadata["env"] != "prod" {
+		t.Errorf("container: %+v", c)
+	}
+	empty := ""
+	err = api.UpdateContainer("web", &ContainerRequest{ReadAcl: &empty, Metadata: map[string]string{"Owner": "dev"}, RemoveMetadata: []string{"Env"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = api.GetContainer("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ReadAcl != "" || len(c.Metadata) != 1 || c.Metadata["owner"] != "dev" {
+		t.Errorf("container: %+v", c)
+	}
+
+	s.put("web", "index.html", []byte("hello"))
+	containers, err := api.GetContainers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 2 || containers[0].Name != "backup" || containers[1].Name != "web" || containers[1].Count != 1 || containers[1].Bytes != 5 {
+		t.Errorf("containers: %+v", containers)
+	}
+	account, err := api.GetStorageAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.ContainerCount != 2 || account.ObjectCount != 1 || account.BytesUsed != 5 {
+		t.Errorf("account: %+v", account)
+	}
+	if err := api.UpdateStorageAccount(map[string]string{"Quota-Giga-Bytes": "100"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	account, err = api.GetStorageAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Metadata["quota-giga-bytes"] != "100" {
+		t.Errorf("metadata: %v", account.Metadata)
+	}
+
+	// 空でないコンテナは削除できない
+	err = api.DeleteContainer("web")
+	if err == nil || !strings.Contains(err.Error(), "conflict") {
+		t.Errorf("error: %v", err)
+	}
+	if err := api.DeleteContainer("backup"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = api.GetContainer("backup")
+	if !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("error: %v", err)
+	}
+}
+
+func TestGetObjects(t *testing.T) {
+	s, api := newStorageTestServer(t)
+	for _, name := range []string{"a.txt", "logs/2024/01.log", "logs/2024/02.log", "logs/2025/01.log", "z.txt"} {
+		s.put("data", name, []byte(name))
+	}
+	objects, err := api.GetObjects("data", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 5 || objects[1].Name != "logs/2024/01.log" || objects[1].Bytes != 16 {
+		t.Errorf("objects: %+v", objects)
+	}
+	if objects[0].LastModified.Format(time.RFC3339) != "2024-01-02T12:04:05+09:00" {
+		t.Errorf("last_modified: %v", objects[0].LastModified)
+	}
+	objects, err = api.GetObjects("data", &StorageListOptions{Prefix: "logs/", Delimiter: "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 || objects[0].Subdir != "logs/2024/" || objects[1].Subdir != "logs/2025/" {
+		t.Errorf("objects: %+v", objects)
+	}
+	objects, err = api.GetObjects("data", &StorageListOptions{Marker: "a.txt", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 || objects[0].Name != "logs/2024/01.log" {
+		t.Errorf("objects: %+v", objects)
+	}
+
+	// 1ページに収まらない場合は空のページが返るまで続きを取得する
+	s.pageSize = 2
+	n := len(s.requests)
+	objects, err = api.GetObjects("data", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 5 || objects[4].Name != "z.txt" {
+		t.Errorf("objects: %+v", objects)
+	}
+	if n := len(s.requests) - n; n != 4 {
+		t.Errorf("requests: %d", n)
+	}
+	s.pageSize = 0
+	_, err = api.GetObjects("missing", nil)
+	if !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("error: %v", err)
+	}
+}
+
+func TestObject(t *testing.T) {
+	s, api := newStorageTestServer(t)
+	if err := api.CreateContainer("data", nil); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	body := []byte("0123456789abcdefghij")
+	o, err := api.UploadObject(ctx, "data", "dir/file name.txt", bytes.NewReader(body), &UploadObjectOptions{
+		ContentType: "text/plain",
+		Size:        int64(len(body)),
+		Metadata:    map[string]string{"Owner": "ops"},
+		DeleteAfter: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum(body)
+	if o.Hash != hex.EncodeToString(sum[:]) || o.Bytes != 20 {
+		t.Errorf("object: %+v", o)
+	}
+	if s.object("data", "dir/file name.txt") == nil {
+		t.Fatal("object is not stored")
+	}
+
+	o, err = api.GetObject("data", "dir/file name.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Bytes != 20 || o.ContentType != "text/plain" || o.Metadata["owner"] != "ops" || o.DeleteAt.Unix() != time.Date(2024, 1, 2, 4, 4, 5, 0, time.UTC).Unix() {
+		t.Errorf("object: %+v", o)
+	}
+
+	var w bytes.Buffer
+	o, err = api.DownloadObject(ctx, "data", "dir/file name.txt", &w, &DownloadObjectOptions{Offset: 5, Length: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != "56789abcde" || o.Bytes != 20 {
+		t.Errorf("body: %s, object: %+v", w.String(), o)
+	}
+	w.Reset()
+	if _, err := api.DownloadObject(ctx, "data", "dir/file name.txt", &w, &DownloadObjectOptions{Offset: 15}); err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != "fghij" {
+		t.Errorf("body: %s", w.String())
+	}
+
+	// チャンク転送
+	o, err = api.UploadObject(ctx, "data", "chunked", io.MultiReader(bytes.NewReader(body), strings.NewReader("!")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Bytes != 21 || string(s.object("data", "chunked").data) != string(body)+"!" {
+		t.Errorf("object: %+v", o)
+	}
+
+	if err := api.CopyObject("data", "dir/file name.txt", "data", "copy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.UpdateObject("data", "copy", map[string]string{"Env": "prod"}); err != nil {
+		t.Fatal(err)
+	}
+	o, err = api.GetObject("data", "copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Bytes != 20 || o.ContentType != "text/plain" || len(o.Metadata) != 1 || o.Metadata["env"] != "prod" {
+		t.Errorf("object: %+v", o)
+	}
+
+	if err := api.DeleteObject("data", "copy"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.GetObject("data", "copy"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("error: %v", err)
+	}
+	if err := api.DeleteObject("data", "copy"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("error: %v", err)
+	}
+	if _, err := api.UploadObject(ctx, "data", "", bytes.NewReader(body), nil); err == nil {
+		t.Error("uploaded an object without a name")
+	}
+}